@@ -43,6 +43,7 @@ func DoAnythingTest(t *testing.T, method string) {
 		"form": {},
 		"json": null,
 		"method": "`+method+`",
+		"protocol": "HTTP/1.1",
 		"origin": "127.0.0.1",
 		"url": "http://127.0.0.1:30001/any"
 	}`, body)
@@ -67,6 +68,7 @@ func TestAnythingWithExtraPath(t *testing.T) {
 		"form": {},
 		"json": null,
 		"method": "GET",
+		"protocol": "HTTP/1.1",
 		"origin": "127.0.0.1",
 		"url": "http://127.0.0.1:30001/any/some-random-path-stuff-here"
 	}`, body)
@@ -103,6 +105,7 @@ func TestAnythingWithQueryParams(t *testing.T) {
 		"form": {},
 		"json": null,
 		"method": "GET",
+		"protocol": "HTTP/1.1",
 		"origin": "127.0.0.1",
 		"url": "http://127.0.0.1:30001/any?name=Sherlock"
 	}`, body)
@@ -129,6 +132,7 @@ func TestAnythingFirstSherlockLastHolmes(t *testing.T) {
 		"form": {},
 		"json": null,
 		"method": "GET",
+		"protocol": "HTTP/1.1",
 		"origin": "127.0.0.1",
 		"url": "http://127.0.0.1:30001/any?first=Sherlock&last=Holmes"
 	}`, body)
@@ -156,6 +160,7 @@ func TestAnyWithCustomHeader(t *testing.T) {
 		"form": {},
 		"json": null,
 		"method": "GET",
+		"protocol": "HTTP/1.1",
 		"origin": "127.0.0.1",
 		"url": "http://127.0.0.1:30001/any"
 	}`, body)
@@ -185,6 +190,7 @@ func TestAnythingWithTwoCustomHeader(t *testing.T) {
 		"form": {},
 		"json": null,
 		"method": "GET",
+		"protocol": "HTTP/1.1",
 		"origin": "127.0.0.1",
 		"url": "http://127.0.0.1:30001/any"
 	}`, body)
@@ -215,6 +221,7 @@ func TestAnyWithMultipleHeaderValues(t *testing.T) {
 		"form": {},
 		"json": null,
 		"method": "GET",
+		"protocol": "HTTP/1.1",
 		"origin": "127.0.0.1",
 		"url": "http://127.0.0.1:30001/any"
 	}`, body)
@@ -234,6 +241,7 @@ func TestAnythingWithFormBody(t *testing.T) {
 	s.Equal(c.ApplicationJSON, resp.Header.Get(c.ContentType))
 	s.JSONEq(`{
 		"method": "POST",
+		"protocol": "HTTP/1.1",
 		"args": {},
 		"headers": {
 			"Accept-Encoding": "gzip",
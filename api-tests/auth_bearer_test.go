@@ -0,0 +1,45 @@
+package api_tests
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/sharat87/httpbun/c"
+)
+
+func TestBearerStrictInvalidToken(t *testing.T) {
+	s := assert.New(t)
+	resp, body := ExecRequest(R{
+		Path:    "bearer/strict/abc",
+		Headers: map[string][]string{"Authorization": {"Bearer xyz"}},
+	})
+	s.Equal(http.StatusUnauthorized, resp.StatusCode)
+	s.Equal(`Bearer realm="httpbun realm", error="invalid_token", error_description="The access token is invalid"`, resp.Header.Get(c.WWWAuthenticate))
+	s.Contains(body, `"error": "invalid_token"`)
+}
+
+func TestBearerStrictInsufficientScope(t *testing.T) {
+	s := assert.New(t)
+	resp, _ := ExecRequest(R{
+		Path:    "bearer/strict/abc?scope=read%20write",
+		Headers: map[string][]string{"Authorization": {"Bearer abc"}},
+	})
+	s.Equal(http.StatusForbidden, resp.StatusCode)
+	s.Contains(resp.Header.Get(c.WWWAuthenticate), `error="insufficient_scope"`)
+	s.Contains(resp.Header.Get(c.WWWAuthenticate), `scope="read write"`)
+}
+
+func TestBearerStrictFormBody(t *testing.T) {
+	s := assert.New(t)
+	resp, body := ExecRequest(R{
+		Method:  http.MethodPost,
+		Path:    "bearer/strict/abc?scope=read&granted=read",
+		Body:    "access_token=abc",
+		Headers: map[string][]string{c.ContentType: {"application/x-www-form-urlencoded"}},
+	})
+	s.Equal(http.StatusOK, resp.StatusCode)
+	s.Equal("private", resp.Header.Get("Cache-Control"))
+	s.JSONEq(`{"authenticated": true, "token": "abc", "source": "body", "scope": "read"}`, body)
+}
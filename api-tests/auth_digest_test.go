@@ -1,6 +1,9 @@
 package api_tests
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
 	"net/http"
 	"regexp"
 	"testing"
@@ -106,3 +109,37 @@ func TestDigestAuthWithIncorrectCredsWithoutCookie(t *testing.T) {
 	s.NotEmpty(m, "Unexpected value for "+c.WWWAuthenticate+": "+resp.Header.Get(c.WWWAuthenticate))
 	s.Contains(body, "Response code mismatch")
 }
+
+func TestDigestAuthSha256WithReplay(t *testing.T) {
+	s := assert.New(t)
+	path := "digest-auth/auth/dave/diamond/SHA-256,MD5?userhash=true"
+
+	resp, _ := ExecRequest(R{Path: path})
+	s.Equal(http.StatusUnauthorized, resp.StatusCode)
+	challenges := resp.Header.Values(c.WWWAuthenticate)
+	if !s.Len(challenges, 2) {
+		return
+	}
+	s.Contains(challenges[0], "algorithm=SHA-256")
+	s.Contains(challenges[1], "algorithm=MD5")
+	nonce := regexp.MustCompile(`nonce="([^"]+)"`).FindStringSubmatch(challenges[0])[1]
+
+	h := func(text string) string {
+		sum := sha256.Sum256([]byte(text))
+		return hex.EncodeToString(sum[:])
+	}
+	ha1 := h("dave:httpbun realm:diamond")
+	ha2 := h("GET:/" + path)
+	authHeader := fmt.Sprintf(
+		`Digest username="%s", realm="httpbun realm", nonce="%s", uri="/%s", algorithm=SHA-256, qop=auth, nc=00000001, cnonce="abc", response="%s", userhash=true`,
+		h("dave:httpbun realm"), nonce, path, h(ha1+":"+nonce+":00000001:abc:auth:"+ha2),
+	)
+
+	resp, body := ExecRequest(R{Path: path, Headers: map[string][]string{"Authorization": {authHeader}}})
+	s.Equal(http.StatusOK, resp.StatusCode, body)
+
+	resp, body = ExecRequest(R{Path: path, Headers: map[string][]string{"Authorization": {authHeader}}})
+	s.Equal(http.StatusUnauthorized, resp.StatusCode)
+	s.Contains(body, "Nonce count replayed")
+	s.Contains(resp.Header.Get(c.WWWAuthenticate), "stale=FALSE")
+}
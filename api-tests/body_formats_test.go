@@ -0,0 +1,96 @@
+package api_tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/vmihailenco/msgpack/v5"
+
+	"github.com/sharat87/httpbun/c"
+)
+
+func postAnything(t *testing.T, contentType, body string) map[string]any {
+	t.Helper()
+	resp, respBody := ExecRequest(R{
+		Method: http.MethodPost,
+		Path:   "anything",
+		Body:   body,
+		Headers: map[string][]string{
+			c.ContentType: {contentType},
+		},
+	})
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("unexpected status %d: %s", resp.StatusCode, respBody)
+	}
+
+	var data map[string]any
+	if err := json.Unmarshal([]byte(respBody), &data); err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestAnythingXML(t *testing.T) {
+	s := assert.New(t)
+	data := postAnything(t, "application/xml", `<?xml version="1.0"?>
+<order id="7"><item>bun</item><item>tea</item><note lang="en">hot</note><empty/></order>`)
+	s.Equal(map[string]any{
+		"order": map[string]any{
+			"@id":   "7",
+			"item":  []any{"bun", "tea"},
+			"note":  map[string]any{"@lang": "en", "#text": "hot"},
+			"empty": "",
+		},
+	}, data["xml"])
+	s.Nil(data["json"])
+}
+
+func TestAnythingInvalidXML(t *testing.T) {
+	s := assert.New(t)
+	data := postAnything(t, "text/xml", `<order>`)
+	s.NotContains(data, "xml")
+	s.Equal("<order>", data["data"])
+}
+
+func TestAnythingYAML(t *testing.T) {
+	s := assert.New(t)
+	data := postAnything(t, "application/yaml", "name: bun\ntags: [a, b]\n1: one\n")
+	s.Equal(map[string]any{
+		"name": "bun",
+		"tags": []any{"a", "b"},
+		"1":    "one",
+	}, data["yaml"])
+}
+
+func TestAnythingCBOR(t *testing.T) {
+	s := assert.New(t)
+	body, err := cbor.Marshal(map[string]any{"name": "bun", "count": 3})
+	s.NoError(err)
+	data := postAnything(t, "application/cbor", string(body))
+	s.Equal(map[string]any{"name": "bun", "count": float64(3)}, data["cbor"])
+}
+
+func TestAnythingMsgpack(t *testing.T) {
+	s := assert.New(t)
+	body, err := msgpack.Marshal(map[string]any{"name": "bun", "list": []int{1, 2}})
+	s.NoError(err)
+	data := postAnything(t, "application/msgpack", string(body))
+	s.Equal(map[string]any{"name": "bun", "list": []any{float64(1), float64(2)}}, data["msgpack"])
+}
+
+func TestAnythingProtobuf(t *testing.T) {
+	s := assert.New(t)
+	// Field 1: varint 150, field 2: string "hi", field 3: nested message with field 1: varint 1.
+	body := "\x08\x96\x01\x12\x02hi\x1a\x02\x08\x01"
+	data := postAnything(t, "application/x-protobuf", body)
+	s.Equal([]any{
+		map[string]any{"field": float64(1), "wireType": "varint", "value": float64(150)},
+		map[string]any{"field": float64(2), "wireType": "len", "value": "hi"},
+		map[string]any{"field": float64(3), "wireType": "len", "value": []any{
+			map[string]any{"field": float64(1), "wireType": "varint", "value": float64(1)},
+		}},
+	}, data["protobuf"])
+}
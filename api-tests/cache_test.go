@@ -0,0 +1,174 @@
+package api_tests
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCacheLastModified(t *testing.T) {
+	s := assert.New(t)
+
+	resp, _ := ExecRequest(R{Path: "cache?last-modified=1704067200"})
+	s.Equal(http.StatusOK, resp.StatusCode)
+	s.Equal("Mon, 01 Jan 2024 00:00:00 GMT", resp.Header.Get("Last-Modified"))
+	s.Equal(`"1704067200"`, resp.Header.Get("ETag"))
+
+	resp, body := ExecRequest(R{
+		Path:    "cache?last-modified=1704067200",
+		Headers: map[string][]string{"If-Modified-Since": {"Mon, 01 Jan 2024 00:00:00 GMT"}},
+	})
+	s.Equal(http.StatusNotModified, resp.StatusCode)
+	s.Equal("", body)
+
+	resp, _ = ExecRequest(R{
+		Path:    "cache?last-modified=1704067200",
+		Headers: map[string][]string{"If-Modified-Since": {"Sun, 31 Dec 2023 00:00:00 GMT"}},
+	})
+	s.Equal(http.StatusOK, resp.StatusCode)
+}
+
+func TestCacheUnsafeMethodPreconditions(t *testing.T) {
+	s := assert.New(t)
+
+	resp, _ := ExecRequest(R{
+		Method:  http.MethodPut,
+		Path:    "cache?last-modified=1704067200",
+		Headers: map[string][]string{"If-Unmodified-Since": {"Sun, 31 Dec 2023 00:00:00 GMT"}},
+	})
+	s.Equal(http.StatusPreconditionFailed, resp.StatusCode)
+
+	resp, _ = ExecRequest(R{
+		Method:  http.MethodPut,
+		Path:    "cache?last-modified=1704067200",
+		Headers: map[string][]string{"If-Unmodified-Since": {"Mon, 01 Jan 2024 00:00:00 GMT"}},
+	})
+	s.Equal(http.StatusOK, resp.StatusCode)
+}
+
+func TestEtag(t *testing.T) {
+	for name, tt := range map[string]struct {
+		method   string
+		path     string
+		header   string
+		value    string
+		expected int
+	}{
+		"no condition":          {http.MethodGet, "etag/abc", "", "", http.StatusOK},
+		"if-none-match":         {http.MethodGet, "etag/abc", "If-None-Match", `"abc"`, http.StatusNotModified},
+		"if-none-match bare":    {http.MethodGet, "etag/abc", "If-None-Match", `abc`, http.StatusNotModified},
+		"if-none-match list":    {http.MethodGet, "etag/abc", "If-None-Match", `"x", W/"abc"`, http.StatusNotModified},
+		"if-none-match other":   {http.MethodGet, "etag/abc", "If-None-Match", `"x"`, http.StatusOK},
+		"if-none-match on post": {http.MethodPost, "etag/abc", "If-None-Match", `"abc"`, http.StatusPreconditionFailed},
+		"if-match":              {http.MethodPut, "etag/abc", "If-Match", `"abc"`, http.StatusOK},
+		"if-match other":        {http.MethodPut, "etag/abc", "If-Match", `"x"`, http.StatusPreconditionFailed},
+		"if-match weak":         {http.MethodPut, "etag/W%2F%22abc%22", "If-Match", `W/"abc"`, http.StatusPreconditionFailed},
+		"if-none-match weak":    {http.MethodGet, "etag/W%2F%22abc%22", "If-None-Match", `"abc"`, http.StatusNotModified},
+	} {
+		t.Run(name, func(t *testing.T) {
+			s := assert.New(t)
+			r := R{Method: tt.method, Path: tt.path}
+			if tt.header != "" {
+				r.Headers = map[string][]string{tt.header: {tt.value}}
+			}
+			resp, _ := ExecRequest(r)
+			s.Equal(tt.expected, resp.StatusCode)
+			if tt.expected != http.StatusPreconditionFailed {
+				s.NotEmpty(resp.Header.Get("ETag"))
+			}
+		})
+	}
+}
+
+func TestRangeConditional(t *testing.T) {
+	s := assert.New(t)
+	resp, _ := ExecRequest(R{
+		Path: "range/100",
+		Headers: map[string][]string{
+			"Range":         {"bytes=0-9"},
+			"If-None-Match": {`"range-100"`},
+		},
+	})
+	s.Equal(http.StatusNotModified, resp.StatusCode)
+	s.Empty(resp.Header.Get("Content-Range"))
+}
+
+func TestCacheLabHeaders(t *testing.T) {
+	s := assert.New(t)
+	resp, _ := ExecRequest(R{
+		Path: "cache/lab/headers?cc=public&cc=max-age%3D60%2C+stale-while-revalidate%3D30&vary=accept-language,x-tenant&age=12&expires=60",
+	})
+	s.Equal(http.StatusOK, resp.StatusCode)
+	s.Equal("public, max-age=60, stale-while-revalidate=30", resp.Header.Get("Cache-Control"))
+	s.Equal("Accept-Language, X-Tenant", resp.Header.Get("Vary"))
+	s.Equal("12", resp.Header.Get("Age"))
+	expires, err := http.ParseTime(resp.Header.Get("Expires"))
+	s.NoError(err)
+	s.InDelta(60, time.Until(expires).Seconds(), 2)
+}
+
+func TestCacheLabStats(t *testing.T) {
+	s := assert.New(t)
+
+	resp, _ := ExecRequest(R{Method: http.MethodDelete, Path: "cache/stats/counted"})
+	s.Equal(http.StatusNoContent, resp.StatusCode)
+
+	for _, lang := range []string{"en", "en", "fr"} {
+		resp, body := ExecRequest(R{
+			Path:    "cache/lab/counted?vary=Accept-Language",
+			Headers: map[string][]string{"Accept-Language": {lang}},
+		})
+		s.Equal(http.StatusOK, resp.StatusCode)
+		s.Contains(body, `"key": "/cache/lab/counted?vary=Accept-Language Accept-Language=`+hashOf(lang)+`"`)
+	}
+
+	// A request without the varied header is a key of its own. Its ETag is the same, and used for revalidating.
+	resp, _ = ExecRequest(R{Path: "cache/lab/counted?vary=Accept-Language"})
+	resp, _ = ExecRequest(R{
+		Path:    "cache/lab/counted?vary=Accept-Language",
+		Headers: map[string][]string{"Accept-Language": {"en"}, "If-None-Match": {resp.Header.Get("ETag")}},
+	})
+	s.Equal(http.StatusNotModified, resp.StatusCode)
+
+	resp, body := ExecRequest(R{Path: "cache/stats/counted"})
+	s.Equal(http.StatusOK, resp.StatusCode)
+	s.Equal("no-store", resp.Header.Get("Cache-Control"))
+
+	var stats struct {
+		Requests int
+		Keys     map[string]struct {
+			Requests    int
+			Full        int
+			NotModified int
+		}
+	}
+	s.NoError(json.Unmarshal([]byte(body), &stats))
+	s.Equal(5, stats.Requests)
+	s.Len(stats.Keys, 3)
+	en := stats.Keys["/cache/lab/counted?vary=Accept-Language Accept-Language="+hashOf("en")]
+	s.Equal(3, en.Requests)
+	s.Equal(2, en.Full)
+	s.Equal(1, en.NotModified)
+	s.Equal(1, stats.Keys["/cache/lab/counted?vary=Accept-Language Accept-Language="+hashOf("fr")].Requests)
+	s.Equal(1, stats.Keys["/cache/lab/counted?vary=Accept-Language Accept-Language=-"].Requests)
+}
+
+// hashOf gives the hash that header values are shown as, in cache keys.
+func hashOf(value string) string {
+	sum := sha256.Sum256([]byte(value))
+	return hex.EncodeToString(sum[:8])
+}
+
+func TestCacheStatsNeedsName(t *testing.T) {
+	for _, method := range []string{http.MethodGet, http.MethodDelete} {
+		t.Run(method, func(t *testing.T) {
+			resp, _ := ExecRequest(R{Method: method, Path: "cache/stats"})
+			assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+		})
+	}
+}
@@ -0,0 +1,139 @@
+package api_tests
+
+import (
+	"encoding/base64"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChunkedRaw(t *testing.T) {
+	s := assert.New(t)
+
+	conn, err := net.Dial("tcp", BindTarget)
+	s.NoError(err)
+	defer conn.Close()
+
+	_, err = conn.Write([]byte("GET /chunked?sizes=3,5&ext=a%3D1&ext=b&trailer=Grpc-Status:0&declare=grpc-message HTTP/1.1\r\n" +
+		"Host: " + BindTarget + "\r\n\r\n"))
+	s.NoError(err)
+
+	// The server closes the connection after a chunked response.
+	raw, err := io.ReadAll(conn)
+	s.NoError(err)
+
+	head, body, found := strings.Cut(string(raw), "\r\n\r\n")
+	s.True(found)
+	s.Contains(head, "HTTP/1.1 200 OK\r\n")
+	s.Contains(head, "\r\nTransfer-Encoding: chunked\r\n")
+	s.Contains(head, "\r\nTrailer: Grpc-Message\r\n")
+	s.Contains(head, "\r\nTrailer: Grpc-Status\r\n")
+	s.NotContains(head, "Content-Length")
+	s.Equal("3;a=1\r\naaa\r\n5;b\r\nbbbbb\r\n0\r\nGrpc-Status: 0\r\n\r\n", body)
+}
+
+func TestChunkedRawKeepAlive(t *testing.T) {
+	s := assert.New(t)
+
+	conn, err := net.Dial("tcp", BindTarget)
+	s.NoError(err)
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	// Without extensions, the connection isn't hijacked, so it stays open for the next request.
+	_, err = conn.Write([]byte("GET /chunked?sizes=3,5&trailer=Grpc-Status:0 HTTP/1.1\r\n" +
+		"Host: " + BindTarget + "\r\n\r\n" +
+		"GET /chunked?sizes=2 HTTP/1.1\r\n" +
+		"Host: " + BindTarget + "\r\n" +
+		"Connection: close\r\n\r\n"))
+	s.NoError(err)
+
+	raw, err := io.ReadAll(conn)
+	s.NoError(err)
+
+	first, second, found := strings.Cut(string(raw), "\r\n\r\nHTTP/1.1 ")
+	s.True(found)
+	head, body, _ := strings.Cut(first, "\r\n\r\n")
+	s.Contains(head+"\r\n", "\r\nTransfer-Encoding: chunked\r\n")
+	s.NotContains(head, "Connection: close")
+	s.Equal("3\r\naaa\r\n5\r\nbbbbb\r\n0\r\nGrpc-Status: 0", body)
+	s.True(strings.HasSuffix(second, "\r\n\r\n2\r\naa\r\n0\r\n\r\n"))
+}
+
+func TestChunkedDecoded(t *testing.T) {
+	s := assert.New(t)
+	start := time.Now()
+	resp, body := ExecRequest(R{
+		Path: "chunked?sizes=2,1,3&delay=0.2&trailer=x-one:1",
+	})
+	s.Equal(http.StatusOK, resp.StatusCode)
+	s.Equal("aabccc", body)
+	s.Equal([]string{"chunked"}, resp.TransferEncoding)
+	s.Equal(http.Header{"X-One": {"1"}}, resp.Trailer)
+	s.GreaterOrEqual(time.Since(start), 400*time.Millisecond)
+}
+
+func TestChunkedInvalid(t *testing.T) {
+	for _, query := range []string{
+		"sizes=0",
+		"sizes=abc",
+		"sizes=1,2&ext=a&ext=b&ext=c",
+		"delay=11",
+		"trailer=no-colon",
+	} {
+		t.Run(query, func(t *testing.T) {
+			resp, _ := ExecRequest(R{Path: "chunked?" + query})
+			assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+		})
+	}
+}
+
+func TestMixTrailers(t *testing.T) {
+	s := assert.New(t)
+	resp, body := ExecRequest(R{
+		Path: "mix/tr=grpc-status:0/tr=grpc-message/b64=aGVsbG8=",
+	})
+	s.Equal(http.StatusOK, resp.StatusCode)
+	s.Equal("hello", body)
+	s.Equal(int64(-1), resp.ContentLength)
+	s.Equal(http.Header{"Grpc-Status": {"0"}, "Grpc-Message": nil}, resp.Trailer)
+}
+
+func TestRunTrailers(t *testing.T) {
+	s := assert.New(t)
+	src := `return {body: "hi", trailers: {"grpc-status": "0", "grpc-message": null}}`
+	resp, body := ExecRequest(R{
+		Path: "run/" + base64.URLEncoding.EncodeToString([]byte(src)),
+	})
+	s.Equal(http.StatusOK, resp.StatusCode)
+	s.Equal("hi", body)
+	s.Equal(http.Header{"Grpc-Status": {"0"}, "Grpc-Message": nil}, resp.Trailer)
+}
+
+func TestChunkedRawHTTP10(t *testing.T) {
+	s := assert.New(t)
+
+	conn, err := net.Dial("tcp", BindTarget)
+	s.NoError(err)
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	// HTTP/1.0 has no chunked encoding, so the body is sent as is, even with extensions asked for.
+	_, err = conn.Write([]byte("GET /chunked?sizes=3,5&ext=a%3D1&trailer=Grpc-Status:0 HTTP/1.0\r\n" +
+		"Host: " + BindTarget + "\r\n\r\n"))
+	s.NoError(err)
+
+	raw, err := io.ReadAll(conn)
+	s.NoError(err)
+
+	head, body, found := strings.Cut(string(raw), "\r\n\r\n")
+	s.True(found)
+	s.True(strings.HasPrefix(head, "HTTP/1.0 200 OK\r\n"))
+	s.NotContains(head, "Transfer-Encoding")
+	s.Equal("aaabbbbb", body)
+}
@@ -0,0 +1,170 @@
+package api_tests
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/sharat87/httpbun/c"
+	"github.com/sharat87/httpbun/util"
+)
+
+func decompress(t *testing.T, encoding, body string) map[string]any {
+	t.Helper()
+
+	var reader io.Reader
+	var err error
+	switch encoding {
+	case "gzip":
+		reader, err = gzip.NewReader(bytes.NewReader([]byte(body)))
+	case "deflate":
+		reader, err = zlib.NewReader(bytes.NewReader([]byte(body)))
+	case "br":
+		reader = brotli.NewReader(bytes.NewReader([]byte(body)))
+	case "zstd":
+		reader, err = zstd.NewReader(bytes.NewReader([]byte(body)))
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decoded, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var data map[string]any
+	if err := json.Unmarshal(decoded, &data); err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestCompressedEndpoints(t *testing.T) {
+	for path, encoding := range map[string]string{
+		"gzip":    "gzip",
+		"deflate": "deflate",
+		"brotli":  "br",
+		"zstd":    "zstd",
+	} {
+		t.Run(path, func(t *testing.T) {
+			s := assert.New(t)
+			resp, body := ExecRequest(R{
+				Path: path + "?a=b",
+				Headers: map[string][]string{
+					// Setting this explicitly stops Go's client from transparently decoding gzip responses.
+					"Accept-Encoding": {encoding},
+				},
+			})
+			s.Equal(http.StatusOK, resp.StatusCode)
+			s.Equal(c.ApplicationJSON, resp.Header.Get(c.ContentType))
+			s.Equal(encoding, resp.Header.Get(c.ContentEncoding))
+			data := decompress(t, encoding, body)
+			s.Equal(map[string]any{"a": "b"}, data["args"])
+		})
+	}
+}
+
+func TestCompressedMislabeled(t *testing.T) {
+	s := assert.New(t)
+	resp, body := ExecRequest(R{
+		Path: "gzip?label=br",
+		Headers: map[string][]string{
+			"Accept-Encoding": {"gzip, br"},
+		},
+	})
+	s.Equal(http.StatusOK, resp.StatusCode)
+	s.Equal("br", resp.Header.Get(c.ContentEncoding))
+	s.Equal("GET", decompress(t, "gzip", body)["method"])
+}
+
+func TestCompressedUnlabeled(t *testing.T) {
+	s := assert.New(t)
+	resp, body := ExecRequest(R{
+		Path: "zstd?label=",
+		Headers: map[string][]string{
+			"Accept-Encoding": {"zstd"},
+		},
+	})
+	s.Equal(http.StatusOK, resp.StatusCode)
+	s.Empty(resp.Header.Values(c.ContentEncoding))
+	s.Equal("GET", decompress(t, "zstd", body)["method"])
+}
+
+func compress(t *testing.T, encoding, content string) string {
+	t.Helper()
+	encoded, err := util.Encode([]byte(content), encoding)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(encoded)
+}
+
+func TestAnythingDecodesCompressedJSON(t *testing.T) {
+	for _, encoding := range []string{"gzip", "deflate", "br", "zstd"} {
+		t.Run(encoding, func(t *testing.T) {
+			s := assert.New(t)
+			body := compress(t, encoding, `{"answer": 42}`)
+			resp, respBody := ExecRequest(R{
+				Method: http.MethodPost,
+				Path:   "anything",
+				Body:   body,
+				Headers: map[string][]string{
+					c.ContentType:     {c.ApplicationJSON},
+					c.ContentEncoding: {encoding},
+				},
+			})
+			s.Equal(http.StatusOK, resp.StatusCode)
+
+			var data map[string]any
+			s.NoError(json.Unmarshal([]byte(respBody), &data))
+			s.Equal(map[string]any{"answer": float64(42)}, data["json"])
+			s.Equal(map[string]any{
+				"encodings":    []any{encoding},
+				"originalSize": float64(len(body)),
+				"decodedSize":  float64(14),
+			}, data["contentEncoding"])
+		})
+	}
+}
+
+func TestAnythingDecodesCompressedForm(t *testing.T) {
+	s := assert.New(t)
+	resp, respBody := ExecRequest(R{
+		Method: http.MethodPost,
+		Path:   "anything",
+		Body:   compress(t, "br", compress(t, "gzip", "one=1&two=2")),
+		Headers: map[string][]string{
+			c.ContentType:     {"application/x-www-form-urlencoded"},
+			c.ContentEncoding: {"gzip, br"},
+		},
+	})
+	s.Equal(http.StatusOK, resp.StatusCode)
+
+	var data map[string]any
+	s.NoError(json.Unmarshal([]byte(respBody), &data))
+	s.Equal(map[string]any{"one": "1", "two": "2"}, data["form"])
+}
+
+func TestAnythingRejectsDecompressionBomb(t *testing.T) {
+	s := assert.New(t)
+	resp, body := ExecRequest(R{
+		Method: http.MethodPost,
+		Path:   "anything",
+		Body:   compress(t, "gzip", strings.Repeat("a", 1<<20)),
+		Headers: map[string][]string{
+			c.ContentEncoding: {"gzip"},
+		},
+	})
+	s.Equal(http.StatusBadRequest, resp.StatusCode)
+	s.Equal("decoded request body is larger than 10000 bytes", body)
+}
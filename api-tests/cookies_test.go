@@ -0,0 +1,84 @@
+package api_tests
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCookiesSetWithAttributes(t *testing.T) {
+	s := assert.New(t)
+	resp, _ := ExecRequest(R{
+		Path: "cookies/set?sid=abc&attr=Max-Age%3D60%3B+Secure&attr=HttpOnly&attr=SameSite%3DNone&attr=Partitioned",
+	})
+	s.Equal(http.StatusFound, resp.StatusCode)
+	s.Equal([]string{"sid=abc; Path=/; Max-Age=60; HttpOnly; Secure; SameSite=None; Partitioned"}, resp.Header.Values("Set-Cookie"))
+}
+
+func TestCookiesMalformed(t *testing.T) {
+	s := assert.New(t)
+	resp, _ := ExecRequest(R{
+		Path: "cookies/malformed?line=a%3Db%3B+Max-Age%3D1%3B+Max-Age%3Dx&line=%3Dnoname",
+	})
+	s.Equal(http.StatusOK, resp.StatusCode)
+	s.Equal([]string{"a=b; Max-Age=1; Max-Age=x", "=noname"}, resp.Header.Values("Set-Cookie"))
+
+	resp, _ = ExecRequest(R{Path: "cookies/malformed/nope"})
+	s.Equal(http.StatusBadRequest, resp.StatusCode)
+}
+
+func TestMixCookieWithAttributes(t *testing.T) {
+	s := assert.New(t)
+	resp, _ := ExecRequest(R{
+		Path: "mix/c=sid:abc/ca=SameSite%3DLax%3BDomain%3Dexample.com",
+	})
+	s.Equal(http.StatusOK, resp.StatusCode)
+	s.Equal([]string{"sid=abc; Path=/; Domain=example.com; SameSite=Lax"}, resp.Header.Values("Set-Cookie"))
+}
+
+func TestMixCookieAttributesNeedCookie(t *testing.T) {
+	s := assert.New(t)
+	resp, _ := ExecRequest(R{Path: "mix/ca=Secure"})
+	s.Equal(http.StatusBadRequest, resp.StatusCode)
+}
+
+func TestCookiesFlowWithCookieJar(t *testing.T) {
+	s := assert.New(t)
+
+	jar, err := cookiejar.New(nil)
+	s.NoError(err)
+	client := http.Client{Jar: jar}
+
+	resp, err := client.Get(BaseURL + "cookies/flow/3")
+	s.NoError(err)
+	defer resp.Body.Close()
+	s.Equal(http.StatusOK, resp.StatusCode)
+	s.Regexp(`/cookies/flow/3/4\?run=[0-9a-f]+$`, resp.Request.URL.String())
+
+	body, err := io.ReadAll(resp.Body)
+	s.NoError(err)
+
+	var report struct {
+		Pass       bool
+		Received   []string
+		Missing    []string
+		Unexpected []string
+		Rules      map[string]struct{ Pass bool }
+	}
+	s.NoError(json.Unmarshal(body, &report))
+	s.True(report.Pass, string(body))
+	s.Empty(report.Missing)
+	s.Empty(report.Unexpected)
+	s.Contains(report.Received, "flow3_path")
+	s.NotContains(report.Received, "flow1_prefix")
+	s.NotContains(report.Received, "flow2_expired")
+	s.NotContains(report.Received, "flow3_foreign")
+
+	// Localhost is a secure origin, so secure cookies are expected even over plain HTTP.
+	s.Contains(report.Received, "flow1_secure")
+	s.Len(report.Rules, 4)
+}
@@ -0,0 +1,325 @@
+package api_tests
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/hpack"
+
+	"github.com/sharat87/httpbun/server"
+	"github.com/sharat87/httpbun/server/spec"
+)
+
+// newH2CClient makes a client that speaks cleartext HTTP/2 with prior knowledge.
+func newH2CClient() *http.Client {
+	protocols := new(http.Protocols)
+	protocols.SetUnencryptedHTTP2(true)
+	return &http.Client{
+		Timeout:   5 * time.Second,
+		Transport: &http.Transport{Protocols: protocols},
+	}
+}
+
+func TestH2CPriorKnowledge(t *testing.T) {
+	s := assert.New(t)
+	resp, err := newH2CClient().Get(BaseURL + "anything")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	var data map[string]any
+	s.NoError(json.NewDecoder(resp.Body).Decode(&data))
+	s.Equal("HTTP/2.0", resp.Proto)
+	s.Equal("HTTP/2.0", data["protocol"])
+}
+
+func TestH2CUpgrade(t *testing.T) {
+	s := assert.New(t)
+
+	conn, err := net.Dial("tcp", BindTarget)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	_, err = io.WriteString(conn, "GET /anything HTTP/1.1\r\n"+
+		"Host: "+BindTarget+"\r\n"+
+		"Connection: Upgrade, HTTP2-Settings\r\n"+
+		"Upgrade: h2c\r\n"+
+		"HTTP2-Settings: AAMAAABkAAQAoAAAAAIAAAAA\r\n"+
+		"\r\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reader := bufio.NewReader(conn)
+	statusLine, err := reader.ReadString('\n')
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Equal("HTTP/1.1 101 Switching Protocols\r\n", statusLine)
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+		if line == "\r\n" {
+			break
+		}
+	}
+
+	if _, err := io.WriteString(conn, http2.ClientPreface); err != nil {
+		t.Fatal(err)
+	}
+	framer := http2.NewFramer(conn, reader)
+	framer.ReadMetaHeaders = hpack.NewDecoder(4096, nil)
+	if err := framer.WriteSettings(); err != nil {
+		t.Fatal(err)
+	}
+
+	var body strings.Builder
+	for {
+		frame, err := framer.ReadFrame()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if headers, ok := frame.(*http2.MetaHeadersFrame); ok {
+			s.Equal(uint32(1), headers.StreamID)
+			s.Equal("200", headers.PseudoValue("status"))
+		} else if data, ok := frame.(*http2.DataFrame); ok {
+			body.Write(data.Data())
+			if data.StreamEnded() {
+				break
+			}
+		}
+	}
+
+	var data map[string]any
+	s.NoError(json.Unmarshal([]byte(body.String()), &data))
+	s.Equal("HTTP/2.0", data["protocol"])
+	s.NotContains(data["headers"], "Upgrade")
+}
+
+func TestTrailers(t *testing.T) {
+	for name, client := range map[string]*http.Client{"HTTP/1.1": http.DefaultClient, "HTTP/2": newH2CClient()} {
+		t.Run(name, func(t *testing.T) {
+			s := assert.New(t)
+			resp, err := client.Get(BaseURL + "trailers?Grpc-Status=0&Grpc-Message=ok")
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, _ = io.ReadAll(resp.Body)
+			_ = resp.Body.Close()
+
+			s.Equal(http.StatusOK, resp.StatusCode)
+			s.Equal(http.Header{"Grpc-Status": {"0"}, "Grpc-Message": {"ok"}}, resp.Trailer)
+		})
+	}
+}
+
+func TestHTTP2Reset(t *testing.T) {
+	s := assert.New(t)
+	resp, err := newH2CClient().Get(BaseURL + "http2/reset")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	s.Equal(http.StatusOK, resp.StatusCode)
+	_, err = io.ReadAll(resp.Body)
+	if s.Error(err) {
+		s.Contains(err.Error(), "INTERNAL_ERROR")
+	}
+}
+
+func TestHTTP2ResetOverHTTP1(t *testing.T) {
+	s := assert.New(t)
+	resp, body := ExecRequest(R{Path: "http2/reset"})
+	s.Equal(http.StatusBadRequest, resp.StatusCode)
+	s.Equal("This endpoint needs HTTP/2, but the request came over HTTP/1.1.\n", body)
+}
+
+func TestHTTP2ResetWithCodeOnMainListener(t *testing.T) {
+	s := assert.New(t)
+	resp, err := newH2CClient().Get(BaseURL + "http2/reset/CANCEL")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+
+	s.Equal(http.StatusBadRequest, resp.StatusCode)
+	s.Equal("Error codes other than INTERNAL_ERROR are only available over cleartext HTTP/2 with prior knowledge, on the listener set with --goaway-bind.\n", string(body))
+}
+
+// rawH2CRequest opens a cleartext HTTP/2 connection with prior knowledge, and sends a GET request for the path on it,
+// as stream 1.
+func rawH2CRequest(t *testing.T, target, path string) (net.Conn, *http2.Framer) {
+	conn, err := net.Dial("tcp", target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	if _, err := io.WriteString(conn, http2.ClientPreface); err != nil {
+		t.Fatal(err)
+	}
+	framer := http2.NewFramer(conn, conn)
+	if err := framer.WriteSettings(); err != nil {
+		t.Fatal(err)
+	}
+
+	var block bytes.Buffer
+	encoder := hpack.NewEncoder(&block)
+	for _, field := range [][2]string{{":method", "GET"}, {":scheme", "http"}, {":authority", target}, {":path", path}} {
+		_ = encoder.WriteField(hpack.HeaderField{Name: field[0], Value: field[1]})
+	}
+	err = framer.WriteHeaders(http2.HeadersFrameParam{
+		StreamID:      1,
+		BlockFragment: block.Bytes(),
+		EndStream:     true,
+		EndHeaders:    true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return conn, framer
+}
+
+func TestHTTP2GoAway(t *testing.T) {
+	s := assert.New(t)
+	const goAwayTarget = "127.0.0.1:30010"
+
+	srv := server.StartNew(spec.Spec{
+		BindTarget:       "127.0.0.1:30009",
+		GoAwayBindTarget: goAwayTarget,
+	})
+	defer srv.CloseAndWait()
+
+	client := newH2CClient()
+
+	var conns []net.Conn
+	get := func(path string) {
+		trace := &httptrace.ClientTrace{
+			GotConn: func(info httptrace.GotConnInfo) {
+				conns = append(conns, info.Conn)
+			},
+		}
+		req, _ := http.NewRequestWithContext(httptrace.WithClientTrace(context.Background(), trace), "GET", "http://"+goAwayTarget+"/"+path, nil)
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, _ = io.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+		s.Equal(http.StatusOK, resp.StatusCode)
+	}
+
+	get("http2/goaway/1")
+	get("get")
+	// Give the client a moment to process the GOAWAY that comes after the second response.
+	time.Sleep(100 * time.Millisecond)
+	get("get")
+
+	s.Same(conns[0], conns[1])
+	s.NotSame(conns[1], conns[2])
+
+	// GOAWAY, with the chosen error code, is only sent on the connection it's asked for on.
+	conn, framer := rawH2CRequest(t, goAwayTarget, "/http2/goaway/0/ENHANCE_YOUR_CALM")
+	defer conn.Close()
+	for {
+		frame, err := framer.ReadFrame()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if goAway, ok := frame.(*http2.GoAwayFrame); ok {
+			s.Equal(http2.ErrCodeEnhanceYourCalm, goAway.ErrCode)
+			break
+		}
+	}
+
+	get("get")
+	s.Same(conns[2], conns[3])
+
+	// Streams are reset with the chosen error code.
+	resp, err := client.Get("http://" + goAwayTarget + "/http2/reset/CANCEL")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	_, err = io.ReadAll(resp.Body)
+	if s.Error(err) {
+		s.Contains(err.Error(), "CANCEL")
+	}
+
+	conn, framer = rawH2CRequest(t, goAwayTarget, "/http2/reset/42")
+	defer conn.Close()
+	for {
+		frame, err := framer.ReadFrame()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if reset, ok := frame.(*http2.RSTStreamFrame); ok {
+			s.Equal(http2.ErrCode(42), reset.ErrCode)
+			break
+		}
+	}
+}
+
+func TestHTTP2GoAwayOnMainListener(t *testing.T) {
+	s := assert.New(t)
+	resp, err := newH2CClient().Get(BaseURL + "http2/goaway/0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+
+	s.Equal(http.StatusBadRequest, resp.StatusCode)
+	s.Equal("This endpoint is only available over cleartext HTTP/2 with prior knowledge, on the listener set with --goaway-bind.\n", string(body))
+}
+
+func TestHTTP2LargeHeaders(t *testing.T) {
+	s := assert.New(t)
+	resp, err := newH2CClient().Get(BaseURL + "http2/headers/1000?size=100")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = resp.Body.Close()
+
+	s.Equal(http.StatusOK, resp.StatusCode)
+	s.Equal(strings.Repeat("7", 100), resp.Header.Get("X-Httpbun-Header-997"))
+	count := 0
+	for name := range resp.Header {
+		if strings.HasPrefix(name, "X-Httpbun-Header-") {
+			count++
+		}
+	}
+	s.Equal(1000, count)
+}
+
+func TestHTTP2OverTLS(t *testing.T) {
+	s := assert.New(t)
+	srv := startTLSServer(t, spec.Spec{})
+	defer srv.CloseAndWait()
+
+	resp, data := tlsGet(t, "trailers?Grpc-Status=0", &tls.Config{})
+	s.Equal("HTTP/2.0", resp.Proto)
+	s.Equal("HTTP/2.0", data["protocol"])
+	s.Equal("0", resp.Trailer.Get("Grpc-Status"))
+}
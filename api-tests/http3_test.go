@@ -0,0 +1,96 @@
+package api_tests
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/quic-go/quic-go/http3"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/sharat87/httpbun/server"
+	"github.com/sharat87/httpbun/server/spec"
+)
+
+func TestHTTP3(t *testing.T) {
+	srv := startTLSServer(t, spec.Spec{HTTP3: true})
+	defer srv.CloseAndWait()
+
+	t.Run("alt-svc over tcp", func(t *testing.T) {
+		s := assert.New(t)
+		resp, _ := tlsGet(t, "get", &tls.Config{})
+		s.Equal("HTTP/2.0", resp.Proto)
+		s.Equal(`h3=":30002"; ma=2592000`, resp.Header.Get("Alt-Svc"))
+	})
+
+	t.Run("request over quic", func(t *testing.T) {
+		s := assert.New(t)
+		transport := &http3.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true, ServerName: "localhost"}}
+		defer transport.Close()
+		client := &http.Client{Timeout: 5 * time.Second, Transport: transport}
+
+		resp, err := client.Get("https://" + tlsBindTarget + "/anything?a=1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+
+		var data map[string]any
+		s.NoError(json.NewDecoder(resp.Body).Decode(&data))
+		s.Equal(http.StatusOK, resp.StatusCode)
+		s.Equal("HTTP/3.0", resp.Proto)
+		s.Empty(resp.Header.Get("Alt-Svc"))
+		s.Equal("HTTP/3.0", data["protocol"])
+		s.Equal("https://"+tlsBindTarget+"/anything?a=1", data["url"])
+		s.Equal("h3", data["tls"].(map[string]any)["alpn"])
+
+		// Streaming responses need flushing to work over HTTP/3 too.
+		resp, err = client.Get("https://" + tlsBindTarget + "/drip?duration=0&numbytes=5&delay=0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		s.NoError(err)
+		s.Equal("*****", string(body))
+	})
+}
+
+func TestHTTP3NotAdvertisedWithoutTLS(t *testing.T) {
+	s := assert.New(t)
+	const plainTarget = "127.0.0.1:30011"
+	const tlsTarget = "127.0.0.1:30012"
+
+	srv := server.StartNew(spec.Spec{
+		BindTarget:    plainTarget,
+		TLSBindTarget: tlsTarget,
+		TLSAuto:       true,
+		TLSAutoHosts:  []string{"127.0.0.1"},
+		HTTP3:         true,
+	})
+	defer srv.CloseAndWait()
+
+	client := &http.Client{
+		Timeout:   5 * time.Second,
+		Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}},
+	}
+
+	resp, err := client.Get("https://" + tlsTarget + "/get")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = resp.Body.Close()
+	s.Equal(`h3=":30012"; ma=2592000`, resp.Header.Get("Alt-Svc"))
+
+	// HTTP/3 can't be reached from plain HTTP.
+	resp, err = client.Get("http://" + plainTarget + "/get")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = resp.Body.Close()
+	s.Equal(http.StatusOK, resp.StatusCode)
+	s.Empty(resp.Header.Get("Alt-Svc"))
+}
@@ -0,0 +1,108 @@
+package api_tests
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"net/textproto"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEarlyHints(t *testing.T) {
+	s := assert.New(t)
+
+	var hints []textproto.MIMEHeader
+	trace := &httptrace.ClientTrace{
+		Got1xxResponse: func(code int, header textproto.MIMEHeader) error {
+			s.Equal(http.StatusEarlyHints, code)
+			hints = append(hints, header)
+			return nil
+		},
+	}
+	ctx := httptrace.WithClientTrace(context.Background(), trace)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, BaseURL+"early-hints?count=2&link=%3C%2Fa.js%3E%3B+rel%3Dpreload&link=%3C%2Fb.css%3E%3B+rel%3Dpreload", nil)
+	s.NoError(err)
+	req.Header.Set("Origin", "https://example.com")
+	resp, err := http.DefaultClient.Do(req)
+	s.NoError(err)
+	defer resp.Body.Close()
+
+	s.Equal(http.StatusOK, resp.StatusCode)
+	s.Len(hints, 2)
+	for _, hint := range hints {
+		s.Equal([]string{"</a.js>; rel=preload", "</b.css>; rel=preload"}, hint.Values("Link"))
+		// Only the headers of the interim response itself, and not those meant for the final response.
+		s.Empty(hint.Get("X-Powered-By"))
+		s.Empty(hint.Get("Access-Control-Allow-Origin"))
+	}
+	s.Equal([]string{"</a.js>; rel=preload", "</b.css>; rel=preload"}, resp.Header.Values("Link"))
+}
+
+// sendExpectContinue sends request headers with `Expect: 100-continue`, but not the body, and reads the status line of
+// the first response.
+func sendExpectContinue(t *testing.T, path string) (string, time.Duration) {
+	t.Helper()
+	conn, err := net.Dial("tcp", BindTarget)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+
+	start := time.Now()
+	_, err = conn.Write([]byte("POST " + path + " HTTP/1.1\r\nHost: " + BindTarget + "\r\n" +
+		"Content-Length: 5\r\nExpect: 100-continue\r\n\r\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.TrimSpace(line), time.Since(start)
+}
+
+func TestContinueAccept(t *testing.T) {
+	s := assert.New(t)
+	line, _ := sendExpectContinue(t, "/continue")
+	s.Equal("HTTP/1.1 100 Continue", line)
+}
+
+func TestContinueDelay(t *testing.T) {
+	s := assert.New(t)
+	line, elapsed := sendExpectContinue(t, "/continue/delay/0.5")
+	s.Equal("HTTP/1.1 100 Continue", line)
+	s.GreaterOrEqual(elapsed, 500*time.Millisecond)
+}
+
+func TestContinueReject(t *testing.T) {
+	s := assert.New(t)
+	line, _ := sendExpectContinue(t, "/continue/reject")
+	s.Equal("HTTP/1.1 417 Expectation Failed", line)
+}
+
+func TestContinueFinalWithoutBody(t *testing.T) {
+	s := assert.New(t)
+	line, _ := sendExpectContinue(t, "/continue/final/413")
+	s.Equal("HTTP/1.1 413 Request Entity Too Large", line)
+}
+
+func TestContinueWithClient(t *testing.T) {
+	s := assert.New(t)
+	resp, body := ExecRequest(R{
+		Method:  http.MethodPost,
+		Path:    "continue",
+		Body:    "hello",
+		Headers: map[string][]string{"Expect": {"100-continue"}},
+	})
+	s.Equal(http.StatusOK, resp.StatusCode)
+	s.JSONEq(`{"expect": "100-continue", "continueDelay": 0, "bodyLength": 5}`, body)
+}
@@ -0,0 +1,88 @@
+package api_tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/sharat87/httpbun/c"
+)
+
+func TestJWTMintAndVerify(t *testing.T) {
+	s := assert.New(t)
+
+	resp, body := ExecRequest(R{
+		Method: http.MethodPost,
+		Path:   "jwt/mint?alg=ES256&aud=api&sub=dave",
+		Body:   `{"role": "admin"}`,
+	})
+	s.Equal(http.StatusOK, resp.StatusCode)
+
+	var minted struct {
+		Token  string
+		Header map[string]any
+		Claims map[string]any
+	}
+	s.NoError(json.Unmarshal([]byte(body), &minted))
+	s.Equal("ES256", minted.Header["alg"])
+	s.Equal("admin", minted.Claims["role"])
+	s.Equal("api", minted.Claims["aud"])
+
+	resp, body = ExecRequest(R{
+		Path:    "jwt/verify?aud=api",
+		Headers: map[string][]string{"Authorization": {"Bearer " + minted.Token}},
+	})
+	s.Equal(http.StatusOK, resp.StatusCode)
+	s.Contains(body, `"valid": true`)
+
+	resp, body = ExecRequest(R{Path: "jwt/verify?aud=web&iss=someone&token=" + minted.Token})
+	s.Equal(http.StatusUnauthorized, resp.StatusCode)
+	s.Equal(`Bearer realm="httpbun realm", error="invalid_token", error_description="aud: audience api doesn't include \"web\""`, resp.Header.Get(c.WWWAuthenticate))
+	s.Contains(body, `"check": "aud"`)
+	s.Contains(body, `"check": "iss"`)
+}
+
+func TestJWTExpiredHS256(t *testing.T) {
+	s := assert.New(t)
+
+	_, body := ExecRequest(R{Path: "jwt/mint?alg=HS256&secret=abc&exp=-10"})
+	var minted struct{ Token string }
+	s.NoError(json.Unmarshal([]byte(body), &minted))
+
+	resp, body := ExecRequest(R{Path: "jwt/verify?secret=abc&token=" + minted.Token})
+	s.Equal(http.StatusUnauthorized, resp.StatusCode)
+	s.Contains(body, `"check": "exp"`)
+
+	resp, _ = ExecRequest(R{Path: "jwt/verify?secret=abc&leeway=60&token=" + minted.Token})
+	s.Equal(http.StatusOK, resp.StatusCode)
+}
+
+func TestJWKS(t *testing.T) {
+	s := assert.New(t)
+
+	resp, body := ExecRequest(R{Path: ".well-known/jwks.json"})
+	s.Equal(http.StatusOK, resp.StatusCode)
+	s.Equal("application/jwk-set+json", resp.Header.Get(c.ContentType))
+
+	var jwks struct {
+		Keys []map[string]string
+	}
+	s.NoError(json.Unmarshal([]byte(body), &jwks))
+	var types []string
+	for _, key := range jwks.Keys {
+		types = append(types, key["kty"])
+	}
+	s.Subset(types, []string{"RSA", "EC", "OKP"})
+
+	resp, _ = ExecRequest(R{Path: "jwt/rotate"})
+	s.Equal(http.StatusMethodNotAllowed, resp.StatusCode)
+
+	// Rotations are limited to one a minute.
+	resp, _ = ExecRequest(R{Method: "POST", Path: "jwt/rotate"})
+	s.Equal(http.StatusOK, resp.StatusCode)
+	resp, _ = ExecRequest(R{Method: "POST", Path: "jwt/rotate"})
+	s.Equal(http.StatusTooManyRequests, resp.StatusCode)
+	s.NotEmpty(resp.Header.Get("Retry-After"))
+}
@@ -0,0 +1,95 @@
+package api_tests
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/sharat87/httpbun/server"
+	"github.com/sharat87/httpbun/server/spec"
+)
+
+func TestPlainAndTLSListeners(t *testing.T) {
+	const plainTarget = "127.0.0.1:30007"
+	const tlsTarget = "127.0.0.1:30008"
+	socketPath := filepath.Join(t.TempDir(), "httpbun.sock")
+
+	srv := server.StartNew(spec.Spec{
+		BindTarget:    plainTarget,
+		TLSBindTarget: tlsTarget,
+		UnixSocket:    socketPath,
+		TLSAuto:       true,
+		TLSAutoHosts:  []string{"127.0.0.1"},
+	})
+	defer srv.CloseAndWait()
+
+	client := &http.Client{
+		Timeout: 5 * time.Second,
+		Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+		},
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	unixClient := &http.Client{
+		Timeout: 5 * time.Second,
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				return (&net.Dialer{}).DialContext(ctx, "unix", socketPath)
+			},
+		},
+	}
+
+	getURL := func(t *testing.T, client *http.Client, url string) string {
+		resp, err := client.Get(url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		var data map[string]any
+		if err := json.Unmarshal(body, &data); err != nil {
+			t.Fatal(err)
+		}
+		return data["url"].(string)
+	}
+
+	t.Run("scheme per listener", func(t *testing.T) {
+		s := assert.New(t)
+		s.Equal("http://"+plainTarget+"/anything", getURL(t, client, "http://"+plainTarget+"/anything"))
+		s.Equal("https://"+tlsTarget+"/anything", getURL(t, client, "https://"+tlsTarget+"/anything"))
+		s.Equal("http://httpbun.sock/anything", getURL(t, unixClient, "http://httpbun.sock/anything"))
+	})
+
+	t.Run("absolute redirect per listener", func(t *testing.T) {
+		s := assert.New(t)
+		for _, base := range []string{"http://" + plainTarget, "https://" + tlsTarget} {
+			resp, err := client.Get(base + "/absolute-redirect/2")
+			if s.NoError(err) {
+				_ = resp.Body.Close()
+				s.Equal(http.StatusFound, resp.StatusCode)
+				s.Equal(base+"/absolute-redirect/1", resp.Header.Get("Location"))
+			}
+		}
+	})
+
+	t.Run("redirect across schemes", func(t *testing.T) {
+		s := assert.New(t)
+		resp, err := client.Get("http://" + plainTarget + "/redirect-to?url=https://" + tlsTarget + "/get")
+		if s.NoError(err) {
+			_ = resp.Body.Close()
+			s.Equal(http.StatusFound, resp.StatusCode)
+			s.Equal("https://"+tlsTarget+"/get", resp.Header.Get("Location"))
+		}
+	})
+}
@@ -23,6 +23,9 @@ type R struct {
 	Path    string
 	Body    string
 	Headers map[string][]string
+
+	// Host header to send, instead of the one in BaseURL.
+	Host string
 }
 
 func ExecRequest(r R) (http.Response, string) {
@@ -41,6 +44,9 @@ func ExecRequest(r R) (http.Response, string) {
 	}
 
 	req.Header.Set("User-Agent", "")
+	if r.Host != "" {
+		req.Host = r.Host
+	}
 	for name, values := range r.Headers {
 		req.Header[name] = values
 	}
@@ -47,6 +47,7 @@ func DoMethodTest(t *testing.T, method, path string) {
 			"form": {},
 			"json": null,
 			"method": "`+method+`",
+			"protocol": "HTTP/1.1",
 			"origin": "127.0.0.1",
 			"url": "http://127.0.0.1:30001/`+path+`"
 		}`, body)
@@ -78,6 +79,7 @@ func TestGetNameSherlock(t *testing.T) {
 		"form": {},
 		"json": null,
 		"method": "GET",
+		"protocol": "HTTP/1.1",
 		"origin": "127.0.0.1",
 		"url": "http://127.0.0.1:30001/get?name=Sherlock"
 	}`, body)
@@ -104,6 +106,7 @@ func TestGetFirstSherlockLastHolmes(t *testing.T) {
 		"form": {},
 		"json": null,
 		"method": "GET",
+		"protocol": "HTTP/1.1",
 		"origin": "127.0.0.1",
 		"url": "http://127.0.0.1:30001/get?first=Sherlock&last=Holmes"
 	}`, body)
@@ -131,6 +134,7 @@ func TestGetWithCustomHeader(t *testing.T) {
 		"form": {},
 		"json": null,
 		"method": "GET",
+		"protocol": "HTTP/1.1",
 		"origin": "127.0.0.1",
 		"url": "http://127.0.0.1:30001/get"
 	}`, body)
@@ -160,6 +164,7 @@ func TestGetWithTwoCustomHeader(t *testing.T) {
 		"form": {},
 		"json": null,
 		"method": "GET",
+		"protocol": "HTTP/1.1",
 		"origin": "127.0.0.1",
 		"url": "http://127.0.0.1:30001/get"
 	}`, body)
@@ -190,6 +195,7 @@ func TestGetWithMultipleHeaderValues(t *testing.T) {
 		"form": {},
 		"json": null,
 		"method": "GET",
+		"protocol": "HTTP/1.1",
 		"origin": "127.0.0.1",
 		"url": "http://127.0.0.1:30001/get"
 	}`, body)
@@ -209,6 +215,7 @@ func TestMethodPostWithFormBody(t *testing.T) {
 	s.Equal(c.ApplicationJSON, resp.Header.Get(c.ContentType))
 	s.JSONEq(`{
 		"method": "POST",
+		"protocol": "HTTP/1.1",
 		"args": {},
 		"headers": {
 			"Accept-Encoding": "gzip",
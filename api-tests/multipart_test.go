@@ -0,0 +1,143 @@
+package api_tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/sharat87/httpbun/c"
+)
+
+func TestAnythingMultipartRepeated(t *testing.T) {
+	s := assert.New(t)
+
+	buf := &bytes.Buffer{}
+	writer := multipart.NewWriter(buf)
+	s.NoError(writer.WriteField("tag", "one"))
+	s.NoError(writer.WriteField("tag", "two"))
+	for _, name := range []string{"a.txt", "b.txt"} {
+		fw, err := writer.CreateFormFile("upload", name)
+		s.NoError(err)
+		_, err = fw.Write([]byte("content of " + name))
+		s.NoError(err)
+	}
+	big, err := writer.CreateFormFile("big", "big.txt")
+	s.NoError(err)
+	_, err = big.Write([]byte(strings.Repeat("x", 2000)))
+	s.NoError(err)
+	s.NoError(writer.Close())
+
+	resp, body := ExecRequest(R{
+		Method: http.MethodPost,
+		Path:   "anything",
+		Body:   buf.String(),
+		Headers: map[string][]string{
+			c.ContentType: {writer.FormDataContentType()},
+		},
+	})
+	s.Equal(http.StatusOK, resp.StatusCode)
+
+	var data map[string]any
+	s.NoError(json.Unmarshal([]byte(body), &data))
+
+	s.Equal(map[string]any{"tag": []any{"one", "two"}}, data["form"])
+
+	uploads := data["files"].(map[string]any)["upload"].([]any)
+	s.Len(uploads, 2)
+	s.Equal("a.txt", uploads[0].(map[string]any)["filename"])
+	s.Equal("content of b.txt", uploads[1].(map[string]any)["content"])
+
+	parts := data["parts"].([]any)
+	s.Len(parts, 5)
+	s.Equal(map[string]any{
+		"name":        "tag",
+		"contentType": "",
+		"headers":     map[string]any{"Content-Disposition": `form-data; name="tag"`},
+		"size":        float64(3),
+		"sha256":      "7692c3ad3540bb803c020b3aee66cd8887123234ea0c6e7143c0add73ff431ed",
+		"content":     "one",
+		"truncated":   false,
+	}, parts[0])
+	s.Equal("b.txt", parts[3].(map[string]any)["filename"])
+	s.Equal("application/octet-stream", parts[3].(map[string]any)["contentType"])
+
+	bigPart := parts[4].(map[string]any)
+	s.Equal(float64(2000), bigPart["size"])
+	s.Equal(true, bigPart["truncated"])
+	s.Len(bigPart["content"], 1024)
+}
+
+func TestAnythingMultipartTruncatedText(t *testing.T) {
+	s := assert.New(t)
+
+	buf := &bytes.Buffer{}
+	writer := multipart.NewWriter(buf)
+	// Three-byte characters, so the 1024 byte limit falls in the middle of one.
+	s.NoError(writer.WriteField("text", strings.Repeat("€", 400)))
+	s.NoError(writer.Close())
+
+	resp, body := ExecRequest(R{
+		Method: http.MethodPost,
+		Path:   "anything",
+		Body:   buf.String(),
+		Headers: map[string][]string{
+			c.ContentType: {writer.FormDataContentType()},
+		},
+	})
+	s.Equal(http.StatusOK, resp.StatusCode)
+
+	var data map[string]any
+	s.NoError(json.Unmarshal([]byte(body), &data))
+
+	part := data["parts"].([]any)[0].(map[string]any)
+	s.Equal(float64(1200), part["size"])
+	s.Equal(true, part["truncated"])
+	s.Equal(strings.Repeat("€", 341), part["content"])
+}
+
+func TestAnythingMultipartRelated(t *testing.T) {
+	s := assert.New(t)
+
+	buf := &bytes.Buffer{}
+	writer := multipart.NewWriter(buf)
+	pw, err := writer.CreatePart(textproto.MIMEHeader{
+		c.ContentType: {c.ApplicationJSON},
+		"Content-Id":  {"<root>"},
+	})
+	s.NoError(err)
+	_, err = pw.Write([]byte(`{"a": 1}`))
+	s.NoError(err)
+	pw, err = writer.CreatePart(textproto.MIMEHeader{c.ContentType: {"text/plain"}})
+	s.NoError(err)
+	_, err = pw.Write([]byte("attachment"))
+	s.NoError(err)
+	s.NoError(writer.Close())
+
+	resp, body := ExecRequest(R{
+		Method: http.MethodPost,
+		Path:   "anything",
+		Body:   buf.String(),
+		Headers: map[string][]string{
+			c.ContentType: {"multipart/related; type=\"application/json\"; boundary=" + writer.Boundary()},
+		},
+	})
+	s.Equal(http.StatusOK, resp.StatusCode)
+
+	var data map[string]any
+	s.NoError(json.Unmarshal([]byte(body), &data))
+	s.Equal(map[string]any{}, data["form"])
+	s.Equal(map[string]any{}, data["files"])
+
+	parts := data["parts"].([]any)
+	s.Len(parts, 2)
+	s.Equal(c.ApplicationJSON, parts[0].(map[string]any)["contentType"])
+	s.Equal("<root>", parts[0].(map[string]any)["headers"].(map[string]any)["Content-Id"])
+	s.Equal(`{"a": 1}`, parts[0].(map[string]any)["content"])
+	s.Equal("attachment", parts[1].(map[string]any)["content"])
+}
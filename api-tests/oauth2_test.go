@@ -0,0 +1,326 @@
+package api_tests
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/sharat87/httpbun/c"
+)
+
+var formHeaders = map[string][]string{
+	c.ContentType: {"application/x-www-form-urlencoded"},
+}
+
+func TestOAuth2AuthorizationCodeWithPKCE(t *testing.T) {
+	s := assert.New(t)
+
+	verifier := "this-is-a-code-verifier-that-is-long-enough-for-pkce"
+	sum := sha256.Sum256([]byte(verifier))
+	challenge := base64.RawURLEncoding.EncodeToString(sum[:])
+
+	resp, _ := ExecRequest(R{Path: "oauth2/authorize?response_type=code&client_id=app&redirect_uri=http://example.com/cb&code_challenge=short"})
+	s.Equal(http.StatusBadRequest, resp.StatusCode)
+
+	resp, body := ExecRequest(R{Path: "oauth2/authorize?response_type=code&client_id=app&redirect_uri=http://example.com/cb&code_challenge_method=S256&code_challenge=" + challenge})
+	s.Equal(http.StatusOK, resp.StatusCode)
+	s.Contains(body, challenge)
+
+	resp, _ = ExecRequest(R{
+		Method: http.MethodPost,
+		Path:   "oauth2/authorize",
+		Body: url.Values{
+			"client_id":             {"app"},
+			"redirect_uri":          {"http://example.com/cb"},
+			"scope":                 {"read"},
+			"code_challenge":        {challenge},
+			"code_challenge_method": {"S256"},
+			"email":                 {"dave@example.com"},
+			"decision":              {"approve"},
+		}.Encode(),
+		Headers: formHeaders,
+	})
+	s.Equal(http.StatusFound, resp.StatusCode)
+	location, err := url.Parse(resp.Header.Get("Location"))
+	s.NoError(err)
+	code := location.Query().Get("code")
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"client_id":     {"app"},
+		"redirect_uri":  {"http://example.com/cb"},
+		"code_verifier": {verifier + "x"},
+	}
+
+	resp, body = ExecRequest(R{Method: http.MethodPost, Path: "oauth2/token", Body: form.Encode(), Headers: formHeaders})
+	s.Equal(http.StatusBadRequest, resp.StatusCode)
+	s.Contains(body, `"error": "invalid_grant"`)
+
+	form.Set("code_verifier", verifier)
+	resp, body = ExecRequest(R{Method: http.MethodPost, Path: "oauth2/token", Body: form.Encode(), Headers: formHeaders})
+	s.Equal(http.StatusOK, resp.StatusCode)
+
+	var tokens struct {
+		AccessToken  string `json:"access_token"`
+		RefreshToken string `json:"refresh_token"`
+		Scope        string
+	}
+	s.NoError(json.Unmarshal([]byte(body), &tokens))
+	s.Equal("read", tokens.Scope)
+
+	refresh := url.Values{
+		"grant_type":    {"refresh_token"},
+		"refresh_token": {tokens.RefreshToken},
+		"client_id":     {"app"},
+	}.Encode()
+
+	resp, body = ExecRequest(R{Method: http.MethodPost, Path: "oauth2/token", Body: refresh, Headers: formHeaders})
+	s.Equal(http.StatusOK, resp.StatusCode)
+	s.Contains(body, `"refresh_token"`)
+
+	resp, body = ExecRequest(R{Method: http.MethodPost, Path: "oauth2/token", Body: refresh, Headers: formHeaders})
+	s.Equal(http.StatusBadRequest, resp.StatusCode)
+	s.Contains(body, `"error": "invalid_grant"`)
+}
+
+func TestOAuth2DeviceAuthorization(t *testing.T) {
+	s := assert.New(t)
+
+	resp, body := ExecRequest(R{
+		Method:  http.MethodPost,
+		Path:    "oauth2/device_authorization",
+		Body:    "client_id=tv&scope=watch",
+		Headers: formHeaders,
+	})
+	s.Equal(http.StatusOK, resp.StatusCode)
+
+	var device struct {
+		DeviceCode              string `json:"device_code"`
+		UserCode                string `json:"user_code"`
+		VerificationURI         string `json:"verification_uri"`
+		VerificationURIComplete string `json:"verification_uri_complete"`
+		Interval                int
+	}
+	s.NoError(json.Unmarshal([]byte(body), &device))
+	s.Equal(BaseURL+"oauth2/device", device.VerificationURI)
+	s.Equal(BaseURL+"oauth2/device?user_code="+device.UserCode, device.VerificationURIComplete)
+	s.Equal(5, device.Interval)
+
+	poll := url.Values{
+		"grant_type":  {"urn:ietf:params:oauth:grant-type:device_code"},
+		"device_code": {device.DeviceCode},
+		"client_id":   {"tv"},
+	}.Encode()
+
+	resp, body = ExecRequest(R{Method: http.MethodPost, Path: "oauth2/token", Body: poll, Headers: formHeaders})
+	s.Equal(http.StatusBadRequest, resp.StatusCode)
+	s.Contains(body, `"error": "authorization_pending"`)
+
+	resp, body = ExecRequest(R{Path: "oauth2/device?user_code=" + device.UserCode})
+	s.Equal(http.StatusOK, resp.StatusCode)
+	s.Contains(body, `value="`+device.UserCode+`"`)
+
+	resp, _ = ExecRequest(R{
+		Method:  http.MethodPost,
+		Path:    "oauth2/device",
+		Body:    "user_code=NOPE-NOPE&email=dave@example.com&decision=approve",
+		Headers: formHeaders,
+	})
+	s.Equal(http.StatusBadRequest, resp.StatusCode)
+
+	resp, body = ExecRequest(R{
+		Method:  http.MethodPost,
+		Path:    "oauth2/device",
+		Body:    "user_code=" + device.UserCode + "&email=dave@example.com&decision=approve",
+		Headers: formHeaders,
+	})
+	s.Equal(http.StatusOK, resp.StatusCode)
+	s.Contains(body, "Approved.")
+
+	resp, body = ExecRequest(R{Method: http.MethodPost, Path: "oauth2/token", Body: poll, Headers: formHeaders})
+	s.Equal(http.StatusOK, resp.StatusCode)
+	s.Contains(body, `"access_token"`)
+	s.Contains(body, `"scope": "watch"`)
+}
+
+func TestOpenIDConnect(t *testing.T) {
+	s := assert.New(t)
+
+	resp, body := ExecRequest(R{Path: ".well-known/openid-configuration"})
+	s.Equal(http.StatusOK, resp.StatusCode)
+
+	var config struct {
+		Issuer                string
+		AuthorizationEndpoint string `json:"authorization_endpoint"`
+		JwksURI               string `json:"jwks_uri"`
+		EndSessionEndpoint    string `json:"end_session_endpoint"`
+	}
+	s.NoError(json.Unmarshal([]byte(body), &config))
+	issuer := strings.TrimSuffix(BaseURL, "/")
+	s.Equal(issuer, config.Issuer)
+	s.Equal(BaseURL+"oauth2/authorize", config.AuthorizationEndpoint)
+	s.Equal(BaseURL+".well-known/jwks.json", config.JwksURI)
+	s.Equal(BaseURL+"oauth2/logout", config.EndSessionEndpoint)
+
+	resp, _ = ExecRequest(R{Path: ".well-known/jwks.json"})
+	s.Equal(http.StatusOK, resp.StatusCode)
+	s.Equal("application/jwk-set+json", resp.Header.Get(c.ContentType))
+
+	resp, _ = ExecRequest(R{
+		Method: http.MethodPost,
+		Path:   "oauth2/authorize",
+		Body: url.Values{
+			"client_id":      {"app"},
+			"redirect_uri":   {"http://example.com/cb"},
+			"scope":          {"openid profile"},
+			"nonce":          {"abc123"},
+			"email":          {"dave@example.com"},
+			"name":           {"Dave"},
+			"email_verified": {"true"},
+			"decision":       {"approve"},
+		}.Encode(),
+		Headers: formHeaders,
+	})
+	s.Equal(http.StatusFound, resp.StatusCode)
+	location, err := url.Parse(resp.Header.Get("Location"))
+	s.NoError(err)
+
+	resp, body = ExecRequest(R{
+		Method: http.MethodPost,
+		Path:   "oauth2/token",
+		Body: url.Values{
+			"grant_type":    {"authorization_code"},
+			"code":          {location.Query().Get("code")},
+			"client_id":     {"app"},
+			"client_secret": {"secret"},
+			"redirect_uri":  {"http://example.com/cb"},
+		}.Encode(),
+		Headers: formHeaders,
+	})
+	s.Equal(http.StatusOK, resp.StatusCode)
+
+	var tokens struct {
+		AccessToken string `json:"access_token"`
+		IDToken     string `json:"id_token"`
+	}
+	s.NoError(json.Unmarshal([]byte(body), &tokens))
+
+	resp, body = ExecRequest(R{Path: "jwt/verify?aud=app&iss=" + url.QueryEscape(issuer) + "&token=" + tokens.IDToken})
+	s.Equal(http.StatusOK, resp.StatusCode)
+	s.Contains(body, `"nonce": "abc123"`)
+	s.Contains(body, `"name": "Dave"`)
+
+	resp, body = ExecRequest(R{
+		Path:    "oauth2/userinfo",
+		Headers: map[string][]string{"Authorization": {"Bearer " + tokens.AccessToken}},
+	})
+	s.Equal(http.StatusOK, resp.StatusCode)
+	s.Contains(body, `"name": "Dave"`)
+	s.NotContains(body, `"email"`, "email scope wasn't granted")
+
+	resp, _ = ExecRequest(R{Path: "oauth2/logout?post_logout_redirect_uri=https://example.com/bye&state=s1&id_token_hint=" + tokens.IDToken})
+	s.Equal(http.StatusFound, resp.StatusCode)
+	s.Equal("https://example.com/bye?state=s1", resp.Header.Get("Location"))
+
+	resp, _ = ExecRequest(R{Path: "oauth2/logout?post_logout_redirect_uri=https://example.com/bye"})
+	s.Equal(http.StatusBadRequest, resp.StatusCode)
+
+	// A client_id alone isn't enough to be redirected.
+	resp, _ = ExecRequest(R{Path: "oauth2/logout?post_logout_redirect_uri=https://example.com/bye&client_id=app"})
+	s.Equal(http.StatusBadRequest, resp.StatusCode)
+}
+
+func TestOAuth2IntrospectionAndRevocation(t *testing.T) {
+	s := assert.New(t)
+
+	resp, body := ExecRequest(R{
+		Method:  http.MethodPost,
+		Path:    "oauth2/token",
+		Body:    "grant_type=client_credentials&scope=reports",
+		Headers: map[string][]string{"Authorization": {"Basic YXBwOnNlY3JldA=="}, c.ContentType: {"application/x-www-form-urlencoded"}},
+	})
+	s.Equal(http.StatusOK, resp.StatusCode)
+
+	var tokens struct {
+		AccessToken string `json:"access_token"`
+	}
+	s.NoError(json.Unmarshal([]byte(body), &tokens))
+
+	introspect := url.Values{
+		"token":         {tokens.AccessToken},
+		"client_id":     {"gateway"},
+		"client_secret": {"gateway-secret"},
+	}.Encode()
+
+	resp, body = ExecRequest(R{Method: http.MethodPost, Path: "oauth2/introspect", Body: introspect, Headers: formHeaders})
+	s.Equal(http.StatusOK, resp.StatusCode)
+	s.Contains(body, `"active": true`)
+	s.Contains(body, `"client_id": "app"`)
+	s.Contains(body, `"scope": "reports"`)
+
+	// A forged token, with the payload changed, isn't active.
+	payload, signature, _ := strings.Cut(tokens.AccessToken, ".")
+	forged := strings.Replace(payload, payload[:4], "eyJl", 1) + "." + signature
+	resp, body = ExecRequest(R{Method: http.MethodPost, Path: "oauth2/introspect", Body: "client_id=gateway&client_secret=x&token=" + forged, Headers: formHeaders})
+	s.Equal(http.StatusOK, resp.StatusCode)
+	s.Contains(body, `"active": false`)
+
+	resp, _ = ExecRequest(R{Method: http.MethodPost, Path: "oauth2/revoke", Body: "client_id=app&token=" + tokens.AccessToken, Headers: formHeaders})
+	s.Equal(http.StatusOK, resp.StatusCode)
+
+	resp, body = ExecRequest(R{Method: http.MethodPost, Path: "oauth2/introspect", Body: introspect, Headers: formHeaders})
+	s.Equal(http.StatusOK, resp.StatusCode)
+	s.Equal("{\n  \"active\": false\n}\n", body)
+}
+
+func TestOAuth2UserinfoWithRevokedToken(t *testing.T) {
+	s := assert.New(t)
+
+	resp, _ := ExecRequest(R{
+		Method:  http.MethodPost,
+		Path:    "oauth2/authorize",
+		Body:    "client_id=app&redirect_uri=http://example.com/cb&email=dave@example.com&decision=approve",
+		Headers: formHeaders,
+	})
+	location, err := url.Parse(resp.Header.Get("Location"))
+	s.NoError(err)
+
+	exchange := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {location.Query().Get("code")},
+		"client_id":     {"app"},
+		"client_secret": {"secret"},
+		"redirect_uri":  {"http://example.com/cb"},
+	}.Encode()
+
+	resp, body := ExecRequest(R{Method: http.MethodPost, Path: "oauth2/token", Body: exchange, Headers: formHeaders})
+	s.Equal(http.StatusOK, resp.StatusCode)
+
+	var tokens struct {
+		AccessToken  string `json:"access_token"`
+		RefreshToken string `json:"refresh_token"`
+	}
+	s.NoError(json.Unmarshal([]byte(body), &tokens))
+	userinfo := R{Path: "oauth2/userinfo", Headers: map[string][]string{"Authorization": {"Bearer " + tokens.AccessToken}}}
+
+	resp, body = ExecRequest(userinfo)
+	s.Equal(http.StatusOK, resp.StatusCode)
+	s.Contains(body, `"email": "dave@example.com"`)
+
+	// The code can't be used again.
+	resp, body = ExecRequest(R{Method: http.MethodPost, Path: "oauth2/token", Body: exchange, Headers: formHeaders})
+	s.Equal(http.StatusBadRequest, resp.StatusCode)
+	s.Contains(body, `"error": "invalid_grant"`)
+
+	// And doing that revoked the tokens from its first use.
+	resp, body = ExecRequest(userinfo)
+	s.Equal(http.StatusUnauthorized, resp.StatusCode)
+	s.Contains(body, "Access token has been revoked")
+}
@@ -0,0 +1,159 @@
+package api_tests
+
+import (
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRangeFull(t *testing.T) {
+	s := assert.New(t)
+	// More than the default limit, which the count is capped to.
+	resp, body := ExecRequest(R{Path: "range/5000"})
+	s.Equal(http.StatusOK, resp.StatusCode)
+	s.Equal("bytes", resp.Header.Get("Accept-Ranges"))
+	s.Equal(`"range-1000"`, resp.Header.Get("ETag"))
+	s.Len(body, 1000)
+}
+
+func TestRangeSingle(t *testing.T) {
+	_, full := ExecRequest(R{Path: "range/100"})
+
+	for header, expected := range map[string]struct {
+		contentRange string
+		body         string
+	}{
+		"bytes=10-19":  {"bytes 10-19/100", full[10:20]},
+		"bytes=95-":    {"bytes 95-99/100", full[95:]},
+		"bytes=-3":     {"bytes 97-99/100", full[97:]},
+		"bytes=90-200": {"bytes 90-99/100", full[90:]},
+	} {
+		t.Run(header, func(t *testing.T) {
+			s := assert.New(t)
+			resp, body := ExecRequest(R{
+				Path:    "range/100",
+				Headers: map[string][]string{"Range": {header}},
+			})
+			s.Equal(http.StatusPartialContent, resp.StatusCode)
+			s.Equal(expected.contentRange, resp.Header.Get("Content-Range"))
+			s.Equal(expected.body, body)
+		})
+	}
+}
+
+func TestRangeMultiple(t *testing.T) {
+	s := assert.New(t)
+	_, full := ExecRequest(R{Path: "range/100"})
+
+	resp, body := ExecRequest(R{
+		Path:    "range/100",
+		Headers: map[string][]string{"Range": {"bytes=0-4, -5"}},
+	})
+	s.Equal(http.StatusPartialContent, resp.StatusCode)
+
+	mediaType, params, err := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	s.NoError(err)
+	s.Equal("multipart/byteranges", mediaType)
+
+	reader := multipart.NewReader(strings.NewReader(body), params["boundary"])
+	for _, expected := range []struct {
+		contentRange string
+		body         string
+	}{
+		{"bytes 0-4/100", full[:5]},
+		{"bytes 95-99/100", full[95:]},
+	} {
+		part, err := reader.NextPart()
+		s.NoError(err)
+		s.Equal("application/octet-stream", part.Header.Get("Content-Type"))
+		s.Equal(expected.contentRange, part.Header.Get("Content-Range"))
+		partBody, err := io.ReadAll(part)
+		s.NoError(err)
+		s.Equal(expected.body, string(partBody))
+	}
+	_, err = reader.NextPart()
+	s.Equal(io.EOF, err)
+}
+
+func TestRangeNotSatisfiable(t *testing.T) {
+	s := assert.New(t)
+	resp, body := ExecRequest(R{
+		Path:    "range/100",
+		Headers: map[string][]string{"Range": {"bytes=100-"}},
+	})
+	s.Equal(http.StatusRequestedRangeNotSatisfiable, resp.StatusCode)
+	s.Equal("bytes */100", resp.Header.Get("Content-Range"))
+	s.Equal("", body)
+}
+
+func TestRangeInvalidIgnored(t *testing.T) {
+	s := assert.New(t)
+	resp, body := ExecRequest(R{
+		Path:    "range/100",
+		Headers: map[string][]string{"Range": {"bytes=9-1"}},
+	})
+	s.Equal(http.StatusOK, resp.StatusCode)
+	s.Len(body, 100)
+}
+
+func TestRangeIfRange(t *testing.T) {
+	for ifRange, expectedStatus := range map[string]int{
+		`"range-100"`:                   http.StatusPartialContent,
+		`"range-99"`:                    http.StatusOK,
+		`W/"range-100"`:                 http.StatusOK,
+		"Mon, 01 Jan 2024 00:00:00 GMT": http.StatusPartialContent,
+		"Tue, 02 Jan 2024 00:00:00 GMT": http.StatusOK,
+	} {
+		t.Run(ifRange, func(t *testing.T) {
+			resp, _ := ExecRequest(R{
+				Path: "range/100",
+				Headers: map[string][]string{
+					"Range":    {"bytes=0-9"},
+					"If-Range": {ifRange},
+				},
+			})
+			assert.Equal(t, expectedStatus, resp.StatusCode)
+		})
+	}
+}
+
+func TestBytesSeededRange(t *testing.T) {
+	s := assert.New(t)
+	resp, full := ExecRequest(R{Path: "bytes/80?seed=7"})
+	s.Equal(http.StatusOK, resp.StatusCode)
+	s.Equal("bytes", resp.Header.Get("Accept-Ranges"))
+	s.Len(full, 80)
+
+	resp, body := ExecRequest(R{
+		Path: "bytes/80?seed=7",
+		Headers: map[string][]string{
+			"Range":    {"bytes=30-"},
+			"If-Range": {resp.Header.Get("ETag")},
+		},
+	})
+	s.Equal(http.StatusPartialContent, resp.StatusCode)
+	s.Equal("bytes 30-79/80", resp.Header.Get("Content-Range"))
+	s.Equal(full[30:], body)
+}
+
+func TestBytesUnseededRangeWithIfRange(t *testing.T) {
+	s := assert.New(t)
+	resp, _ := ExecRequest(R{Path: "bytes/80"})
+	s.Empty(resp.Header.Get("Last-Modified"))
+
+	// Random bytes are different every time, so the ETag never matches.
+	resp, body := ExecRequest(R{
+		Path: "bytes/80",
+		Headers: map[string][]string{
+			"Range":    {"bytes=30-"},
+			"If-Range": {resp.Header.Get("ETag")},
+		},
+	})
+	s.Equal(http.StatusOK, resp.StatusCode)
+	s.Len(body, 80)
+}
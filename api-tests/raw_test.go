@@ -0,0 +1,72 @@
+package api_tests
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/sharat87/httpbun/c"
+)
+
+func sendRawRequest(t *testing.T, conn net.Conn, reader *bufio.Reader, raw string) (*http.Response, string) {
+	t.Helper()
+	if _, err := conn.Write([]byte(raw)); err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.ReadResponse(reader, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp, string(body)
+}
+
+func TestRawPreservesHeaderOrderAndCasing(t *testing.T) {
+	s := assert.New(t)
+
+	conn, err := net.Dial("tcp", BindTarget)
+	s.NoError(err)
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+
+	request := "POST /raw HTTP/1.1\r\n" +
+		"host: " + BindTarget + "\r\n" +
+		"x-lower: one\r\n" +
+		"X-UPPER: two\r\n" +
+		"x-lower: three\r\n" +
+		"Transfer-Encoding: chunked\r\n" +
+		"\r\n" +
+		"5;ext=1\r\nhello\r\n0\r\n\r\n"
+
+	resp, body := sendRawRequest(t, conn, reader, request)
+	s.Equal(http.StatusOK, resp.StatusCode)
+
+	var data map[string]any
+	s.NoError(json.Unmarshal([]byte(body), &data))
+	s.Equal(request, data["raw"])
+	s.Equal("POST /raw HTTP/1.1", data["requestLine"])
+	s.Equal([]any{
+		map[string]any{"name": "host", "value": BindTarget},
+		map[string]any{"name": "x-lower", "value": "one"},
+		map[string]any{"name": "X-UPPER", "value": "two"},
+		map[string]any{"name": "x-lower", "value": "three"},
+		map[string]any{"name": "Transfer-Encoding", "value": "chunked"},
+	}, data["headers"])
+	s.Equal("5;ext=1\r\nhello\r\n0\r\n\r\n", data["body"])
+	s.Equal(false, data["truncated"])
+
+	// A second request on the same connection gets a recording of its own.
+	request = "GET /raw.txt HTTP/1.1\r\nHost: " + BindTarget + "\r\n\r\n"
+	resp, body = sendRawRequest(t, conn, reader, request)
+	s.Equal(http.StatusOK, resp.StatusCode)
+	s.Equal(c.TextPlain, resp.Header.Get(c.ContentType))
+	s.Equal(request, body)
+}
@@ -116,7 +116,21 @@ func TestRedirectAbsolute4(t *testing.T) {
 		Path: "absolute-redirect/4",
 	})
 	s.Equal(http.StatusFound, resp.StatusCode)
-	s.Equal("/absolute-redirect/3", resp.Header.Get(c.Location))
+	s.Equal(BaseURL+"absolute-redirect/3", resp.Header.Get(c.Location))
+}
+
+func TestRedirectAbsoluteWithOtherHost(t *testing.T) {
+	s := assert.New(t)
+
+	// The server is bound to 127.0.0.1, but may be reached by other names, like through a proxy.
+	for _, host := range []string{"localhost:30001", "httpbun.internal"} {
+		resp, body := ExecRequest(R{
+			Path: "absolute-redirect/2",
+			Host: host,
+		})
+		s.Equal(http.StatusFound, resp.StatusCode, body)
+		s.Equal("http://"+host+"/absolute-redirect/1", resp.Header.Get(c.Location))
+	}
 }
 
 func TestRedirectAbsolute1(t *testing.T) {
@@ -125,5 +139,5 @@ func TestRedirectAbsolute1(t *testing.T) {
 		Path: "absolute-redirect/1",
 	})
 	s.Equal(http.StatusFound, resp.StatusCode)
-	s.Equal("/anything", resp.Header.Get(c.Location))
+	s.Equal(BaseURL+"anything", resp.Header.Get(c.Location))
 }
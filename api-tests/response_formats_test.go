@@ -0,0 +1,103 @@
+package api_tests
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/sharat87/httpbun/c"
+)
+
+func TestHeadersAsYAML(t *testing.T) {
+	s := assert.New(t)
+	resp, body := ExecRequest(R{
+		Path: "headers",
+		Headers: map[string][]string{
+			"Accept": {"application/yaml"},
+			"X-One":  {"custom header value"},
+		},
+	})
+	s.Equal(http.StatusOK, resp.StatusCode)
+	s.Equal("application/yaml", resp.Header.Get(c.ContentType))
+	s.Equal("Accept", resp.Header.Get("Vary"))
+	s.Equal(`headers:
+    Accept: application/yaml
+    Accept-Encoding: gzip
+    X-One: custom header value
+`, body)
+}
+
+func TestIpAsXML(t *testing.T) {
+	s := assert.New(t)
+	resp, body := ExecRequest(R{
+		Path: "ip",
+		Headers: map[string][]string{
+			"Accept": {"text/html;q=0.5, application/xml"},
+		},
+	})
+	s.Equal(http.StatusOK, resp.StatusCode)
+	s.Equal("application/xml", resp.Header.Get(c.ContentType))
+	s.Equal(`<?xml version="1.0" encoding="UTF-8"?>`+"\n<response><origin>127.0.0.1</origin></response>\n", body)
+}
+
+func TestAnythingAsTextWithFormatParam(t *testing.T) {
+	s := assert.New(t)
+	resp, body := ExecRequest(R{
+		Path: "anything?format=text",
+		Headers: map[string][]string{
+			"Accept": {"application/json"},
+		},
+	})
+	s.Equal(http.StatusOK, resp.StatusCode)
+	s.Equal(c.TextPlain, resp.Header.Get(c.ContentType))
+	s.Equal(`args.format: "text"
+data: ""
+files: {}
+form: {}
+headers.Accept: "application/json"
+headers.Accept-Encoding: "gzip"
+json: null
+method: "GET"
+origin: "127.0.0.1"
+protocol: "HTTP/1.1"
+url: "http://127.0.0.1:30001/anything?format=text"
+`, body)
+}
+
+func TestCookiesAsHTML(t *testing.T) {
+	s := assert.New(t)
+	resp, body := ExecRequest(R{
+		Path: "cookies",
+		Headers: map[string][]string{
+			"Accept": {"text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8"},
+			"Cookie": {"name=<b>"},
+		},
+	})
+	s.Equal(http.StatusOK, resp.StatusCode)
+	s.Equal(c.TextHTML, resp.Header.Get(c.ContentType))
+	s.Contains(body, "<tr><th>name<td><pre>&lt;b&gt;</pre>")
+}
+
+func TestUnknownFormatFallsBackToJSON(t *testing.T) {
+	s := assert.New(t)
+	resp, body := ExecRequest(R{
+		Path: "ip?format=toml",
+		Headers: map[string][]string{
+			"Accept": {"image/png"},
+		},
+	})
+	s.Equal(http.StatusOK, resp.StatusCode)
+	s.Equal(c.ApplicationJSON, resp.Header.Get(c.ContentType))
+	s.JSONEq(`{"origin": "127.0.0.1"}`, body)
+}
+
+func TestVaryAcceptWithoutAcceptHeader(t *testing.T) {
+	s := assert.New(t)
+	resp, _ := ExecRequest(R{
+		Path: "ip",
+	})
+	s.Equal(http.StatusOK, resp.StatusCode)
+	s.Equal(c.ApplicationJSON, resp.Header.Get(c.ContentType))
+	s.Contains(resp.Header.Values("Vary"), "Accept")
+}
@@ -0,0 +1,320 @@
+package api_tests
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/sharat87/httpbun/server"
+	"github.com/sharat87/httpbun/server/spec"
+)
+
+const tlsBindTarget = "127.0.0.1:30002"
+
+type testCert struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+// newTestCert creates a certificate from the template, signed by the parent, or self-signed if parent is nil.
+func newTestCert(t *testing.T, template *x509.Certificate, parent *testCert) testCert {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if template.NotBefore.IsZero() {
+		template.NotBefore = time.Now().Add(-time.Hour)
+		template.NotAfter = time.Now().Add(time.Hour)
+	}
+
+	signerCert, signerKey := template, key
+	if parent != nil {
+		signerCert, signerKey = parent.cert, parent.key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, signerCert, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return testCert{cert, key}
+}
+
+func (tc testCert) writePEMFiles(t *testing.T) (string, string) {
+	t.Helper()
+
+	keyDER, err := x509.MarshalECPrivateKey(tc.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: tc.cert.Raw}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	return certFile, keyFile
+}
+
+// clientConfig presents this certificate, even when the server asks for certificates from other CAs.
+func (tc testCert) clientConfig() *tls.Config {
+	return &tls.Config{
+		GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			return &tls.Certificate{Certificate: [][]byte{tc.cert.Raw}, PrivateKey: tc.key}, nil
+		},
+	}
+}
+
+// startTLSServer starts a server with a freshly generated self-signed certificate, for `localhost`.
+func startTLSServer(t *testing.T, serverSpec spec.Spec) server.Server {
+	t.Helper()
+
+	serverCert := newTestCert(t, &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}, nil)
+	certFile, keyFile := serverCert.writePEMFiles(t)
+
+	t.Setenv("HTTPBUN_TLS_CERT", certFile)
+	t.Setenv("HTTPBUN_TLS_KEY", keyFile)
+
+	serverSpec.BindTarget = tlsBindTarget
+	return server.StartNew(serverSpec)
+}
+
+func tlsGet(t *testing.T, path string, config *tls.Config) (*http.Response, map[string]any) {
+	t.Helper()
+
+	config.InsecureSkipVerify = true
+	config.ServerName = "localhost"
+	client := &http.Client{
+		Timeout: 5 * time.Second,
+		Transport: &http.Transport{
+			TLSClientConfig:   config,
+			ForceAttemptHTTP2: true,
+		},
+	}
+
+	resp, err := client.Get("https://" + tlsBindTarget + "/" + path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var data map[string]any
+	if err := json.Unmarshal(body, &data); err != nil {
+		t.Fatal(err)
+	}
+
+	return resp, data
+}
+
+func TestTLSDetails(t *testing.T) {
+	s := assert.New(t)
+	srv := startTLSServer(t, spec.Spec{})
+	defer srv.CloseAndWait()
+
+	resp, data := tlsGet(t, "anything", &tls.Config{MinVersion: tls.VersionTLS13})
+	s.Equal("HTTP/2.0", data["protocol"])
+	s.Equal("https://"+tlsBindTarget+"/anything", data["url"])
+	s.Equal(map[string]any{
+		"version":            "TLS 1.3",
+		"cipherSuite":        tls.CipherSuiteName(resp.TLS.CipherSuite),
+		"serverName":         "localhost",
+		"alpn":               "h2",
+		"resumed":            false,
+		"clientCertificates": []any{},
+	}, data["tls"])
+}
+
+func TestTLSOnPlainConnection(t *testing.T) {
+	s := assert.New(t)
+	resp, body := ExecRequest(R{Path: "tls"})
+	s.Equal(http.StatusOK, resp.StatusCode)
+	s.JSONEq(`{"protocol": "HTTP/1.1", "tls": null}`, body)
+}
+
+func TestClientCert(t *testing.T) {
+	ca := newTestCert(t, &x509.Certificate{
+		SerialNumber:          big.NewInt(10),
+		Subject:               pkix.Name{CommonName: "Test Client CA"},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}, nil)
+	caFile, _ := ca.writePEMFiles(t)
+
+	client := newTestCert(t, &x509.Certificate{
+		SerialNumber:   big.NewInt(11),
+		Subject:        pkix.Name{CommonName: "client-one"},
+		EmailAddresses: []string{"one@example.com"},
+		ExtKeyUsage:    []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}, &ca)
+
+	stranger := newTestCert(t, &x509.Certificate{
+		SerialNumber: big.NewInt(12),
+		Subject:      pkix.Name{CommonName: "stranger"},
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}, nil)
+
+	srv := startTLSServer(t, spec.Spec{TLSClientAuth: "request", TLSClientCA: caFile})
+	defer srv.CloseAndWait()
+
+	t.Run("valid certificate", func(t *testing.T) {
+		s := assert.New(t)
+		config := client.clientConfig()
+
+		resp, data := tlsGet(t, "client-cert", config)
+		s.Equal(http.StatusOK, resp.StatusCode)
+		s.Equal(true, data["presented"])
+		s.Equal(true, data["verified"])
+		chain := data["chain"].([]any)
+		s.Len(chain, 1)
+		s.Equal("CN=client-one", chain[0].(map[string]any)["subject"])
+		s.Equal("CN=Test Client CA", chain[0].(map[string]any)["issuer"])
+		s.Equal("b", chain[0].(map[string]any)["serialNumber"])
+		s.Equal([]any{"one@example.com"}, chain[0].(map[string]any)["emailAddresses"])
+		s.Len(data["verifiedChain"], 2)
+
+		resp, data = tlsGet(t, "client-cert/verify", config)
+		s.Equal(http.StatusOK, resp.StatusCode)
+		s.Equal(true, data["authenticated"])
+		s.Equal("CN=client-one", data["subject"])
+	})
+
+	t.Run("untrusted certificate", func(t *testing.T) {
+		s := assert.New(t)
+		config := stranger.clientConfig()
+
+		resp, data := tlsGet(t, "client-cert", config)
+		s.Equal(http.StatusOK, resp.StatusCode)
+		s.Equal(true, data["presented"])
+		s.Equal(false, data["verified"])
+		s.Contains(data["error"], "certificate signed by unknown authority")
+
+		resp, data = tlsGet(t, "client-cert/verify", config)
+		s.Equal(http.StatusForbidden, resp.StatusCode)
+		s.Equal(false, data["authenticated"])
+	})
+
+	t.Run("no certificate", func(t *testing.T) {
+		s := assert.New(t)
+
+		resp, data := tlsGet(t, "client-cert/verify", &tls.Config{})
+		s.Equal(http.StatusForbidden, resp.StatusCode)
+		s.Equal("no client certificate presented", data["error"])
+	})
+}
+
+func TestTLSAuto(t *testing.T) {
+	invalidBindTargets := map[string]string{
+		"expired":       "127.0.0.1:30003",
+		"not-yet-valid": "127.0.0.1:30004",
+		"wrong-host":    "127.0.0.1:30005",
+		"self-signed":   "127.0.0.1:30006",
+	}
+
+	srv := server.StartNew(spec.Spec{
+		BindTarget:     tlsBindTarget,
+		TLSAuto:        true,
+		TLSAutoHosts:   []string{"localhost", "127.0.0.1"},
+		TLSAutoInvalid: invalidBindTargets,
+	})
+	defer srv.CloseAndWait()
+
+	insecureClient := &http.Client{
+		Timeout:   5 * time.Second,
+		Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}},
+	}
+	resp, err := insecureClient.Get("https://" + tlsBindTarget + "/tls/ca.pem")
+	if err != nil {
+		t.Fatal(err)
+	}
+	caPEM, err := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, "application/x-pem-file", resp.Header.Get("Content-Type"))
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM(caPEM) {
+		t.Fatalf("No certificates in CA response %q", caPEM)
+	}
+
+	client := &http.Client{
+		Timeout:   5 * time.Second,
+		Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots}},
+	}
+
+	t.Run("valid certificate", func(t *testing.T) {
+		resp, err := client.Get("https://" + tlsBindTarget + "/get")
+		if assert.NoError(t, err) {
+			_ = resp.Body.Close()
+			assert.Equal(t, http.StatusOK, resp.StatusCode)
+		}
+	})
+
+	expectedErrors := map[string]string{
+		"expired":       "certificate has expired",
+		"not-yet-valid": "is not yet valid",
+		"wrong-host":    "cannot validate certificate for 127.0.0.1",
+		"self-signed":   "certificate signed by unknown authority",
+	}
+
+	for kind, bindTarget := range invalidBindTargets {
+		t.Run(kind, func(t *testing.T) {
+			_, err := client.Get("https://" + bindTarget + "/get")
+			if assert.Error(t, err) {
+				assert.Contains(t, err.Error(), expectedErrors[kind])
+			}
+
+			resp, err := insecureClient.Get("https://" + bindTarget + "/get")
+			if assert.NoError(t, err) {
+				_ = resp.Body.Close()
+				assert.Equal(t, http.StatusOK, resp.StatusCode)
+			}
+		})
+	}
+}
+
+func TestTLSCAWithoutAuto(t *testing.T) {
+	s := assert.New(t)
+	resp, _ := ExecRequest(R{Path: "tls/ca.pem"})
+	s.Equal(http.StatusNotFound, resp.StatusCode)
+}
@@ -2,6 +2,7 @@ package c
 
 const ContentType = "Content-Type"
 const ContentLength = "Content-Length"
+const ContentEncoding = "Content-Encoding"
 const Location = "Location"
 const WWWAuthenticate = "Www-Authenticate"
 
@@ -0,0 +1,124 @@
+package ex
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/sharat87/httpbun/c"
+	"github.com/sharat87/httpbun/response"
+)
+
+// writeChunks sends the response body as the given chunks. Each chunk is a separate flushed write, which `net/http`
+// sends as a single chunk in HTTP/1.1. Chunk extensions aren't supported by `net/http` though, so for those, the
+// connection is hijacked, and the chunked encoding is written by hand. The connection is then closed after the
+// response, since it's no longer managed by `net/http`. HTTP/1.0 has no chunked encoding, so there, `net/http` sends
+// the body as is, and closes the connection to end it, without the extensions or trailers.
+func (ex Exchange) writeChunks(resp response.Response, status int) {
+	if ex.Request.ProtoMajor == 1 && ex.Request.ProtoMinor >= 1 && hasExtensions(resp.Chunks) {
+		conn, rw, err := http.NewResponseController(ex.responseWriter).Hijack()
+		if err == nil {
+			defer func() {
+				_ = conn.Close()
+			}()
+			if err := ex.writeRawChunks(rw.Writer, resp, status); err != nil {
+				log.Printf("Error writing chunked response: %v\n", err)
+			}
+			return
+		}
+		log.Printf("Error hijacking connection for chunked response, falling back to flushed writes: %v\n", err)
+	}
+
+	ex.responseWriter.Header().Del(c.ContentLength)
+	ex.responseWriter.WriteHeader(status)
+	if ex.Request.Method == http.MethodHead {
+		return
+	}
+
+	rc := http.NewResponseController(ex.responseWriter)
+	for _, chunk := range resp.Chunks {
+		time.Sleep(chunk.Delay)
+		if _, err := ex.responseWriter.Write(chunk.Data); err != nil {
+			log.Printf("Error writing chunk: %v\n", err)
+			return
+		}
+		if err := rc.Flush(); err != nil {
+			log.Printf("Error flushing chunk: %v\n", err)
+			return
+		}
+	}
+}
+
+func hasExtensions(chunks []response.Chunk) bool {
+	for _, chunk := range chunks {
+		if chunk.Extension != "" {
+			return true
+		}
+	}
+	return false
+}
+
+func (ex Exchange) writeRawChunks(w *bufio.Writer, resp response.Response, status int) error {
+	header := ex.responseWriter.Header().Clone()
+	header.Del(c.ContentLength)
+	header.Set("Transfer-Encoding", "chunked")
+	header.Set("Connection", "close")
+	if _, isSet := header["Date"]; !isSet {
+		header.Set("Date", time.Now().UTC().Format(http.TimeFormat))
+	}
+
+	if _, err := fmt.Fprintf(w, "HTTP/1.1 %d %s\r\n", status, http.StatusText(status)); err != nil {
+		return err
+	}
+	if err := header.Write(w); err != nil {
+		return err
+	}
+	if _, err := w.WriteString("\r\n"); err != nil {
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	if ex.Request.Method == http.MethodHead {
+		return nil
+	}
+
+	for _, chunk := range resp.Chunks {
+		time.Sleep(chunk.Delay)
+		if _, err := fmt.Fprintf(w, "%x", len(chunk.Data)); err != nil {
+			return err
+		}
+		if chunk.Extension != "" {
+			if _, err := w.WriteString(";" + chunk.Extension); err != nil {
+				return err
+			}
+		}
+		if _, err := w.WriteString("\r\n"); err != nil {
+			return err
+		}
+		if _, err := w.Write(chunk.Data); err != nil {
+			return err
+		}
+		if _, err := w.WriteString("\r\n"); err != nil {
+			return err
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+	}
+
+	// The last chunk, followed by the trailer fields that have values. Declared names without values are left out.
+	if _, err := w.WriteString("0\r\n"); err != nil {
+		return err
+	}
+	if err := resp.Trailer.Write(w); err != nil {
+		return err
+	}
+	if _, err := w.WriteString("\r\n"); err != nil {
+		return err
+	}
+	return w.Flush()
+}
@@ -1,6 +1,7 @@
 package ex
 
 import (
+	"bytes"
 	"fmt"
 	"io"
 	"log"
@@ -10,9 +11,12 @@ import (
 	"net/url"
 	"os"
 	"regexp"
+	"slices"
 	"strconv"
 	"strings"
+	"time"
 
+	"github.com/sharat87/httpbun/c"
 	"github.com/sharat87/httpbun/response"
 	"github.com/sharat87/httpbun/server/spec"
 	"github.com/sharat87/httpbun/util"
@@ -20,6 +24,9 @@ import (
 
 const allowedRedirectDomainsEnvVar = "HTTPBUN_ALLOWED_REDIRECT_DOMAINS"
 
+// Maximum number of bytes read from a request body. For encoded bodies, this applies to the decoded content as well.
+const bodySizeLimit = 10000
+
 type Exchange struct {
 	Request        *http.Request
 	responseWriter http.ResponseWriter
@@ -28,6 +35,7 @@ type Exchange struct {
 	RoutedPath     string
 	ServerSpec     spec.Spec
 	bodyBytes      []byte
+	decodedBody    []byte
 }
 
 type HandlerFn func(ex *Exchange) response.Response
@@ -55,7 +63,7 @@ func New(w http.ResponseWriter, req *http.Request, serverSpec spec.Spec) *Exchan
 		Request:        req,
 		responseWriter: w,
 		fields:         map[string]string{},
-		cappedBody:     io.LimitReader(req.Body, 10000),
+		cappedBody:     io.LimitReader(req.Body, bodySizeLimit),
 		RoutedPath:     strings.TrimPrefix(req.URL.EscapedPath(), serverSpec.PathPrefix),
 		ServerSpec:     serverSpec,
 	}
@@ -186,8 +194,7 @@ func (ex Exchange) FindScheme() string {
 		return forwardedProto
 	}
 
-	// todo: this should use the current server's spec, not the global env var to decide if TLS is enabled
-	if os.Getenv("HTTPBUN_TLS_CERT") != "" {
+	if ex.Request.TLS != nil {
 		return "https"
 	}
 
@@ -202,13 +209,18 @@ func (ex Exchange) FullUrl() string {
 	return ex.FindScheme() + ":" + ex.Request.URL.String()
 }
 
+// AbsoluteUrl makes a URL to the given path on this server, with the scheme and host the request came in with.
+func (ex Exchange) AbsoluteUrl(path string) string {
+	return ex.FindScheme() + "://" + ex.Request.Host + ex.ServerSpec.PathPrefix + path
+}
+
 // FindIncomingIPAddress Find the IP address of the client that made this Exchange.
 func (ex Exchange) FindIncomingIPAddress() string {
 	// Compare with <http://httpbin.org/ip> or <http://checkip.amazonaws.com/> or <http://getmyip.co.in/>.
 	ipStr := ex.HeaderValueLast("X-Httpbun-Forwarded-For")
 
-	// If that's also not available, get it directly from the connection.
-	if ipStr == "" {
+	// If that's also not available, get it directly from the connection. Connections on Unix sockets don't have one.
+	if ipStr == "" && ex.Request.RemoteAddr != "" && ex.Request.RemoteAddr != "@" {
 		if ip, _, err := net.SplitHostPort(ex.Request.RemoteAddr); err != nil {
 			log.Printf("Unable to read IP from address %q.", ex.Request.RemoteAddr)
 		} else if userIP := net.ParseIP(ip); userIP != nil {
@@ -239,6 +251,55 @@ func (ex *Exchange) BodyString() string {
 	return string(ex.BodyBytes())
 }
 
+// BodyEncodings returns the content codings applied to the request body, in the order they were applied.
+func (ex Exchange) BodyEncodings() []string {
+	var encodings []string
+	for _, value := range ex.Request.Header.Values(c.ContentEncoding) {
+		for _, encoding := range strings.Split(value, ",") {
+			encoding = strings.ToLower(strings.TrimSpace(encoding))
+			if encoding != "" && encoding != "identity" {
+				encodings = append(encodings, encoding)
+			}
+		}
+	}
+	return encodings
+}
+
+// DecodedBodyBytes is like BodyBytes, but undoes any content codings applied to the request body. The size limit on
+// the request body applies to the decoded content too, so a small compressed body can't expand into a huge one.
+func (ex *Exchange) DecodedBodyBytes() ([]byte, error) {
+	encodings := ex.BodyEncodings()
+	if len(encodings) == 0 {
+		return ex.BodyBytes(), nil
+	}
+
+	if ex.decodedBody != nil {
+		return ex.decodedBody, nil
+	}
+
+	var reader io.Reader = bytes.NewReader(ex.BodyBytes())
+	for _, encoding := range slices.Backward(encodings) {
+		decoder, err := util.NewDecodingReader(reader, encoding)
+		if err != nil {
+			return nil, fmt.Errorf("error decoding request body: %v", err)
+		}
+		defer decoder.Close()
+		reader = decoder
+	}
+
+	decoded, err := io.ReadAll(io.LimitReader(reader, bodySizeLimit+1))
+	if err != nil {
+		return nil, fmt.Errorf("error decoding request body: %v", err)
+	}
+
+	if len(decoded) > bodySizeLimit {
+		return nil, fmt.Errorf("decoded request body is larger than %d bytes", bodySizeLimit)
+	}
+
+	ex.decodedBody = decoded
+	return decoded, nil
+}
+
 func (ex Exchange) Finish(resp response.Response) {
 	if resp.Body != nil && resp.Writer != nil {
 		ex.Finish(response.Response{
@@ -248,6 +309,14 @@ func (ex Exchange) Finish(resp response.Response) {
 		return
 	}
 
+	if resp.Chunks != nil && (resp.Body != nil || resp.Writer != nil) {
+		ex.Finish(response.Response{
+			Status: http.StatusInternalServerError,
+			Body:   "Chunks can't be set along with Body or Writer in response. This isn't supported.",
+		})
+		return
+	}
+
 	status := resp.Status
 	if status == 0 {
 		status = http.StatusOK
@@ -255,7 +324,7 @@ func (ex Exchange) Finish(resp response.Response) {
 
 	if locationHeaders := resp.Header.Values("Location"); len(locationHeaders) > 0 {
 		for _, location := range locationHeaders {
-			if !isAllowedLocationHeader(location) {
+			if !isAllowedLocationHeader(location) && !ex.isOwnOriginLocation(location) && !ex.isListenerLocation(location) {
 				ex.Finish(response.Response{
 					Status: http.StatusForbidden,
 					Body:   "Forbidden redirect URL. Please be careful with this link.",
@@ -265,14 +334,56 @@ func (ex Exchange) Finish(resp response.Response) {
 		}
 	}
 
+	for _, interim := range resp.Interim {
+		ex.writeInterim(interim)
+	}
+
 	maps.Copy(ex.responseWriter.Header(), resp.Header)
 
 	for _, cookie := range resp.Cookies {
 		ex.responseWriter.Header().Add("Set-Cookie", cookie.String())
 	}
 
+	for name := range resp.Trailer {
+		ex.responseWriter.Header().Add("Trailer", name)
+	}
+	defer ex.writeTrailer(resp.Trailer)
+
+	if resp.Chunks != nil {
+		// Chunk boundaries would be lost with compression, so chunks are always sent as is.
+		ex.writeChunks(resp, status)
+		return
+	}
+
+	encoding := ex.findResponseEncoding(resp, status)
+	if encoding != "" {
+		// A `Content-Encoding` header already in the response is left as is, even if it's an empty list. This is what
+		// allows endpoints to send a body whose encoding doesn't match its label.
+		if _, isSet := resp.Header[c.ContentEncoding]; !isSet {
+			ex.responseWriter.Header().Set(c.ContentEncoding, encoding)
+		}
+	}
+
 	if resp.Writer != nil {
-		resp.Writer(response.NewBodyWriter(ex.responseWriter))
+		if encoding == "" {
+			resp.Writer(response.NewBodyWriter(ex.responseWriter))
+			return
+		}
+
+		enc, err := util.NewEncodingWriter(ex.responseWriter, encoding)
+		if err != nil {
+			log.Printf("Error creating encoder for streaming response: %v\n", err)
+			if _, isSet := resp.Header[c.ContentEncoding]; !isSet {
+				ex.responseWriter.Header().Del(c.ContentEncoding)
+			}
+			resp.Writer(response.NewBodyWriter(ex.responseWriter))
+			return
+		}
+		ex.responseWriter.Header().Del(c.ContentLength)
+		resp.Writer(response.NewEncodedBodyWriter(ex.responseWriter, enc))
+		if err := enc.Close(); err != nil {
+			log.Printf("Error closing encoder for streaming response: %v\n", err)
+		}
 		return
 	}
 
@@ -285,12 +396,33 @@ func (ex Exchange) Finish(resp response.Response) {
 	case string:
 		body = []byte(resp.Body.(string))
 	default:
-		ex.responseWriter.Header().Set("Content-Type", "application/json")
-		body = util.ToJsonMust(resp.Body)
+		format := ex.findResponseFormat()
+		var err error
+		if body, err = format.Marshal(resp.Body); err != nil {
+			log.Printf("Error formatting response body as %s: %v\n", format.Name, err)
+			format = util.Formats[0]
+			body, _ = format.Marshal(resp.Body)
+		}
+		ex.responseWriter.Header().Set(c.ContentType, format.ContentType)
+	}
+
+	if encoding != "" {
+		if encoded, err := util.Encode(body, encoding); err != nil {
+			// Send the body as is, instead of an empty body labelled as encoded.
+			log.Printf("Error encoding response body with %q: %v\n", encoding, err)
+			if _, isSet := resp.Header[c.ContentEncoding]; !isSet {
+				ex.responseWriter.Header().Del(c.ContentEncoding)
+			}
+		} else {
+			body = encoded
+		}
 	}
 
 	// Set `Content-Length` header, to disable chunked transfer. See https://github.com/sharat87/httpbun/issues/13
-	ex.responseWriter.Header().Set("Content-Length", fmt.Sprint(len(body)))
+	// Except when there's trailers, since they need chunked transfer in HTTP/1.1.
+	if len(resp.Trailer) == 0 {
+		ex.responseWriter.Header().Set("Content-Length", fmt.Sprint(len(body)))
+	}
 
 	ex.responseWriter.WriteHeader(status)
 
@@ -300,6 +432,69 @@ func (ex Exchange) Finish(resp response.Response) {
 	}
 }
 
+// writeInterim sends an informational response. The `net/http` server sends all the headers set on the writer so far,
+// like `X-Powered-By`, so those are taken off for the duration of this response, leaving only its own headers.
+func (ex Exchange) writeInterim(interim response.Interim) {
+	header := ex.responseWriter.Header()
+	saved := header.Clone()
+	clear(header)
+	maps.Copy(header, interim.Header)
+	ex.responseWriter.WriteHeader(interim.Status)
+	clear(header)
+	maps.Copy(header, saved)
+	time.Sleep(interim.Delay)
+}
+
+// writeTrailer sets the trailer values after the body is written, which is how `net/http` sends them as trailers.
+func (ex Exchange) writeTrailer(trailer http.Header) {
+	for name, values := range trailer {
+		for _, value := range values {
+			ex.responseWriter.Header().Add(name, value)
+		}
+	}
+}
+
+// findResponseFormat decides the format to serialize structured response bodies in. An explicit `format` query param
+// takes precedence over the `Accept` header.
+func (ex Exchange) findResponseFormat() util.Format {
+	if format, ok := util.FindFormat(ex.Request.URL.Query().Get("format")); ok {
+		return format
+	}
+
+	// The format depends on `Accept` even when it's absent, so caches mustn't serve this response for other values.
+	ex.responseWriter.Header().Add("Vary", "Accept")
+
+	accept := strings.Join(ex.Request.Header.Values("Accept"), ",")
+	if accept == "" {
+		return util.Formats[0]
+	}
+
+	return util.NegotiateFormat(accept)
+}
+
+// findResponseEncoding decides the content coding to compress the response body with, if any.
+func (ex Exchange) findResponseEncoding(resp response.Response, status int) string {
+	if resp.NoEncoding {
+		return ""
+	}
+
+	if resp.ContentEncoding != "" {
+		return resp.ContentEncoding
+	}
+
+	if !ex.ServerSpec.NegotiateEncoding || status == http.StatusNoContent || status == http.StatusNotModified {
+		return ""
+	}
+
+	if _, isSet := resp.Header[c.ContentEncoding]; isSet {
+		// Response is already encoded, or is deliberately claiming to be.
+		return ""
+	}
+
+	ex.responseWriter.Header().Add("Vary", "Accept-Encoding")
+	return util.NegotiateEncoding(strings.Join(ex.Request.Header.Values("Accept-Encoding"), ","))
+}
+
 func isAllowedLocationHeader(location string) bool {
 	parsedURL, err := url.Parse(location)
 	if err != nil {
@@ -325,6 +520,68 @@ func isAllowedLocationHeader(location string) bool {
 	return !strings.HasPrefix(decodedLocation, "//") && !strings.HasPrefix(decodedLocation, `/\`)
 }
 
+// isOwnOriginLocation checks if the location is a URL with the same scheme and host as the request, like the ones made
+// with AbsoluteUrl. Such a redirect only takes the client back to where it already is, whatever name it used for this
+// server, like behind a proxy.
+func (ex Exchange) isOwnOriginLocation(location string) bool {
+	parsedURL, err := url.Parse(location)
+	if err != nil || ex.Request.Host == "" {
+		return false
+	}
+
+	scheme := ex.FindScheme()
+	return strings.EqualFold(parsedURL.Scheme, scheme) &&
+		strings.EqualFold(hostWithPort(parsedURL.Host, scheme), hostWithPort(ex.Request.Host, scheme))
+}
+
+// hostWithPort gives the host, with the default port of the scheme added, if it has no port.
+func hostWithPort(host, scheme string) string {
+	if _, _, err := net.SplitHostPort(host); err == nil {
+		return host
+	}
+	return net.JoinHostPort(strings.Trim(host, "[]"), map[string]string{"http": "80", "https": "443"}[strings.ToLower(scheme)])
+}
+
+// isListenerLocation checks if the location is a URL to one of the addresses this server is configured to listen on.
+// This allows redirects between the HTTP and HTTPS listeners of the server.
+func (ex Exchange) isListenerLocation(location string) bool {
+	parsedURL, err := url.Parse(location)
+	if err != nil || !isAllowedRedirectScheme(parsedURL.Scheme) {
+		return false
+	}
+
+	port := parsedURL.Port()
+	if port == "" {
+		port = map[string]string{"http": "80", "https": "443"}[strings.ToLower(parsedURL.Scheme)]
+	}
+
+	for _, target := range []string{ex.ServerSpec.BindTarget, ex.ServerSpec.TLSBindTarget} {
+		bindHost, bindPort, err := net.SplitHostPort(target)
+		if err != nil || bindPort != port {
+			continue
+		}
+
+		// A listener on all interfaces is reachable at the loopback address, and isn't known by any other name here.
+		if ip := net.ParseIP(bindHost); bindHost == "" || ip != nil && ip.IsUnspecified() {
+			if isLoopbackHost(parsedURL.Hostname()) {
+				return true
+			}
+		} else if strings.EqualFold(bindHost, parsedURL.Hostname()) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func isLoopbackHost(host string) bool {
+	if strings.EqualFold(host, "localhost") {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
 func isAllowedRedirectScheme(scheme string) bool {
 	return strings.EqualFold(scheme, "http") || strings.EqualFold(scheme, "https")
 }
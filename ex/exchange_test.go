@@ -1,6 +1,11 @@
 package ex
 
-import "testing"
+import (
+	"net/http"
+	"testing"
+
+	"github.com/sharat87/httpbun/server/spec"
+)
 
 func TestIsAllowedLocationHeader(t *testing.T) {
 	tests := []struct {
@@ -71,3 +76,65 @@ func TestIsAllowedLocationHeader_WildcardSubdomains(t *testing.T) {
 		t.Fatal("expected bare domain to be disallowed for wildcard-only entry")
 	}
 }
+
+func TestIsListenerLocation(t *testing.T) {
+	ex := Exchange{
+		Request: &http.Request{Host: "evil.example"},
+		ServerSpec: spec.Spec{
+			BindTarget:    "127.0.0.1:3000",
+			TLSBindTarget: ":3443",
+		},
+	}
+
+	tests := []struct {
+		location string
+		allowed  bool
+	}{
+		{"http://127.0.0.1:3000/anything", true},
+		{"https://localhost:3443/anything", true},
+		{"https://127.0.0.1:3443/anything", true},
+		// Not a listener address, though it's allowed as the request's own origin, when that's the Host.
+		{"http://localhost:3000/anything", false},
+		{"http://127.0.0.1:3001/anything", false},
+		{"http://evil.example:3000/anything", false},
+		{"https://evil.example:3443/anything", false},
+		{"https://evil.example/anything", false},
+		{"ftp://127.0.0.1:3000/anything", false},
+	}
+
+	for _, tt := range tests {
+		if got := ex.isListenerLocation(tt.location); got != tt.allowed {
+			t.Errorf("isListenerLocation(%q) = %v, want %v", tt.location, got, tt.allowed)
+		}
+	}
+}
+
+func TestIsOwnOriginLocation(t *testing.T) {
+	ex := Exchange{
+		Request:    &http.Request{Host: "httpbun.internal:8080"},
+		ServerSpec: spec.Spec{BindTarget: "127.0.0.1:3000"},
+	}
+
+	tests := []struct {
+		location string
+		allowed  bool
+	}{
+		{"http://httpbun.internal:8080/anything", true},
+		{"http://HTTPBUN.internal:8080/anything", true},
+		{"https://httpbun.internal:8080/anything", false},
+		{"http://httpbun.internal/anything", false},
+		{"http://httpbun.internal:8081/anything", false},
+		{"http://evil.example:8080/anything", false},
+	}
+
+	for _, tt := range tests {
+		if got := ex.isOwnOriginLocation(tt.location); got != tt.allowed {
+			t.Errorf("isOwnOriginLocation(%q) = %v, want %v", tt.location, got, tt.allowed)
+		}
+	}
+
+	ex.Request.Host = "localhost"
+	if !ex.isOwnOriginLocation("http://localhost:80/anything") {
+		t.Error("expected the default port to match a host without one")
+	}
+}
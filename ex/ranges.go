@@ -0,0 +1,106 @@
+package ex
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"strconv"
+	"strings"
+
+	"github.com/sharat87/httpbun/c"
+	"github.com/sharat87/httpbun/response"
+	"github.com/sharat87/httpbun/util"
+)
+
+// Ranges beyond this count in a single request are considered abusive, and the `Range` header is ignored.
+const maxRangeCount = 32
+
+// RangeResponse responds with the body, or with the parts of it asked for in the `Range` header. The header should have
+// the `Content-Type` of the body, and may have `ETag` and `Last-Modified`, that an `If-Range` header is checked against.
+// The body is never compressed, so that ranges always apply to the same bytes.
+func (ex Exchange) RangeResponse(header http.Header, body []byte) response.Response {
+	header = header.Clone()
+	header.Set("Accept-Ranges", "bytes")
+
+	full := response.Response{
+		Header:     header,
+		Body:       body,
+		NoEncoding: true,
+	}
+
+	rangeHeader := ex.Request.Header.Get("Range")
+	if rangeHeader == "" || ex.Request.Method != http.MethodGet || !isIfRangeFresh(ex.Request.Header.Get("If-Range"), header) {
+		return full
+	}
+
+	size := int64(len(body))
+	ranges, err := util.ParseByteRanges(rangeHeader, size)
+	if err == util.ErrRangeNotSatisfiable {
+		header.Set("Content-Range", "bytes */"+strconv.FormatInt(size, 10))
+		return response.Response{
+			Status:     http.StatusRequestedRangeNotSatisfiable,
+			Header:     header,
+			NoEncoding: true,
+		}
+	} else if err != nil || len(ranges) > maxRangeCount {
+		return full
+	}
+
+	if len(ranges) == 1 {
+		r := ranges[0]
+		header.Set("Content-Range", r.ContentRange(size))
+		return response.Response{
+			Status:     http.StatusPartialContent,
+			Header:     header,
+			Body:       body[r.Start : r.End+1],
+			NoEncoding: true,
+		}
+	}
+
+	buf := &bytes.Buffer{}
+	mw := multipart.NewWriter(buf)
+	for _, r := range ranges {
+		partHeader := textproto.MIMEHeader{}
+		if contentType := header.Get(c.ContentType); contentType != "" {
+			partHeader.Set(c.ContentType, contentType)
+		}
+		partHeader.Set("Content-Range", r.ContentRange(size))
+		part, err := mw.CreatePart(partHeader)
+		if err != nil {
+			return response.BadRequest("%s", err.Error())
+		}
+		_, _ = part.Write(body[r.Start : r.End+1])
+	}
+	_ = mw.Close()
+
+	header.Set(c.ContentType, "multipart/byteranges; boundary="+mw.Boundary())
+	return response.Response{
+		Status:     http.StatusPartialContent,
+		Header:     header,
+		Body:       buf.Bytes(),
+		NoEncoding: true,
+	}
+}
+
+// isIfRangeFresh checks if the representation still matches the `If-Range` header, as per RFC 9110, section 13.1.5.
+// An entity tag has to be a strong match with the `ETag`, and a date has to be an exact match with `Last-Modified`.
+func isIfRangeFresh(ifRange string, header http.Header) bool {
+	if ifRange == "" {
+		return true
+	}
+
+	if strings.HasPrefix(ifRange, `"`) {
+		etag := header.Get("ETag")
+		return etag != "" && etag == ifRange
+	} else if strings.HasPrefix(ifRange, "W/") {
+		return false
+	}
+
+	ifRangeTime, err := http.ParseTime(ifRange)
+	if err != nil {
+		return false
+	}
+	lastModified, err := http.ParseTime(header.Get("Last-Modified"))
+	return err == nil && ifRangeTime.Equal(lastModified)
+}
@@ -0,0 +1,34 @@
+package ex
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/sharat87/httpbun/c"
+	"github.com/sharat87/httpbun/server/spec"
+)
+
+func TestRangeResponseIsNeverEncoded(t *testing.T) {
+	body := []byte(strings.Repeat("abcdefghij", 100))
+
+	for _, rangeHeader := range []string{"", "bytes=10-19", "bytes=0-4, -5"} {
+		req := httptest.NewRequest(http.MethodGet, "/range/1000", nil)
+		req.Header.Set("Accept-Encoding", "gzip")
+		if rangeHeader != "" {
+			req.Header.Set("Range", rangeHeader)
+		}
+
+		rec := httptest.NewRecorder()
+		ex := New(rec, req, spec.Spec{NegotiateEncoding: true})
+		ex.Finish(ex.RangeResponse(http.Header{c.ContentType: {"text/plain"}}, body))
+
+		if encoding := rec.Header().Values(c.ContentEncoding); len(encoding) > 0 {
+			t.Errorf("Range %q: got Content-Encoding %q, want none", rangeHeader, encoding)
+		}
+		if rangeHeader == "" && rec.Body.String() != string(body) {
+			t.Errorf("Range %q: got a body of %d bytes, want the full body", rangeHeader, rec.Body.Len())
+		}
+	}
+}
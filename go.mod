@@ -3,8 +3,15 @@ module github.com/sharat87/httpbun
 go 1.25.1
 
 require (
+	github.com/andybalholm/brotli v1.2.6
 	github.com/dop251/goja v0.0.0-20250309171923-bcd7cc6bf64c
-	github.com/stretchr/testify v1.10.0
+	github.com/fxamacker/cbor/v2 v2.9.4
+	github.com/klauspost/compress v1.20.1
+	github.com/quic-go/quic-go v0.59.0
+	github.com/stretchr/testify v1.11.1
+	github.com/vmihailenco/msgpack/v5 v5.4.1
+	golang.org/x/net v0.49.0
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
@@ -12,7 +19,12 @@ require (
 	github.com/dlclark/regexp2 v1.11.5 // indirect
 	github.com/go-sourcemap/sourcemap v2.1.4+incompatible // indirect
 	github.com/google/pprof v0.0.0-20250501235452-c0086092b71a // indirect
+	github.com/kr/text v0.2.0 // indirect
 	github.com/pmezard/go-difflib v1.0.0 // indirect
-	golang.org/x/text v0.25.0 // indirect
-	gopkg.in/yaml.v3 v3.0.1 // indirect
+	github.com/quic-go/qpack v0.6.0 // indirect
+	github.com/vmihailenco/tagparser/v2 v2.0.0 // indirect
+	github.com/x448/float16 v0.8.4 // indirect
+	golang.org/x/crypto v0.47.0 // indirect
+	golang.org/x/sys v0.40.0 // indirect
+	golang.org/x/text v0.33.0 // indirect
 )
@@ -16,6 +16,5 @@ func main() {
 	log.Printf("Commit: %q, Built: %q.", c.Commit, c.Date)
 
 	s := server.StartNew(c)
-	log.Printf("Serving on %v", s.Addr)
 	log.Fatal(s.Wait())
 }
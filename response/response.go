@@ -3,14 +3,54 @@ package response
 import (
 	"fmt"
 	"net/http"
+	"time"
+
+	"github.com/sharat87/httpbun/util"
 )
 
 type Response struct {
+	// Informational (1xx) responses, sent in order before this response.
+	Interim []Interim
+
 	Status  int
 	Header  http.Header
 	Cookies []http.Cookie
 	Body    any
 	Writer  func(w BodyWriter)
+
+	// Body sent as these exact chunks, with chunked transfer encoding in HTTP/1.1. Over other protocols, each chunk is a
+	// separate flushed write, and extensions are dropped.
+	Chunks []Chunk
+
+	// Trailer fields sent after the body. Names with no values are declared in the `Trailer` header, but not sent.
+	Trailer http.Header
+
+	// If set, the body is compressed with this content coding, and a matching `Content-Encoding` header is added,
+	// unless one is already present in `Header`.
+	ContentEncoding string
+
+	// If true, the body is never compressed, not even when the server negotiates encoding for all responses.
+	NoEncoding bool
+}
+
+// Chunk is a piece of the response body, sent as a single chunk in a chunked response.
+type Chunk struct {
+	Data []byte
+
+	// Chunk extensions, like `name=value;other`, without the leading `;`. Only sent in HTTP/1.1.
+	Extension string
+
+	// Time to wait before sending this chunk.
+	Delay time.Duration
+}
+
+// Interim is an informational (1xx) response, like `103 Early Hints`, sent before the final response.
+type Interim struct {
+	Status int
+	Header http.Header
+
+	// Time to wait after sending this response, before sending the next one.
+	Delay time.Duration
 }
 
 func New(status int, header http.Header, body []byte) Response {
@@ -29,16 +69,29 @@ func BadRequest(message string, vars ...any) Response {
 }
 
 type BodyWriter struct {
-	w http.ResponseWriter
+	w   http.ResponseWriter
+	enc util.EncodingWriter
 }
 
 func NewBodyWriter(w http.ResponseWriter) BodyWriter {
-	return BodyWriter{w}
+	return BodyWriter{w: w}
+}
+
+// NewEncodedBodyWriter creates a BodyWriter that writes content through the given compressing writer, flushing it on
+// every write, so that each piece of content reaches the client as soon as it's written.
+func NewEncodedBodyWriter(w http.ResponseWriter, enc util.EncodingWriter) BodyWriter {
+	return BodyWriter{w: w, enc: enc}
 }
 
 func (bw BodyWriter) Write(content string) error {
-	_, err := bw.w.Write([]byte(content))
-	if err != nil {
+	if bw.enc != nil {
+		if _, err := bw.enc.Write([]byte(content)); err != nil {
+			return err
+		}
+		if err := bw.enc.Flush(); err != nil {
+			return err
+		}
+	} else if _, err := bw.w.Write([]byte(content)); err != nil {
 		return err
 	}
 
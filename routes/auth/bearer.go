@@ -0,0 +1,169 @@
+package auth
+
+import (
+	"mime"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/sharat87/httpbun/c"
+	"github.com/sharat87/httpbun/ex"
+	"github.com/sharat87/httpbun/response"
+)
+
+var BearerStrictRoute = `/bearer/strict/(?P<tok>[^/]+)/?`
+
+// Syntax of a bearer token, in the `Authorization` header, as per RFC 6750, section 2.1.
+var b64tokenPattern = regexp.MustCompile(`^[A-Za-z0-9\-._~+/]+=*$`)
+
+// Syntax of a scope token, as per RFC 6749, section 3.3. These go in the quoted `scope` and `error_description`
+// params of the challenge, which can't have `"` or `\`, as per RFC 6750, section 3.
+var scopeTokenPattern = regexp.MustCompile(`^[\x21\x23-\x5B\x5D-\x7E]+$`)
+
+// bearerError is an error from RFC 6750, section 3.1, to be sent in the `WWW-Authenticate` challenge.
+type bearerError struct {
+	status      int
+	code        string
+	description string
+}
+
+// handleAuthBearerStrict checks the bearer token as per RFC 6750. The token can be given in the `Authorization`
+// header, in a form body, or in the `access_token` query param, but only one of them. The `scope` query param lists
+// the scopes needed, and the `granted` query param lists the scopes that the token has, both separated by spaces.
+func handleAuthBearerStrict(ex *ex.Exchange) response.Response {
+	expectedToken := ex.Field("tok")
+	query := ex.Request.URL.Query()
+	requiredScopes := strings.Fields(query.Get("scope"))
+	grantedScopes := strings.Fields(query.Get("granted"))
+
+	for _, scope := range requiredScopes {
+		if !scopeTokenPattern.MatchString(scope) {
+			return response.BadRequest("Invalid scope %q, as per RFC 6749, section 3.3", scope)
+		}
+	}
+
+	token, source, bErr := findBearerToken(ex)
+	if bErr != nil {
+		return unauthorizedBearer(*bErr, requiredScopes)
+	}
+
+	if source == "" {
+		// Without any authentication information, the challenge shouldn't have an error code.
+		return unauthorizedBearer(bearerError{status: http.StatusUnauthorized}, requiredScopes)
+	}
+
+	if token != expectedToken {
+		return unauthorizedBearer(bearerError{
+			status:      http.StatusUnauthorized,
+			code:        "invalid_token",
+			description: "The access token is invalid",
+		}, requiredScopes)
+	}
+
+	var missingScopes []string
+	for _, scope := range requiredScopes {
+		if !slices.Contains(grantedScopes, scope) {
+			missingScopes = append(missingScopes, scope)
+		}
+	}
+	if len(missingScopes) > 0 {
+		return unauthorizedBearer(bearerError{
+			status:      http.StatusForbidden,
+			code:        "insufficient_scope",
+			description: "The access token is missing the scopes: " + strings.Join(missingScopes, " "),
+		}, requiredScopes)
+	}
+
+	return response.Response{
+		Header: http.Header{
+			"Cache-Control": {"private"},
+		},
+		Body: map[string]any{
+			"authenticated": true,
+			"token":         token,
+			"source":        source,
+			"scope":         strings.Join(grantedScopes, " "),
+		},
+	}
+}
+
+// findBearerToken finds the token in the request, and where it came from, which is one of `header`, `body` or `query`.
+// The source is empty if there's no token at all.
+func findBearerToken(ex *ex.Exchange) (string, string, *bearerError) {
+	var token, source string
+	count := 0
+
+	if values := ex.Request.Header.Values("Authorization"); len(values) > 0 {
+		count++
+		scheme, value, _ := strings.Cut(values[len(values)-1], " ")
+		if !strings.EqualFold(scheme, "Bearer") {
+			// Credentials for another scheme are the same as no credentials, for this endpoint.
+			count--
+		} else if value = strings.TrimSpace(value); !b64tokenPattern.MatchString(value) {
+			return "", "", &bearerError{
+				status:      http.StatusBadRequest,
+				code:        "invalid_request",
+				description: "Malformed bearer token in the Authorization header",
+			}
+		} else {
+			token, source = value, "header"
+		}
+	}
+
+	// As per RFC 6750, section 2.2, the body is only looked at for form bodies, with methods that have a body.
+	mediaType, _, _ := mime.ParseMediaType(ex.Request.Header.Get(c.ContentType))
+	if mediaType == "application/x-www-form-urlencoded" && ex.Request.Method != http.MethodGet && ex.Request.Method != http.MethodHead {
+		form, err := url.ParseQuery(ex.BodyString())
+		if err != nil {
+			return "", "", &bearerError{
+				status:      http.StatusBadRequest,
+				code:        "invalid_request",
+				description: "Malformed form body",
+			}
+		}
+		if values := form["access_token"]; len(values) > 0 {
+			count += len(values)
+			token, source = values[0], "body"
+		}
+	}
+
+	if values := ex.Request.URL.Query()["access_token"]; len(values) > 0 {
+		count += len(values)
+		token, source = values[0], "query"
+	}
+
+	if count > 1 {
+		return "", "", &bearerError{
+			status:      http.StatusBadRequest,
+			code:        "invalid_request",
+			description: "The access token should be given in only one way",
+		}
+	}
+
+	return token, source, nil
+}
+
+// unauthorizedBearer builds an error response, with a `WWW-Authenticate` challenge as per RFC 6750, section 3.
+func unauthorizedBearer(bErr bearerError, requiredScopes []string) response.Response {
+	challenge := "Bearer realm=\"" + REALM + "\""
+	if len(requiredScopes) > 0 {
+		challenge += ", scope=\"" + strings.Join(requiredScopes, " ") + "\""
+	}
+
+	body := map[string]any{"authenticated": false}
+	if bErr.code != "" {
+		challenge += ", error=\"" + bErr.code + "\", error_description=\"" + bErr.description + "\""
+		body["error"] = bErr.code
+		body["error_description"] = bErr.description
+	}
+
+	return response.Response{
+		Status: bErr.status,
+		Header: http.Header{
+			c.WWWAuthenticate: {challenge},
+		},
+		Body: body,
+	}
+}
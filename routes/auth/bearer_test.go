@@ -2,7 +2,9 @@ package auth
 
 import (
 	"encoding/base64"
+	"io"
 	"net/http"
+	"strings"
 	"testing"
 
 	"github.com/sharat87/httpbun/c"
@@ -102,3 +104,46 @@ func TestMissingBearerAuthHeader(t *testing.T) {
 	s.Equal(401, resp.Status)
 	s.Equal("Bearer realm=\"httpbun realm\"", resp.Header.Get(c.WWWAuthenticate))
 }
+
+func TestBearerStrict(t *testing.T) {
+	formHeader := http.Header{c.ContentType: {"application/x-www-form-urlencoded"}}
+
+	for name, tt := range map[string]struct {
+		path      string
+		method    string
+		header    http.Header
+		body      string
+		status    int
+		challenge string
+	}{
+		"valid header":     {"bearer/strict/abc", "GET", http.Header{"Authorization": {"Bearer abc"}}, "", 0, ""},
+		"valid query":      {"bearer/strict/abc?access_token=abc", "GET", nil, "", 0, ""},
+		"valid body":       {"bearer/strict/abc", "POST", formHeader, "access_token=abc", 0, ""},
+		"body on get":      {"bearer/strict/abc", "GET", formHeader, "access_token=abc", 401, `Bearer realm="httpbun realm"`},
+		"missing":          {"bearer/strict/abc", "GET", nil, "", 401, `Bearer realm="httpbun realm"`},
+		"other scheme":     {"bearer/strict/abc", "GET", http.Header{"Authorization": {"Basic abc"}}, "", 401, `Bearer realm="httpbun realm"`},
+		"mismatch":         {"bearer/strict/abc", "GET", http.Header{"Authorization": {"Bearer xyz"}}, "", 401, `Bearer realm="httpbun realm", error="invalid_token", error_description="The access token is invalid"`},
+		"malformed header": {"bearer/strict/abc", "GET", http.Header{"Authorization": {"Bearer a b"}}, "", 400, `Bearer realm="httpbun realm", error="invalid_request", error_description="Malformed bearer token in the Authorization header"`},
+		"multiple methods": {"bearer/strict/abc?access_token=abc", "GET", http.Header{"Authorization": {"Bearer abc"}}, "", 400, `Bearer realm="httpbun realm", error="invalid_request", error_description="The access token should be given in only one way"`},
+		"scope granted":    {"bearer/strict/abc?scope=read+write&granted=write+read+admin", "GET", http.Header{"Authorization": {"Bearer abc"}}, "", 0, ""},
+		"scope missing":    {"bearer/strict/abc?scope=read+write&granted=read", "GET", http.Header{"Authorization": {"Bearer abc"}}, "", 403, `Bearer realm="httpbun realm", scope="read write", error="insufficient_scope", error_description="The access token is missing the scopes: write"`},
+		"scope with quote": {"bearer/strict/abc?scope=read+a%22b", "GET", http.Header{"Authorization": {"Bearer abc"}}, "", 400, ""},
+		"scope with slash": {"bearer/strict/abc?scope=a%5Cb", "GET", nil, "", 400, ""},
+	} {
+		t.Run(name, func(t *testing.T) {
+			s := assert.New(t)
+			req := http.Request{Method: tt.method, Header: tt.header}
+			if tt.body != "" {
+				req.Body = io.NopCloser(strings.NewReader(tt.body))
+			}
+
+			resp := ex.InvokeHandlerForTest(tt.path, req, BearerStrictRoute, handleAuthBearerStrict)
+
+			s.Equal(tt.status, resp.Status)
+			s.Equal(tt.challenge, resp.Header.Get(c.WWWAuthenticate))
+			if tt.status == 0 {
+				s.Equal(true, resp.Body.(map[string]any)["authenticated"])
+			}
+		})
+	}
+}
@@ -0,0 +1,98 @@
+package auth
+
+import (
+	"crypto/x509"
+	"errors"
+	"net/http"
+
+	"github.com/sharat87/httpbun/ex"
+	"github.com/sharat87/httpbun/response"
+	"github.com/sharat87/httpbun/routes/responses"
+)
+
+var ClientCertRoute = `/client-cert/?`
+
+var ClientCertVerifyRoute = `/client-cert/verify/?`
+
+// verifyClientCert checks the client certificate against the configured client CAs. When the TLS handshake has already
+// verified it, that result is used. Otherwise, like with the `request` and `require` modes, it's verified here.
+func verifyClientCert(ex *ex.Exchange) ([][]*x509.Certificate, error) {
+	state := ex.Request.TLS
+	if state == nil {
+		return nil, errors.New("request did not come over TLS")
+	}
+
+	if len(state.PeerCertificates) == 0 {
+		return nil, errors.New("no client certificate presented")
+	}
+
+	if len(state.VerifiedChains) > 0 {
+		return state.VerifiedChains, nil
+	}
+
+	if ex.ServerSpec.TLSClientCAPool == nil {
+		return nil, errors.New("no client CA configured to verify the certificate against")
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, cert := range state.PeerCertificates[1:] {
+		intermediates.AddCert(cert)
+	}
+
+	return state.PeerCertificates[0].Verify(x509.VerifyOptions{
+		Roots:         ex.ServerSpec.TLSClientCAPool,
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	})
+}
+
+func certificateChain(certs []*x509.Certificate) []responses.CertificateInfo {
+	chain := []responses.CertificateInfo{}
+	for _, cert := range certs {
+		chain = append(chain, responses.NewCertificateInfo(cert))
+	}
+	return chain
+}
+
+func handleClientCert(ex *ex.Exchange) response.Response {
+	var presented []*x509.Certificate
+	if ex.Request.TLS != nil {
+		presented = ex.Request.TLS.PeerCertificates
+	}
+
+	body := map[string]any{
+		"presented": len(presented) > 0,
+		"chain":     certificateChain(presented),
+	}
+
+	if chains, err := verifyClientCert(ex); err != nil {
+		body["verified"] = false
+		body["error"] = err.Error()
+	} else {
+		body["verified"] = true
+		body["verifiedChain"] = certificateChain(chains[0])
+	}
+
+	return response.Response{Body: body}
+}
+
+func handleClientCertVerify(ex *ex.Exchange) response.Response {
+	chains, err := verifyClientCert(ex)
+	if err != nil {
+		return response.Response{
+			Status: http.StatusForbidden,
+			Body: map[string]any{
+				"authenticated": false,
+				"error":         err.Error(),
+			},
+		}
+	}
+
+	return response.Response{
+		Body: map[string]any{
+			"authenticated": true,
+			"subject":       chains[0][0].Subject.String(),
+			"verifiedChain": certificateChain(chains[0]),
+		},
+	}
+}
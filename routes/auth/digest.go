@@ -0,0 +1,89 @@
+package auth
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	defaultNonceTTL = 5 * time.Minute
+	maxNonceTTL     = time.Hour
+)
+
+// Digest auth algorithms from RFC 7616, section 6.1, by their canonical names.
+var digestAlgorithms = []string{
+	"MD5",
+	"MD5-sess",
+	"SHA-256",
+	"SHA-256-sess",
+	"SHA-512-256",
+	"SHA-512-256-sess",
+}
+
+// findDigestAlgorithm finds the canonical name of the algorithm, matching case-insensitively.
+func findDigestAlgorithm(name string) (string, bool) {
+	for _, algorithm := range digestAlgorithms {
+		if strings.EqualFold(algorithm, name) {
+			return algorithm, true
+		}
+	}
+	return "", false
+}
+
+// parseDigestAlgorithms parses a comma separated list of algorithms, in order of preference. An empty list means MD5.
+func parseDigestAlgorithms(list string) ([]string, error) {
+	if list == "" {
+		return []string{"MD5"}, nil
+	}
+
+	var algorithms []string
+	for _, name := range strings.Split(list, ",") {
+		algorithm, ok := findDigestAlgorithm(strings.TrimSpace(name))
+		if !ok {
+			return nil, fmt.Errorf("unsupported algorithm %q, should be one of: %s", name, strings.Join(digestAlgorithms, ", "))
+		}
+		algorithms = append(algorithms, algorithm)
+	}
+
+	return algorithms, nil
+}
+
+// digestHashFunc gives the hash function of the algorithm, as a hex string, and whether it's a session variant.
+func digestHashFunc(algorithm string) (hash func(string) string, isSession bool, ok bool) {
+	algorithm, ok = findDigestAlgorithm(algorithm)
+	if !ok {
+		return nil, false, false
+	}
+
+	base, isSession := strings.CutSuffix(algorithm, "-sess")
+	switch base {
+	case "MD5":
+		hash = func(text string) string {
+			sum := md5.Sum([]byte(text))
+			return hex.EncodeToString(sum[:])
+		}
+	case "SHA-256":
+		hash = func(text string) string {
+			sum := sha256.Sum256([]byte(text))
+			return hex.EncodeToString(sum[:])
+		}
+	case "SHA-512-256":
+		hash = func(text string) string {
+			sum := sha512.Sum512_256([]byte(text))
+			return hex.EncodeToString(sum[:])
+		}
+	}
+
+	return hash, isSession, true
+}
+
+// digestUserhash hashes the username, as sent by clients in place of the username, when `userhash=true`.
+func digestUserhash(algorithm, username string) string {
+	hash, _, _ := digestHashFunc(algorithm)
+	return hash(username + ":" + REALM)
+}
@@ -1,20 +1,20 @@
 package auth
 
 import (
-	"net/http"
-	"net/url"
-	"testing"
-
 	"fmt"
 	"io"
+	"net/http"
+	"net/url"
 	"regexp"
 	"strings"
+	"testing"
+	"time"
 
 	"github.com/stretchr/testify/suite"
 
-	"github.com/sharat87/httpbun/server/spec"
-
 	"github.com/sharat87/httpbun/ex"
+	"github.com/sharat87/httpbun/response"
+	"github.com/sharat87/httpbun/server/spec"
 )
 
 type DigestSuite struct {
@@ -65,12 +65,14 @@ func (s *DigestSuite) TestComputeDigestAuthResponse() {
 	s.Equal("", fakeEx.BodyString())
 
 	response, err := computeDigestAuthResponse(
+		"MD5",
 		"user",
 		"pass",
 		"dcd98b7102dd2f0e8b11d0f600bfb0c093",
 		"00000001",
 		"0a4f113b",
 		"auth",
+		fakeEx.Request.URL.RequestURI(),
 		fakeEx,
 	)
 
@@ -91,12 +93,14 @@ func (s *DigestSuite) TestComputeDigestAuthIntResponse() {
 	s.Equal("", fakeEx.BodyString())
 
 	response, err := computeDigestAuthResponse(
+		"MD5",
 		"user",
 		"pass",
 		"dcd98b7102dd2f0e8b11d0f600bfb0c093",
 		"00000001",
 		"0a4f113b",
 		"auth",
+		fakeEx.Request.URL.RequestURI(),
 		fakeEx,
 	)
 
@@ -141,12 +145,14 @@ func (s *DigestSuite) TestDigestAuthWithMultipleQopValues() {
 	)
 
 	response, err := computeDigestAuthResponse(
+		"MD5",
 		username,
 		password,
 		nonce,
 		nc,
 		cnonce,
 		qop,
+		uri,
 		fakeEx,
 	)
 	s.NoError(err)
@@ -214,12 +220,14 @@ func (s *DigestSuite) TestDigestAuthWithAuthIntQop() {
 	)
 
 	response, err := computeDigestAuthResponse(
+		"MD5",
 		username,
 		password,
 		nonce,
 		nc,
 		cnonce,
 		qop,
+		uri,
 		fakeEx,
 	)
 	s.NoError(err)
@@ -251,3 +259,187 @@ func (s *DigestSuite) TestDigestAuthWithAuthIntQop() {
 	// Verify that the body is still readable
 	s.Equal(body, fakeEx.BodyString())
 }
+
+func (s *DigestSuite) TestDigestHashFuncs() {
+	for algorithm, expected := range map[string]string{
+		"MD5":              "900150983cd24fb0d6963f7d28e17f72",
+		"sha-256":          "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad",
+		"SHA-512-256-sess": "53048e2681941ef99b2e29b76b4c7dabe4c2d0c634fc6d46e0e2f13107e7af23",
+	} {
+		hash, _, ok := digestHashFunc(algorithm)
+		s.True(ok, algorithm)
+		s.Equal(expected, hash("abc"), algorithm)
+	}
+
+	_, _, ok := digestHashFunc("SHA-1")
+	s.False(ok)
+}
+
+func (s *DigestSuite) TestDigestAuthMultipleAlgorithmChallenges() {
+	resp := ex.InvokeHandlerForTest(
+		"digest-auth/auth/user/pass/SHA-256,md5",
+		http.Request{},
+		DigestAuthRoute,
+		handleAuthDigest,
+	)
+
+	s.Equal(401, resp.Status)
+	challenges := resp.Header.Values("WWW-Authenticate")
+	s.Len(challenges, 2)
+	s.True(strings.HasSuffix(challenges[0], "algorithm=SHA-256, stale=FALSE"), challenges[0])
+	s.True(strings.HasSuffix(challenges[1], "algorithm=MD5, stale=FALSE"), challenges[1])
+
+	resp = ex.InvokeHandlerForTest(
+		"digest-auth/auth/user/pass/SHA-256?userhash=true",
+		http.Request{},
+		DigestAuthRoute,
+		handleAuthDigest,
+	)
+	s.Equal(401, resp.Status)
+	s.True(strings.HasSuffix(resp.Header.Get("WWW-Authenticate"), "algorithm=SHA-256, stale=FALSE, userhash=true"))
+
+	resp = ex.InvokeHandlerForTest(
+		"digest-auth/auth/user/pass/SHA-1",
+		http.Request{},
+		DigestAuthRoute,
+		handleAuthDigest,
+	)
+	s.Equal(400, resp.Status)
+}
+
+// digestRequest makes a request to the given path, with an Authorization header computed for the nonce.
+func (s *DigestSuite) digestRequest(path, algorithm, nonce, nc string, userhash bool) response.Response {
+	uri := "/" + path
+	cnonce := "0a4f113b"
+
+	requestURL, err := url.Parse(uri)
+	s.NoError(err)
+	fakeEx := ex.New(nil, &http.Request{Method: "GET", URL: requestURL}, spec.Spec{})
+	code, err := computeDigestAuthResponse(algorithm, "user", "pass", nonce, nc, cnonce, "auth", uri, fakeEx)
+	s.NoError(err)
+
+	username := "user"
+	if userhash {
+		username = digestUserhash(algorithm, "user")
+	}
+
+	authHeader := fmt.Sprintf(
+		`Digest username="%s", realm="%s", nonce="%s", uri="%s", algorithm=%s, qop=auth, nc=%s, cnonce="%s", response="%s", userhash=%t`,
+		username, REALM, nonce, uri, algorithm, nc, cnonce, code, userhash,
+	)
+
+	return ex.InvokeHandlerForTest(
+		path,
+		http.Request{Method: "GET", Header: http.Header{"Authorization": []string{authHeader}}},
+		DigestAuthRoute,
+		handleAuthDigest,
+	)
+}
+
+func (s *DigestSuite) challengeNonce(path string) string {
+	resp := ex.InvokeHandlerForTest(path, http.Request{}, DigestAuthRoute, handleAuthDigest)
+	s.Equal(401, resp.Status)
+	matches := regexp.MustCompile(`nonce="([^"]+)"`).FindStringSubmatch(resp.Header.Get("WWW-Authenticate"))
+	s.Len(matches, 2)
+	return matches[1]
+}
+
+func (s *DigestSuite) TestDigestAuthSha256SessWithUserhash() {
+	path := "digest-auth/auth/user/pass/SHA-256-sess?userhash=true"
+	nonce := s.challengeNonce(path)
+
+	resp := s.digestRequest(path, "SHA-256-sess", nonce, "00000001", true)
+	s.Equal(200, resp.Status)
+	s.Equal(map[string]any{"authenticated": true, "user": "user"}, resp.Body)
+
+	// Without opting in, the hashed username isn't accepted.
+	resp = s.digestRequest("digest-auth/auth/user/pass/SHA-256-sess", "SHA-256-sess", nonce, "00000002", true)
+	s.Equal(401, resp.Status)
+	s.Contains(resp.Body.(map[string]any)["error"], "Username mismatch")
+
+	resp = s.digestRequest(path, "MD5", nonce, "00000002", false)
+	s.Equal(401, resp.Status)
+	s.Contains(resp.Body.(map[string]any)["error"], "Unsupported algorithm")
+}
+
+func (s *DigestSuite) TestDigestAuthNonceCountReplay() {
+	path := "digest-auth/auth/user/pass/SHA-512-256"
+	nonce := s.challengeNonce(path)
+
+	s.Equal(200, s.digestRequest(path, "SHA-512-256", nonce, "00000001", false).Status)
+	s.Equal(200, s.digestRequest(path, "SHA-512-256", nonce, "00000002", false).Status)
+
+	resp := s.digestRequest(path, "SHA-512-256", nonce, "00000002", false)
+	s.Equal(401, resp.Status)
+	s.Contains(resp.Body.(map[string]any)["error"], "Nonce count replayed")
+	s.Contains(resp.Header.Get("WWW-Authenticate"), "stale=FALSE")
+}
+
+func (s *DigestSuite) TestDigestAuthStaleNonce() {
+	path := "digest-auth/auth/user/pass/SHA-256?nonce-ttl=1"
+	nonce := nonces.issue(-time.Second)
+
+	resp := s.digestRequest(path, "SHA-256", nonce, "00000001", false)
+	s.Equal(401, resp.Status)
+	s.Contains(resp.Body.(map[string]any)["error"], "Stale nonce")
+	s.Contains(resp.Header.Get("WWW-Authenticate"), "stale=TRUE")
+
+	// A nonce that was never issued isn't stale, so the client has to ask for credentials again.
+	resp = s.digestRequest("digest-auth/auth/user/pass/SHA-256", "SHA-256", "never-issued", "00000001", false)
+	s.Equal(401, resp.Status)
+	s.Contains(resp.Body.(map[string]any)["error"], "Unknown nonce")
+	s.Contains(resp.Header.Get("WWW-Authenticate"), "stale=FALSE")
+
+	// Neither is a nonce with a forged expiry.
+	forged := strings.Repeat("f", nonceExpiryLength) + s.challengeNonce(path)[nonceExpiryLength:]
+	resp = s.digestRequest("digest-auth/auth/user/pass/SHA-256", "SHA-256", forged, "00000001", false)
+	s.Contains(resp.Header.Get("WWW-Authenticate"), "stale=FALSE")
+	s.Nil(nonces.nonces[forged])
+
+	resp = s.digestRequest("digest-auth/auth/user/pass/SHA-256?nonce-ttl=0", "SHA-256", "never-issued", "00000001", false)
+	s.Equal(400, resp.Status)
+}
+
+func (s *DigestSuite) TestNonceStoreLimit() {
+	store := newNonceStore()
+	first := store.issue(time.Minute)
+	s.Equal(nonceValid, store.use(first, "00000001"))
+
+	for range maxTrackedNonces {
+		s.Equal(nonceValid, store.use(store.issue(time.Minute), "00000001"))
+	}
+	s.Equal(maxTrackedNonces, store.order.Len())
+	s.Len(store.nonces, maxTrackedNonces)
+
+	// The first nonce was forgotten, so its count starts over.
+	s.Nil(store.nonces[first])
+	s.Equal(nonceValid, store.use(first, "00000001"))
+
+	// Nonces not issued by the store aren't tracked.
+	s.Equal(nonceUnknown, store.use("never-issued", "00000001"))
+	s.Nil(store.nonces["never-issued"])
+}
+
+func (s *DigestSuite) TestDigestAuthURIMismatch() {
+	path := "digest-auth/auth/user/pass"
+	nonce := s.challengeNonce(path)
+
+	// The response code is right for the given URI, but that's not the one requested.
+	otherURI := "/digest-auth/auth/user/pass?other"
+	fakeEx := ex.New(nil, &http.Request{Method: "GET", URL: &url.URL{Path: "/" + path}}, spec.Spec{})
+	code, err := computeDigestAuthResponse("MD5", "user", "pass", nonce, "00000001", "0a4f113b", "auth", otherURI, fakeEx)
+	s.NoError(err)
+
+	authHeader := fmt.Sprintf(
+		`Digest username="user", realm="%s", nonce="%s", uri="%s", qop=auth, nc=00000001, cnonce="0a4f113b", response="%s"`,
+		REALM, nonce, otherURI, code,
+	)
+	resp := ex.InvokeHandlerForTest(
+		path,
+		http.Request{Method: "GET", Header: http.Header{"Authorization": []string{authHeader}}},
+		DigestAuthRoute,
+		handleAuthDigest,
+	)
+	s.Equal(401, resp.Status)
+	s.Contains(resp.Body.(map[string]any)["error"], "URI mismatch")
+}
@@ -4,7 +4,9 @@ import (
 	"fmt"
 	"net/http"
 	"regexp"
+	"slices"
 	"strings"
+	"time"
 
 	"github.com/sharat87/httpbun/response"
 
@@ -17,14 +19,17 @@ var BasicAuthRoute = "/basic-auth/(?P<user>[^/]+)/(?P<pass>[^/]+)/?"
 
 var BearerAuthRoute = `/bearer(/(?P<tok>[^/]+))?/?`
 
-var DigestAuthRoute = `/digest-auth(/((?P<qop>[^/]+)/)?(?P<user>[^/]+)/(?P<pass>[^/]+))?/?`
+var DigestAuthRoute = `/digest-auth(/((?P<qop>[^/]+)/)?(?P<user>[^/]+)/(?P<pass>[^/]+)(/(?P<algorithm>[^/]+))?)?/?`
 
 const REALM = "httpbun realm"
 
 var RouteList = []ex.Route{
 	ex.NewRoute(BasicAuthRoute, handleAuthBasic),
 	ex.NewRoute(BearerAuthRoute, handleAuthBearer),
+	ex.NewRoute(BearerStrictRoute, handleAuthBearerStrict),
 	ex.NewRoute(DigestAuthRoute, handleAuthDigest),
+	ex.NewRoute(ClientCertRoute, handleClientCert),
+	ex.NewRoute(ClientCertVerifyRoute, handleClientCertVerify),
 }
 
 func handleAuthBasic(ex *ex.Exchange) response.Response {
@@ -85,15 +90,37 @@ func handleAuthDigest(ex *ex.Exchange) response.Response {
 	requireCookieParamValue, _ := ex.QueryParamSingle("require-cookie")
 	requireCookie := requireCookieParamValue == "true" || requireCookieParamValue == "1" || requireCookieParamValue == "t"
 
+	userhashParamValue, _ := ex.QueryParamSingle("userhash")
+	userhash := userhashParamValue == "true" || userhashParamValue == "1" || userhashParamValue == "t"
+
+	algorithms, err := parseDigestAlgorithms(ex.Field("algorithm"))
+	if err != nil {
+		return response.BadRequest("%s", err.Error())
+	}
+
+	nonceTTL, err := ex.QueryParamInt("nonce-ttl", int(defaultNonceTTL/time.Second))
+	if err != nil || nonceTTL < 1 || nonceTTL > int(maxNonceTTL/time.Second) {
+		return response.BadRequest("nonce-ttl must be an integer between 1 and %d", int(maxNonceTTL/time.Second))
+	}
+
+	challenge := digestChallenge{
+		qop:           expectedQop,
+		algorithms:    algorithms,
+		requireCookie: requireCookie,
+		userhash:      userhash,
+		nonceTTL:      time.Duration(nonceTTL) * time.Second,
+	}
+
 	if expectedQop != "" && expectedQop != "auth" && expectedQop != "auth-int" && expectedQop != "auth,auth-int" {
-		return unauthorizedDigest("", requireCookie, "Error: invalid qop")
+		challenge.qop = ""
+		return unauthorizedDigest(challenge, false, "Error: invalid qop")
 	}
 
 	var authHeader string
 	if vals := ex.Request.Header["Authorization"]; len(vals) == 1 {
 		authHeader = vals[0]
 	} else {
-		return unauthorizedDigest(expectedQop, requireCookie, "missing authorization header")
+		return unauthorizedDigest(challenge, false, "missing authorization header")
 	}
 
 	givenDetails := parseDigestAuthHeader(authHeader)
@@ -110,10 +137,21 @@ func handleAuthDigest(ex *ex.Exchange) response.Response {
 			}
 		}
 		if !isSupported {
-			return unauthorizedDigest(expectedQop, requireCookie, fmt.Sprintf("Error: %q\n", "Unsupported QOP"))
+			return unauthorizedDigest(challenge, false, fmt.Sprintf("Error: %q\n", "Unsupported QOP"))
 		}
 	}
 
+	// Algorithm check. Without one given, it's MD5.
+	givenAlgorithm := "MD5"
+	if value := givenDetails["algorithm"]; value != "" {
+		givenAlgorithm = value
+	}
+	algorithm, ok := findDigestAlgorithm(givenAlgorithm)
+	if !ok || !slices.Contains(algorithms, algorithm) {
+		msg := fmt.Sprintf("Error: %q\nGiven: %q\nExpected: %q", "Unsupported algorithm", givenAlgorithm, strings.Join(algorithms, ", "))
+		return unauthorizedDigest(challenge, false, msg)
+	}
+
 	// Nonce check.
 	givenNonce := givenDetails["nonce"]
 
@@ -125,34 +163,77 @@ func handleAuthDigest(ex *ex.Exchange) response.Response {
 				errMessage = "Missing nonce cookie"
 			}
 
-			return unauthorizedDigest(expectedQop, requireCookie, fmt.Sprintf("Error: %q\n", errMessage))
+			return unauthorizedDigest(challenge, false, fmt.Sprintf("Error: %q\n", errMessage))
 		}
 
 		if givenNonce != expectedNonce.Value {
 			msg := fmt.Sprintf("Error: %q\nGiven: %q\nExpected: %q", "Nonce mismatch", givenNonce, expectedNonce.Value)
-			return unauthorizedDigest(expectedQop, requireCookie, msg)
+			return unauthorizedDigest(challenge, false, msg)
 		}
 	}
 
 	// Response code check.
+	givenURI := givenDetails["uri"]
 	expectedResponseCode, err := computeDigestAuthResponse(
+		algorithm,
 		expectedUsername,
 		expectedPassword,
 		givenNonce,
 		givenDetails["nc"],
 		givenDetails["cnonce"],
 		givenDetails["qop"],
+		givenURI,
 		ex,
 	)
 	if err != nil {
-		return unauthorizedDigest(expectedQop, requireCookie, fmt.Sprintf("Error: %q\n", err.Error()))
+		return unauthorizedDigest(challenge, false, fmt.Sprintf("Error: %q\n", err.Error()))
 	}
 
 	givenResponseCode := givenDetails["response"]
 
 	if expectedResponseCode != givenResponseCode {
 		msg := fmt.Sprintf("Error: %q\nGiven: %q\nExpected: %q", "Response code mismatch", givenResponseCode, expectedResponseCode)
-		return unauthorizedDigest(expectedQop, requireCookie, msg)
+		return unauthorizedDigest(challenge, false, msg)
+	}
+
+	// URI check. The response code is computed over the URI the client gives, which has to be the request target, as
+	// per RFC 7616, 3.4.6.
+	if !isDigestRequestTarget(givenURI, ex) {
+		msg := fmt.Sprintf("Error: %q\nGiven: %q\nExpected: %q", "URI mismatch", givenURI, ex.Request.URL.RequestURI())
+		return unauthorizedDigest(challenge, false, msg)
+	}
+
+	// Username check. With `userhash=true`, the username is hashed along with the realm, as per RFC 7616, 3.4.4. That's
+	// only accepted when the challenge offered it.
+	expectedUsernameValue := expectedUsername
+	if userhash && givenDetails["userhash"] == "true" {
+		expectedUsernameValue = digestUserhash(algorithm, expectedUsername)
+	}
+	if givenDetails["username"] != expectedUsernameValue {
+		msg := fmt.Sprintf("Error: %q\nGiven: %q\nExpected: %q", "Username mismatch", givenDetails["username"], expectedUsernameValue)
+		return unauthorizedDigest(challenge, false, msg)
+	}
+
+	// Nonce state check. The credentials are correct at this point, so a stale nonce only needs a retry with a new one.
+	var nc string
+	if givenDetails["qop"] != "" {
+		nc = givenDetails["nc"]
+	}
+
+	switch nonces.use(givenNonce, nc) {
+	case nonceStale:
+		return unauthorizedDigest(challenge, true, fmt.Sprintf("Error: %q\n", "Stale nonce"))
+	case nonceUnknown:
+		// A nonce that came back in the cookie, as set with the challenge, is accepted without tracking its nonce
+		// counts. Other nonces that weren't issued by this server get a new challenge, that isn't stale, as per RFC
+		// 7616, 3.3.
+		if cookie, err := ex.Request.Cookie("nonce"); err != nil || cookie.Value != givenNonce {
+			return unauthorizedDigest(challenge, false, fmt.Sprintf("Error: %q\nGiven: %q", "Unknown nonce", givenNonce))
+		}
+	case nonceReplayed:
+		return unauthorizedDigest(challenge, false, fmt.Sprintf("Error: %q\nGiven: %q", "Nonce count replayed", nc))
+	case nonceInvalidCount:
+		return unauthorizedDigest(challenge, false, fmt.Sprintf("Error: %q\nGiven: %q", "Invalid nonce count", nc))
 	}
 
 	return response.Response{
@@ -164,30 +245,53 @@ func handleAuthDigest(ex *ex.Exchange) response.Response {
 	}
 }
 
-// unauthorizedDigest builds a response with status 401 Unauthorized and WWW-Authenticate header, for Digest auth.
-func unauthorizedDigest(expectedQop string, setCookie bool, error string) response.Response {
-	qop := expectedQop
+// digestChallenge describes the Digest auth challenge that an endpoint responds with.
+type digestChallenge struct {
+	qop           string
+	algorithms    []string
+	requireCookie bool
+	userhash      bool
+	nonceTTL      time.Duration
+}
+
+// unauthorizedDigest builds a response with status 401 Unauthorized and WWW-Authenticate header, for Digest auth. There
+// is a challenge for each algorithm, in order of preference, all with the same nonce.
+func unauthorizedDigest(challenge digestChallenge, stale bool, error string) response.Response {
+	qop := challenge.qop
 	if qop == "" {
 		qop = "auth"
 	}
 
-	newNonce := util.RandomString()
+	newNonce := nonces.issue(challenge.nonceTTL)
 	opaque := util.RandomString()
 
 	var cookies []http.Cookie
-	if setCookie {
+	if challenge.requireCookie {
 		cookies = append(cookies, http.Cookie{
 			Name:  "nonce",
 			Value: newNonce,
 		})
 	}
 
+	staleValue := "FALSE"
+	if stale {
+		staleValue = "TRUE"
+	}
+
+	var userhashParam string
+	if challenge.userhash {
+		userhashParam = ", userhash=true"
+	}
+
+	var challenges []string
+	for _, algorithm := range challenge.algorithms {
+		challenges = append(challenges, "Digest realm=\""+REALM+"\", qop=\""+qop+"\", nonce=\""+newNonce+
+			"\", opaque=\""+opaque+"\", algorithm="+algorithm+", stale="+staleValue+userhashParam)
+	}
+
 	return response.Response{
-		Status: http.StatusUnauthorized,
-		Header: http.Header{c.WWWAuthenticate: []string{
-			"Digest realm=\"" + REALM + "\", qop=\"" + qop + "\", nonce=\"" + newNonce +
-				"\", opaque=\"" + opaque + "\", algorithm=MD5, stale=FALSE",
-		}},
+		Status:  http.StatusUnauthorized,
+		Header:  http.Header{c.WWWAuthenticate: challenges},
 		Cookies: cookies,
 		Body:    map[string]any{"authenticated": false, "token": "", "error": error},
 	}
@@ -209,29 +313,44 @@ func parseDigestAuthHeader(header string) map[string]string {
 	return givenDetails
 }
 
-// Digest auth response computer.
-func computeDigestAuthResponse(username, password, serverNonce, nc, clientNonce, qop string, ex *ex.Exchange) (string, error) {
+// isDigestRequestTarget checks that the digest URI given by the client is the request target, as sent, or as parsed.
+func isDigestRequestTarget(uri string, ex *ex.Exchange) bool {
+	if uri == "" {
+		return false
+	}
+	return uri == ex.Request.RequestURI || uri == ex.Request.URL.RequestURI()
+}
+
+// Digest auth response computer. The path is the digest URI given by the client.
+func computeDigestAuthResponse(algorithm, username, password, serverNonce, nc, clientNonce, qop, path string, ex *ex.Exchange) (string, error) {
 	method := ex.Request.Method
-	path := ex.Request.URL.Path
 	entityBody := ex.BodyString()
 
-	// Source: <https://en.wikipedia.org/wiki/Digest_access_authentication>.
+	// Source: <https://en.wikipedia.org/wiki/Digest_access_authentication>, and RFC 7616, section 3.4.
 	if qop != "" && qop != "auth" && qop != "auth-int" {
 		return "", fmt.Errorf("unsupported qop: %q", qop)
 	}
 
-	ha1 := util.Md5sum(username + ":" + REALM + ":" + password)
+	hash, isSession, ok := digestHashFunc(algorithm)
+	if !ok {
+		return "", fmt.Errorf("unsupported algorithm: %q", algorithm)
+	}
+
+	ha1 := hash(username + ":" + REALM + ":" + password)
+	if isSession {
+		ha1 = hash(ha1 + ":" + serverNonce + ":" + clientNonce)
+	}
 
 	var ha2 string
 	if qop == "" || qop == "auth" {
-		ha2 = util.Md5sum(method + ":" + path)
+		ha2 = hash(method + ":" + path)
 	} else {
-		ha2 = util.Md5sum(method + ":" + path + ":" + util.Md5sum(entityBody))
+		ha2 = hash(method + ":" + path + ":" + hash(entityBody))
 	}
 
 	if qop == "" {
-		return util.Md5sum(ha1 + ":" + serverNonce + ":" + ha2), nil
+		return hash(ha1 + ":" + serverNonce + ":" + ha2), nil
 	}
 
-	return util.Md5sum(ha1 + ":" + serverNonce + ":" + nc + ":" + clientNonce + ":" + qop + ":" + ha2), nil
+	return hash(ha1 + ":" + serverNonce + ":" + nc + ":" + clientNonce + ":" + qop + ":" + ha2), nil
 }
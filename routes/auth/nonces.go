@@ -0,0 +1,183 @@
+package auth
+
+import (
+	"container/list"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/sharat87/httpbun/util"
+)
+
+// How often expired nonces are pruned from the store.
+const noncePruneInterval = time.Minute
+
+// Maximum number of nonces tracked for their nonce counts. When exceeded, the least recently used nonce is forgotten.
+const maxTrackedNonces = 10000
+
+// Length, in hex digits, of the expiry and random parts of a nonce, and of its MAC.
+const (
+	nonceExpiryLength = 16
+	nonceSaltLength   = 16
+	nonceMACLength    = 32
+)
+
+type nonceStatus int
+
+const (
+	nonceValid nonceStatus = iota
+
+	// The nonce was issued by this server, but has expired. The client should retry with a new nonce, without asking
+	// the user for credentials again.
+	nonceStale
+
+	// The nonce wasn't issued by this server.
+	nonceUnknown
+
+	// The nonce count isn't greater than the one in an earlier request with the same nonce.
+	nonceReplayed
+
+	// The nonce count isn't an 8 digit hex number.
+	nonceInvalidCount
+)
+
+type digestNonce struct {
+	nonce   string
+	expires time.Time
+
+	// Highest nonce count seen with this nonce.
+	count uint64
+}
+
+// nonceStore issues nonces that carry their own expiry, signed with a key only the server knows, so issuing one
+// doesn't need any state. Only the nonces that have been used with a nonce count are tracked, until they expire, or
+// until more than maxTrackedNonces are being tracked.
+type nonceStore struct {
+	key []byte
+
+	mu sync.Mutex
+
+	// Tracked nonces, with the least recently used at the front.
+	order *list.List
+
+	// Elements of order, by nonce.
+	nonces map[string]*list.Element
+
+	nextPrune time.Time
+}
+
+var nonces = newNonceStore()
+
+func newNonceStore() *nonceStore {
+	return &nonceStore{
+		key:    util.RandomBytes(32),
+		order:  list.New(),
+		nonces: map[string]*list.Element{},
+	}
+}
+
+// issue makes a new nonce, that is valid for the given duration.
+func (s *nonceStore) issue(ttl time.Duration) string {
+	expiry := binary.BigEndian.AppendUint64(nil, uint64(time.Now().Add(ttl).Unix()))
+	body := hex.EncodeToString(expiry) + hex.EncodeToString(util.RandomBytes(nonceSaltLength/2))
+	return body + s.sign(body)
+}
+
+// verify checks that the nonce was issued by this server, and gives its expiry.
+func (s *nonceStore) verify(nonce string) (time.Time, bool) {
+	if len(nonce) != nonceExpiryLength+nonceSaltLength+nonceMACLength {
+		return time.Time{}, false
+	}
+
+	body, mac := nonce[:nonceExpiryLength+nonceSaltLength], nonce[nonceExpiryLength+nonceSaltLength:]
+	if !hmac.Equal([]byte(mac), []byte(s.sign(body))) {
+		return time.Time{}, false
+	}
+
+	expiry, err := strconv.ParseUint(body[:nonceExpiryLength], 16, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	return time.Unix(int64(expiry), 0), true
+}
+
+func (s *nonceStore) sign(body string) string {
+	mac := hmac.New(sha256.New, s.key)
+	mac.Write([]byte(body))
+	return hex.EncodeToString(mac.Sum(nil))[:nonceMACLength]
+}
+
+// use checks the nonce, and the nonce count if given, and records the count as seen. Without a count, as when no qop
+// is used, the nonce can be used any number of times, until it expires.
+func (s *nonceStore) use(nonce string, nc string) nonceStatus {
+	expires, issued := s.verify(nonce)
+	if !issued {
+		return nonceUnknown
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	element := s.nonces[nonce]
+	if !time.Now().Before(expires) {
+		if element != nil {
+			s.forget(element)
+		}
+		return nonceStale
+	}
+
+	if nc == "" {
+		return nonceValid
+	}
+
+	count, err := strconv.ParseUint(nc, 16, 64)
+	if err != nil || len(nc) != 8 {
+		return nonceInvalidCount
+	}
+
+	if element == nil {
+		s.prune()
+		if s.order.Len() >= maxTrackedNonces {
+			s.forget(s.order.Front())
+		}
+		element = s.order.PushBack(&digestNonce{nonce: nonce, expires: expires})
+		s.nonces[nonce] = element
+	} else {
+		s.order.MoveToBack(element)
+	}
+
+	n := element.Value.(*digestNonce)
+	if count <= n.count {
+		return nonceReplayed
+	}
+
+	n.count = count
+	return nonceValid
+}
+
+func (s *nonceStore) forget(element *list.Element) {
+	n := s.order.Remove(element).(*digestNonce)
+	delete(s.nonces, n.nonce)
+}
+
+// prune drops the nonces that have expired, at most once every noncePruneInterval. Needs s.mu to be held.
+func (s *nonceStore) prune() {
+	now := time.Now()
+	if now.Before(s.nextPrune) {
+		return
+	}
+	s.nextPrune = now.Add(noncePruneInterval)
+
+	for element := s.order.Front(); element != nil; {
+		next := element.Next()
+		if !now.Before(element.Value.(*digestNonce).expires) {
+			s.forget(element)
+		}
+		element = next
+	}
+}
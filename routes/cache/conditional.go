@@ -0,0 +1,211 @@
+package cache
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sharat87/httpbun/ex"
+	"github.com/sharat87/httpbun/response"
+)
+
+// Validators of a representation, that conditional request headers are evaluated against. Zero values mean the
+// representation doesn't have that validator.
+type Validators struct {
+	// A full entity tag, including the quotes, and the `W/` prefix if weak.
+	ETag string
+
+	LastModified time.Time
+}
+
+// SetHeaders sets the `ETag` and `Last-Modified` headers for the validators that are present.
+func (v Validators) SetHeaders(header http.Header) {
+	if v.ETag != "" {
+		header.Set("ETag", v.ETag)
+	}
+	if !v.LastModified.IsZero() {
+		header.Set("Last-Modified", v.LastModified.UTC().Format(http.TimeFormat))
+	}
+}
+
+// Evaluate evaluates the conditional headers of the request against the validators, in the order given in RFC 9110,
+// section 13.2.2. It returns the status to respond with instead of the normal response, which is 304 or 412, or 0 if
+// the request should be served normally. The `If-Range` header is not evaluated here, since it only matters for range
+// requests.
+func Evaluate(req *http.Request, v Validators) int {
+	isGetOrHead := req.Method == http.MethodGet || req.Method == http.MethodHead
+
+	if ifMatch := headerList(req.Header, "If-Match"); ifMatch != "" {
+		if !matchesAny(ifMatch, v.ETag, true) {
+			return http.StatusPreconditionFailed
+		}
+	} else if since, ok := headerTime(req.Header, "If-Unmodified-Since"); ok && !v.LastModified.IsZero() {
+		if v.LastModified.Truncate(time.Second).After(since) {
+			return http.StatusPreconditionFailed
+		}
+	}
+
+	if ifNoneMatch := headerList(req.Header, "If-None-Match"); ifNoneMatch != "" {
+		if matchesAny(ifNoneMatch, v.ETag, false) {
+			if isGetOrHead {
+				return http.StatusNotModified
+			}
+			return http.StatusPreconditionFailed
+		}
+	} else if since, ok := headerTime(req.Header, "If-Modified-Since"); ok && isGetOrHead && !v.LastModified.IsZero() {
+		if !v.LastModified.Truncate(time.Second).After(since) {
+			return http.StatusNotModified
+		}
+	}
+
+	return 0
+}
+
+// Conditional sets the validators on the response, and replaces it with a 304 or 412 response, if the conditional
+// headers of the request say so.
+func Conditional(ex *ex.Exchange, v Validators, resp response.Response) response.Response {
+	if resp.Header == nil {
+		resp.Header = http.Header{}
+	}
+	v.SetHeaders(resp.Header)
+
+	switch status := Evaluate(ex.Request, v); status {
+	case http.StatusNotModified:
+		// A 304 has the headers that a 200 would have had, except for the ones describing the content.
+		header := resp.Header.Clone()
+		header.Del("Content-Type")
+		header.Del("Content-Length")
+		header.Del("Content-Range")
+		return response.Response{Status: status, Header: header}
+
+	case http.StatusPreconditionFailed:
+		header := http.Header{}
+		v.SetHeaders(header)
+		return response.Response{Status: status, Header: header}
+
+	}
+
+	return resp
+}
+
+// NormalizeETag makes an entity tag out of the given value. Values that are already entity tags, like `"abc"` or
+// `W/"abc"`, are taken as is. Anything else is quoted, to be a strong entity tag.
+func NormalizeETag(value string) string {
+	if _, rest, ok := parseETag(value); ok && rest == "" {
+		return value
+	}
+	return `"` + strings.ReplaceAll(value, `"`, "") + `"`
+}
+
+// ParseTime parses a time given as an HTTP date, or as a Unix timestamp in seconds.
+func ParseTime(value string) (time.Time, error) {
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Unix(seconds, 0).UTC(), nil
+	}
+	return http.ParseTime(value)
+}
+
+// matchesAny checks if the etag matches any entity tag in the list, which is the value of an `If-Match` or
+// `If-None-Match` header. Comparison is strong or weak as per RFC 9110, section 8.8.3.2. A `*` matches any current
+// representation, and endpoints using this always have one.
+func matchesAny(list string, etag string, strong bool) bool {
+	if strings.TrimSpace(list) == "*" {
+		return true
+	}
+
+	if etag == "" {
+		return false
+	}
+
+	for _, candidate := range parseETagList(list) {
+		if strong {
+			if !isWeak(candidate) && !isWeak(etag) && candidate == etag {
+				return true
+			}
+		} else if strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+
+	return false
+}
+
+func isWeak(etag string) bool {
+	return strings.HasPrefix(etag, "W/")
+}
+
+// parseETagList parses a comma separated list of entity tags. Since commas are allowed inside entity tags, the list
+// can't just be split by commas. Bare values without quotes are taken to be strong entity tags, for lenient clients.
+// Parsing stops at anything that doesn't look like an entity tag.
+func parseETagList(list string) []string {
+	var etags []string
+
+	rest := list
+	for {
+		rest = strings.TrimLeft(rest, " \t,")
+		if rest == "" {
+			break
+		}
+
+		etag, after, ok := parseETag(rest)
+		if !ok {
+			bare, after, _ := strings.Cut(rest, ",")
+			if strings.Contains(bare, `"`) {
+				break
+			}
+			etags = append(etags, `"`+strings.TrimSpace(bare)+`"`)
+			rest = after
+			continue
+		}
+
+		etags = append(etags, etag)
+		rest = strings.TrimLeft(after, " \t")
+		if rest != "" && rest[0] != ',' {
+			break
+		}
+	}
+
+	return etags
+}
+
+// parseETag parses an entity tag at the start of the value, and returns it, along with the rest of the value.
+func parseETag(value string) (etag string, rest string, ok bool) {
+	start := 0
+	if strings.HasPrefix(value, "W/") {
+		start = 2
+	}
+
+	if len(value) < start+2 || value[start] != '"' {
+		return "", value, false
+	}
+
+	end := strings.IndexByte(value[start+1:], '"')
+	if end < 0 {
+		return "", value, false
+	}
+	end += start + 2
+
+	for _, ch := range []byte(value[start+1 : end-1]) {
+		if ch < 0x21 || ch == 0x7f {
+			return "", value, false
+		}
+	}
+
+	return value[:end], value[end:], true
+}
+
+// headerList joins all values of the header into a single comma separated list.
+func headerList(header http.Header, name string) string {
+	return strings.Join(header.Values(name), ", ")
+}
+
+// headerTime parses the header as an HTTP date. Invalid dates are ignored, as per RFC 9110.
+func headerTime(header http.Header, name string) (time.Time, bool) {
+	value := header.Get(name)
+	if value == "" {
+		return time.Time{}, false
+	}
+	t, err := http.ParseTime(value)
+	return t, err == nil
+}
@@ -0,0 +1,92 @@
+package cache
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseETagList(t *testing.T) {
+	tests := []struct {
+		list     string
+		expected []string
+	}{
+		{`"a"`, []string{`"a"`}},
+		{`"a", W/"b" ,"c"`, []string{`"a"`, `W/"b"`, `"c"`}},
+		{`"a,b", "c"`, []string{`"a,b"`, `"c"`}},
+		{`abc, "d"`, []string{`"abc"`, `"d"`}},
+		{`"a" junk, "b"`, []string{`"a"`}},
+		{`"unterminated`, nil},
+		{``, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.list, func(t *testing.T) {
+			assert.Equal(t, tt.expected, parseETagList(tt.list))
+		})
+	}
+}
+
+func TestNormalizeETag(t *testing.T) {
+	assert.Equal(t, `"abc"`, NormalizeETag("abc"))
+	assert.Equal(t, `"abc"`, NormalizeETag(`"abc"`))
+	assert.Equal(t, `W/"abc"`, NormalizeETag(`W/"abc"`))
+	assert.Equal(t, `"abc"`, NormalizeETag(`"abc`))
+}
+
+func TestEvaluate(t *testing.T) {
+	lastModified := time.Date(2024, time.January, 10, 0, 0, 0, 0, time.UTC)
+	before := lastModified.Add(-time.Hour).Format(http.TimeFormat)
+	after := lastModified.Add(time.Hour).Format(http.TimeFormat)
+	strong := Validators{ETag: `"v1"`, LastModified: lastModified}
+	weak := Validators{ETag: `W/"v1"`, LastModified: lastModified}
+
+	tests := []struct {
+		name       string
+		method     string
+		header     http.Header
+		validators Validators
+		expected   int
+	}{
+		{"no conditions", http.MethodGet, http.Header{}, strong, 0},
+
+		{"if-match strong", http.MethodPut, http.Header{"If-Match": {`"v0", "v1"`}}, strong, 0},
+		{"if-match mismatch", http.MethodPut, http.Header{"If-Match": {`"v0"`}}, strong, http.StatusPreconditionFailed},
+		{"if-match weak etag", http.MethodPut, http.Header{"If-Match": {`W/"v1"`}}, weak, http.StatusPreconditionFailed},
+		{"if-match weak candidate", http.MethodPut, http.Header{"If-Match": {`W/"v1"`}}, strong, http.StatusPreconditionFailed},
+		{"if-match star", http.MethodDelete, http.Header{"If-Match": {"*"}}, strong, 0},
+		{"if-match on get", http.MethodGet, http.Header{"If-Match": {`"v0"`}}, strong, http.StatusPreconditionFailed},
+
+		{"if-unmodified-since after", http.MethodPut, http.Header{"If-Unmodified-Since": {after}}, strong, 0},
+		{"if-unmodified-since before", http.MethodPut, http.Header{"If-Unmodified-Since": {before}}, strong, http.StatusPreconditionFailed},
+		{"if-unmodified-since invalid", http.MethodPut, http.Header{"If-Unmodified-Since": {"yesterday"}}, strong, 0},
+		{"if-match over if-unmodified-since", http.MethodPut, http.Header{
+			"If-Match":            {`"v1"`},
+			"If-Unmodified-Since": {before},
+		}, strong, 0},
+
+		{"if-none-match weak", http.MethodGet, http.Header{"If-None-Match": {`"v1"`}}, weak, http.StatusNotModified},
+		{"if-none-match list", http.MethodHead, http.Header{"If-None-Match": {`"v0"`, `W/"v1"`}}, strong, http.StatusNotModified},
+		{"if-none-match mismatch", http.MethodGet, http.Header{"If-None-Match": {`"v0"`}}, strong, 0},
+		{"if-none-match on post", http.MethodPost, http.Header{"If-None-Match": {"*"}}, strong, http.StatusPreconditionFailed},
+
+		{"if-modified-since after", http.MethodGet, http.Header{"If-Modified-Since": {after}}, strong, http.StatusNotModified},
+		{"if-modified-since exact", http.MethodGet, http.Header{"If-Modified-Since": {lastModified.Format(http.TimeFormat)}}, strong, http.StatusNotModified},
+		{"if-modified-since before", http.MethodGet, http.Header{"If-Modified-Since": {before}}, strong, 0},
+		{"if-modified-since on post", http.MethodPost, http.Header{"If-Modified-Since": {after}}, strong, 0},
+		{"if-none-match over if-modified-since", http.MethodGet, http.Header{
+			"If-None-Match":     {`"v0"`},
+			"If-Modified-Since": {after},
+		}, strong, 0},
+		{"no last-modified", http.MethodGet, http.Header{"If-Modified-Since": {after}}, Validators{ETag: `"v1"`}, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := &http.Request{Method: tt.method, Header: tt.header}
+			assert.Equal(t, tt.expected, Evaluate(req, tt.validators))
+		})
+	}
+}
@@ -1,7 +1,10 @@
 package cache
 
 import (
+	"fmt"
 	"net/http"
+	"net/url"
+	"time"
 
 	"github.com/sharat87/httpbun/ex"
 	"github.com/sharat87/httpbun/response"
@@ -12,22 +15,36 @@ var RouteList = []ex.Route{
 	ex.NewRoute("/cache", handleCache),
 	ex.NewRoute("/cache/(?P<age>\\d+)", handleCacheControl),
 	ex.NewRoute("/etag/(?P<etag>[^/]+)", handleEtag),
+	ex.NewRoute(`/cache/lab/(?P<name>[\w.-]+)/?`, handleCacheLab),
+	ex.NewRoute(`/cache/stats(/(?P<name>[\w.-]+))?/?`, handleCacheStats),
 }
 
+// startTime is the default `Last-Modified` of `/cache`.
+var startTime = time.Now().UTC().Truncate(time.Second)
+
 func handleCache(ex *ex.Exchange) response.Response {
-	shouldSendData :=
-		ex.HeaderValueLast("If-Modified-Since") == "" &&
-			ex.HeaderValueLast("If-None-Match") == ""
+	validators := Validators{LastModified: startTime}
 
-	if shouldSendData {
-		info, err := responses.InfoJSON(ex)
+	if value := ex.Request.URL.Query().Get("last-modified"); value != "" {
+		lastModified, err := ParseTime(value)
 		if err != nil {
-			return response.BadRequest("%s", err.Error())
+			return response.BadRequest("Invalid last-modified, should be an HTTP date or a Unix timestamp: %s", value)
 		}
-		return response.Response{Body: info}
+		validators.LastModified = lastModified
+	}
+
+	if value := ex.Request.URL.Query().Get("etag"); value != "" {
+		validators.ETag = NormalizeETag(value)
 	} else {
-		return response.Response{Status: http.StatusNotModified}
+		validators.ETag = fmt.Sprintf(`"%d"`, validators.LastModified.Unix())
 	}
+
+	info, err := responses.InfoJSON(ex)
+	if err != nil {
+		return response.BadRequest("%s", err.Error())
+	}
+
+	return Conditional(ex, validators, response.Response{Body: info})
 }
 
 func handleCacheControl(ex *ex.Exchange) response.Response {
@@ -45,17 +62,15 @@ func handleCacheControl(ex *ex.Exchange) response.Response {
 }
 
 func handleEtag(ex *ex.Exchange) response.Response {
-	// TODO: Handle If-Match header in etag endpoint: <https://developer.mozilla.org/en-US/docs/Web/HTTP/Headers/If-Match>.
-	etagInUrl := ex.Field("etag")
-	etagInHeader := ex.HeaderValueLast("If-None-Match")
+	info, err := responses.InfoJSON(ex)
+	if err != nil {
+		return response.BadRequest("%s", err.Error())
+	}
 
-	if etagInUrl == etagInHeader {
-		return response.Response{Status: http.StatusNotModified}
-	} else {
-		info, err := responses.InfoJSON(ex)
-		if err != nil {
-			return response.BadRequest("%s", err.Error())
-		}
-		return response.Response{Body: info}
+	etag, err := url.PathUnescape(ex.Field("etag"))
+	if err != nil {
+		return response.BadRequest("%s", err.Error())
 	}
+
+	return Conditional(ex, Validators{ETag: NormalizeETag(etag)}, response.Response{Body: info})
 }
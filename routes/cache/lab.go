@@ -0,0 +1,256 @@
+package cache
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sharat87/httpbun/ex"
+	"github.com/sharat87/httpbun/response"
+)
+
+// Maximum number of cache keys tracked. When exceeded, the least recently seen key is forgotten.
+const maxTrackedKeys = 10000
+
+// KeyStats counts the requests for a cache key that actually reached the server.
+type KeyStats struct {
+	Name        string    `json:"name"`
+	Requests    int       `json:"requests"`
+	Full        int       `json:"full"`
+	NotModified int       `json:"notModified"`
+	FirstSeen   time.Time `json:"firstSeen"`
+	LastSeen    time.Time `json:"lastSeen"`
+}
+
+type trackedKey struct {
+	key   string
+	stats KeyStats
+}
+
+type labStats struct {
+	mu sync.Mutex
+
+	// Tracked keys, with the least recently seen at the front.
+	order *list.List
+
+	// Elements of order, by name and then by key.
+	byName map[string]map[string]*list.Element
+}
+
+var stats = newLabStats()
+
+func newLabStats() *labStats {
+	return &labStats{
+		order:  list.New(),
+		byName: map[string]map[string]*list.Element{},
+	}
+}
+
+// record counts a request for the key, that was responded to with the given status, and returns a copy of its stats.
+func (s *labStats) record(name, key string, status int) KeyStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now().UTC()
+	keys := s.byName[name]
+	if keys == nil {
+		keys = map[string]*list.Element{}
+		s.byName[name] = keys
+	}
+
+	element := keys[key]
+	if element == nil {
+		if s.order.Len() >= maxTrackedKeys {
+			s.forget(s.order.Front())
+		}
+		element = s.order.PushBack(&trackedKey{
+			key:   key,
+			stats: KeyStats{Name: name, FirstSeen: now},
+		})
+		keys[key] = element
+	} else {
+		s.order.MoveToBack(element)
+	}
+
+	ks := &element.Value.(*trackedKey).stats
+	ks.Requests++
+	ks.LastSeen = now
+	if status == http.StatusNotModified {
+		ks.NotModified++
+	} else {
+		ks.Full++
+	}
+
+	return *ks
+}
+
+func (s *labStats) forget(element *list.Element) {
+	tracked := s.order.Remove(element).(*trackedKey)
+	keys := s.byName[tracked.stats.Name]
+	delete(keys, tracked.key)
+	if len(keys) == 0 {
+		delete(s.byName, tracked.stats.Name)
+	}
+}
+
+// snapshot copies the stats of all keys under the given name.
+func (s *labStats) snapshot(name string) map[string]KeyStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	result := map[string]KeyStats{}
+	for key, element := range s.byName[name] {
+		result[key] = element.Value.(*trackedKey).stats
+	}
+	return result
+}
+
+func (s *labStats) reset(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, element := range s.byName[name] {
+		s.forget(element)
+	}
+}
+
+// handleCacheLab responds with the caching headers asked for in the query params, and counts the request against its
+// cache key. The cache key is the path and query, along with the values of request headers the response varies on.
+func handleCacheLab(ex *ex.Exchange) response.Response {
+	name := ex.Field("name")
+	query := ex.Request.URL.Query()
+	header := http.Header{}
+
+	if directives := query["cc"]; len(directives) > 0 {
+		header.Set("Cache-Control", strings.Join(directives, ", "))
+	}
+
+	var vary []string
+	for _, value := range query["vary"] {
+		for _, field := range strings.Split(value, ",") {
+			if field = strings.TrimSpace(field); field != "" {
+				vary = append(vary, http.CanonicalHeaderKey(field))
+			}
+		}
+	}
+	if len(vary) > 0 {
+		header.Set("Vary", strings.Join(vary, ", "))
+	}
+
+	if value := query.Get("age"); value != "" {
+		age, err := strconv.Atoi(value)
+		if err != nil || age < 0 {
+			return response.BadRequest("Invalid age, should be a non-negative number of seconds: %s", value)
+		}
+		header.Set("Age", strconv.Itoa(age))
+	}
+
+	if value := query.Get("expires"); value != "" {
+		// Seconds from now, which can be negative, or an HTTP date, which is sent as is.
+		if seconds, err := strconv.Atoi(value); err == nil {
+			header.Set("Expires", time.Now().Add(time.Duration(seconds)*time.Second).UTC().Format(http.TimeFormat))
+		} else {
+			header.Set("Expires", value)
+		}
+	}
+
+	validators := Validators{LastModified: startTime}
+	if value := query.Get("last-modified"); value != "" {
+		lastModified, err := ParseTime(value)
+		if err != nil {
+			return response.BadRequest("Invalid last-modified, should be an HTTP date or a Unix timestamp: %s", value)
+		}
+		validators.LastModified = lastModified
+	}
+	if value := query.Get("etag"); value != "" {
+		validators.ETag = NormalizeETag(value)
+	} else {
+		validators.ETag = `"` + name + "-" + strconv.FormatInt(validators.LastModified.Unix(), 10) + `"`
+	}
+
+	key := cacheKey(ex, vary)
+	status := Evaluate(ex.Request, validators)
+	keyStats := stats.record(name, key, status)
+
+	return Conditional(ex, validators, response.Response{
+		Header: header,
+		Body: map[string]any{
+			"name":     name,
+			"key":      key,
+			"requests": keyStats.Requests,
+			"servedAt": keyStats.LastSeen,
+		},
+	})
+}
+
+// cacheKey makes the cache key for the request. Values of the varied headers, which can be credentials, like with
+// `Authorization` or `Cookie`, are hashed, so that they aren't shown to anyone getting the stats.
+func cacheKey(ex *ex.Exchange, vary []string) string {
+	key := ex.RoutedPath
+	if ex.Request.URL.RawQuery != "" {
+		key += "?" + ex.Request.URL.RawQuery
+	}
+
+	vary = slices.Clone(vary)
+	slices.Sort(vary)
+	for _, name := range slices.Compact(vary) {
+		key += " " + name + "=" + hashHeaderValue(ex.Request.Header.Values(name))
+	}
+
+	return key
+}
+
+// hashHeaderValue gives a short hash of the header's values, or `-` if the header is absent.
+func hashHeaderValue(values []string) string {
+	if len(values) == 0 {
+		return "-"
+	}
+	sum := sha256.Sum256([]byte(strings.Join(values, ", ")))
+	return hex.EncodeToString(sum[:8])
+}
+
+// handleCacheStats responds with the stats of cache keys under the given name. A DELETE resets them. There's no
+// listing or resetting of all keys, since names are how clients keep out of each other's stats.
+func handleCacheStats(ex *ex.Exchange) response.Response {
+	name := ex.Field("name")
+	if name == "" {
+		return response.BadRequest("specify the name used with /cache/lab, example `/cache/stats/test1`")
+	}
+
+	switch ex.Request.Method {
+	case http.MethodGet, http.MethodHead:
+		keys := stats.snapshot(name)
+		requests := 0
+		for _, ks := range keys {
+			requests += ks.Requests
+		}
+		return response.Response{
+			Header: http.Header{
+				"Cache-Control": {"no-store"},
+			},
+			Body: map[string]any{
+				"name":     name,
+				"requests": requests,
+				"keys":     keys,
+			},
+		}
+
+	case http.MethodDelete:
+		stats.reset(name)
+		return response.Response{Status: http.StatusNoContent}
+
+	}
+
+	return response.Response{
+		Status: http.StatusMethodNotAllowed,
+		Header: http.Header{
+			"Allow": {"GET, HEAD, DELETE"},
+		},
+	}
+}
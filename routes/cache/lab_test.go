@@ -0,0 +1,35 @@
+package cache
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLabStatsForgetsLeastRecentlySeen(t *testing.T) {
+	s := assert.New(t)
+	stats := newLabStats()
+
+	stats.record("first", "a", http.StatusOK)
+	stats.record("first", "b", http.StatusOK)
+	for i := range maxTrackedKeys - 2 {
+		stats.record("filler", fmt.Sprint(i), http.StatusOK)
+	}
+
+	// Seeing `a` again makes `b` the least recently seen key, so it's the one forgotten for a new key.
+	stats.record("first", "a", http.StatusNotModified)
+	stats.record("second", "c", http.StatusOK)
+
+	first := stats.snapshot("first")
+	s.Len(first, 1)
+	s.Equal(2, first["a"].Requests)
+	s.Equal(1, first["a"].NotModified)
+	s.Len(stats.snapshot("second"), 1)
+	s.Equal(maxTrackedKeys, stats.order.Len())
+
+	stats.reset("first")
+	s.Empty(stats.snapshot("first"))
+	s.Equal(maxTrackedKeys-1, stats.order.Len())
+}
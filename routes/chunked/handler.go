@@ -0,0 +1,141 @@
+package chunked
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sharat87/httpbun/c"
+	"github.com/sharat87/httpbun/ex"
+	"github.com/sharat87/httpbun/response"
+)
+
+// Limits on the chunks generated by `/chunked`.
+const (
+	maxChunkCount = 100
+	maxChunkSize  = 64 << 10
+	maxTotalSize  = 1 << 20
+	maxDelay      = 10 * time.Second
+	maxTotalDelay = 60 * time.Second
+)
+
+var RouteList = []ex.Route{
+	ex.NewRoute(`/chunked/?`, handleChunked),
+}
+
+// handleChunked responds with a body made of chunks of the given sizes, with optional delays between them, chunk
+// extensions, and trailers. Each chunk is filled with a single letter, going `a`, `b`, `c`, etc., so that chunk
+// boundaries are visible in the decoded body.
+func handleChunked(ex *ex.Exchange) response.Response {
+	query := ex.Request.URL.Query()
+
+	sizes, err := parseSizes(query.Get("sizes"))
+	if err != nil {
+		return response.BadRequest("%s", err.Error())
+	}
+
+	delay := time.Duration(0)
+	if value := query.Get("delay"); value != "" {
+		seconds, err := strconv.ParseFloat(value, 64)
+		if err != nil || seconds < 0 {
+			return response.BadRequest("invalid delay value: '%s'", value)
+		}
+		delay = time.Duration(seconds * float64(time.Second))
+		if delay > maxDelay {
+			return response.BadRequest("delay must be at most %v", maxDelay)
+		} else if delay*time.Duration(len(sizes)-1) > maxTotalDelay {
+			return response.BadRequest("total delay must be at most %v", maxTotalDelay)
+		}
+	}
+
+	extensions := query["ext"]
+	if len(extensions) > 1 && len(extensions) != len(sizes) {
+		return response.BadRequest("ext must be given once, or once for each chunk")
+	}
+	for _, ext := range extensions {
+		if !isValidExtension(ext) {
+			return response.BadRequest("invalid chunk extension: '%s'", ext)
+		}
+	}
+
+	trailer := http.Header{}
+	for _, field := range query["trailer"] {
+		name, value, found := strings.Cut(field, ":")
+		if !found || name == "" {
+			return response.BadRequest("trailer must be in the form name:value, got '%s'", field)
+		}
+		trailer.Add(name, value)
+	}
+	for _, name := range query["declare"] {
+		if name == "" {
+			return response.BadRequest("declared trailer name can't be empty")
+		}
+		name = http.CanonicalHeaderKey(name)
+		if _, exists := trailer[name]; !exists {
+			trailer[name] = nil
+		}
+	}
+
+	chunks := make([]response.Chunk, len(sizes))
+	for i, size := range sizes {
+		chunks[i].Data = bytes.Repeat([]byte{byte('a' + i%26)}, size)
+		if i > 0 {
+			chunks[i].Delay = delay
+		}
+		if len(extensions) == 1 {
+			chunks[i].Extension = extensions[0]
+		} else if len(extensions) > 1 {
+			chunks[i].Extension = extensions[i]
+		}
+	}
+
+	return response.Response{
+		Header: http.Header{
+			c.ContentType: {"text/plain; charset=utf-8"},
+		},
+		Chunks:  chunks,
+		Trailer: trailer,
+	}
+}
+
+func parseSizes(value string) ([]int, error) {
+	if value == "" {
+		value = "10,10,10"
+	}
+
+	parts := strings.Split(value, ",")
+	if len(parts) > maxChunkCount {
+		return nil, fmt.Errorf("at most %d chunks are allowed", maxChunkCount)
+	}
+
+	sizes := make([]int, len(parts))
+	total := 0
+	for i, part := range parts {
+		size, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil || size < 1 || size > maxChunkSize {
+			return nil, fmt.Errorf("chunk sizes must be between 1 and %d, got '%s'", maxChunkSize, part)
+		}
+		sizes[i] = size
+		total += size
+	}
+
+	if total > maxTotalSize {
+		return nil, fmt.Errorf("total size of chunks must be at most %d", maxTotalSize)
+	}
+
+	return sizes, nil
+}
+
+// isValidExtension checks that the extension doesn't have characters that'd break the chunk framing. It's otherwise not
+// validated, so that clients can test how they handle unusual extensions.
+func isValidExtension(ext string) bool {
+	for _, ch := range []byte(ext) {
+		if ch < ' ' && ch != '\t' || ch == 0x7f {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,52 @@
+package compression
+
+import (
+	"net/http"
+
+	"github.com/sharat87/httpbun/c"
+	"github.com/sharat87/httpbun/ex"
+	"github.com/sharat87/httpbun/response"
+	"github.com/sharat87/httpbun/routes/responses"
+)
+
+const CompressionRoute = `/(?P<encoding>gzip|deflate|brotli|zstd)`
+
+var RouteList = []ex.Route{
+	ex.NewRoute(CompressionRoute, handleCompressed),
+}
+
+// Content coding tokens, for the endpoint names that don't match them.
+var encodingTokens = map[string]string{
+	"brotli": "br",
+}
+
+func handleCompressed(ex *ex.Exchange) response.Response {
+	encoding := ex.Field("encoding")
+	if token, ok := encodingTokens[encoding]; ok {
+		encoding = token
+	}
+
+	info, err := responses.InfoJSON(ex)
+	if err != nil {
+		return response.BadRequest("%s", err.Error())
+	}
+
+	header := http.Header{}
+
+	// The `label` query param sets the `Content-Encoding` header to something other than the actual encoding of the
+	// body. An empty `label` drops the header altogether.
+	if labels, ok := ex.Request.URL.Query()["label"]; ok {
+		header[c.ContentEncoding] = []string{}
+		for _, label := range labels {
+			if label != "" {
+				header.Add(c.ContentEncoding, label)
+			}
+		}
+	}
+
+	return response.Response{
+		Header:          header,
+		Body:            info,
+		ContentEncoding: encoding,
+	}
+}
@@ -0,0 +1,170 @@
+package cookies
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SetAttributes sets attributes on the cookie, given separated by `;`, like in a `Set-Cookie` header. For example,
+// `Max-Age=60; Secure; SameSite=None`. Unknown or invalid attributes are an error.
+func SetAttributes(cookie *http.Cookie, attributes string) error {
+	for _, attribute := range strings.Split(attributes, ";") {
+		attrName, attrValue, _ := strings.Cut(strings.TrimSpace(attribute), "=")
+		if attrName == "" {
+			continue
+		}
+		if err := setAttribute(cookie, strings.TrimSpace(attrName), strings.TrimSpace(attrValue)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func setAttribute(cookie *http.Cookie, name, value string) error {
+	switch strings.ToLower(name) {
+	case "domain":
+		cookie.Domain = value
+
+	case "path":
+		cookie.Path = value
+
+	case "expires":
+		expires, err := ParseExpires(value)
+		if err != nil {
+			return err
+		}
+		cookie.Expires = expires
+
+	case "max-age":
+		maxAge, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("invalid Max-Age %q", value)
+		}
+		cookie.MaxAge = maxAge
+		if maxAge <= 0 {
+			// This will produce `Max-Age=0` in the cookie.
+			cookie.MaxAge = -1
+		}
+
+	case "secure":
+		cookie.Secure = true
+
+	case "httponly":
+		cookie.HttpOnly = true
+
+	case "partitioned":
+		cookie.Partitioned = true
+
+	case "samesite":
+		sameSite, err := ParseSameSite(value)
+		if err != nil {
+			return err
+		}
+		cookie.SameSite = sameSite
+
+	default:
+		return fmt.Errorf("unknown cookie attribute %q", name)
+
+	}
+
+	return nil
+}
+
+// ParseExpires parses an expiry time given as an HTTP date, or as a number of seconds from now, which can be negative,
+// to set an already expired cookie.
+func ParseExpires(value string) (time.Time, error) {
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return time.Now().Add(time.Duration(seconds) * time.Second).UTC(), nil
+	}
+	expires, err := http.ParseTime(value)
+	if err != nil {
+		return expires, fmt.Errorf("invalid Expires %q, should be an HTTP date, or seconds from now", value)
+	}
+	return expires, nil
+}
+
+func ParseSameSite(value string) (http.SameSite, error) {
+	switch strings.ToLower(value) {
+	case "strict":
+		return http.SameSiteStrictMode, nil
+	case "lax":
+		return http.SameSiteLaxMode, nil
+	case "none":
+		return http.SameSiteNoneMode, nil
+	}
+	return 0, fmt.Errorf("invalid SameSite %q, should be Strict, Lax or None", value)
+}
+
+// cookieJSON is a cookie given in a JSON request body.
+type cookieJSON struct {
+	Name        string `json:"name"`
+	Value       string `json:"value"`
+	Domain      string `json:"domain"`
+	Path        string `json:"path"`
+	Expires     string `json:"expires"`
+	MaxAge      *int   `json:"maxAge"`
+	Secure      bool   `json:"secure"`
+	HttpOnly    bool   `json:"httpOnly"`
+	SameSite    string `json:"sameSite"`
+	Partitioned bool   `json:"partitioned"`
+}
+
+func (c cookieJSON) toCookie() (http.Cookie, error) {
+	if c.Name == "" {
+		return http.Cookie{}, fmt.Errorf("cookie name is required")
+	}
+
+	cookie := http.Cookie{
+		Name:        c.Name,
+		Value:       c.Value,
+		Domain:      c.Domain,
+		Path:        c.Path,
+		Secure:      c.Secure,
+		HttpOnly:    c.HttpOnly,
+		Partitioned: c.Partitioned,
+	}
+
+	if cookie.Path == "" {
+		cookie.Path = "/"
+	}
+
+	if c.Expires != "" {
+		if err := setAttribute(&cookie, "expires", c.Expires); err != nil {
+			return cookie, err
+		}
+	}
+
+	if c.MaxAge != nil {
+		if err := setAttribute(&cookie, "max-age", strconv.Itoa(*c.MaxAge)); err != nil {
+			return cookie, err
+		}
+	}
+
+	if c.SameSite != "" {
+		if err := setAttribute(&cookie, "samesite", c.SameSite); err != nil {
+			return cookie, err
+		}
+	}
+
+	return cookie, nil
+}
+
+// malformedCookies are `Set-Cookie` lines that are broken in different ways, by kind.
+var malformedCookies = map[string]string{
+	"no-equals":              "malformed_no_equals",
+	"empty-name":             "=malformed_empty_name",
+	"quoted-value":           `malformed_quoted="a b"; Path=/`,
+	"invalid-chars":          "malformed_invalid_chars=a,b\\c; Path=/",
+	"bad-expires":            "malformed_bad_expires=1; Path=/; Expires=not-a-date",
+	"bad-max-age":            "malformed_bad_max_age=1; Path=/; Max-Age=soon",
+	"duplicate-attributes":   "malformed_duplicate_attributes=1; Path=/one; Path=/; Max-Age=60; Max-Age=0",
+	"unknown-samesite":       "malformed_unknown_samesite=1; Path=/; SameSite=Sometimes",
+	"samesite-none-insecure": "malformed_samesite_none_insecure=1; Path=/; SameSite=None",
+	"partitioned-insecure":   "malformed_partitioned_insecure=1; Path=/; Partitioned",
+	"domain-mismatch":        "malformed_domain_mismatch=1; Path=/; Domain=not-this-host.invalid",
+	"oversized":              "malformed_oversized=" + strings.Repeat("x", 5000) + "; Path=/",
+}
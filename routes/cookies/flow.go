@@ -0,0 +1,244 @@
+package cookies
+
+import (
+	"net"
+	"net/http"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/sharat87/httpbun/ex"
+	"github.com/sharat87/httpbun/response"
+	"github.com/sharat87/httpbun/util"
+)
+
+const (
+	CookiesFlowRoute = `/cookies/flow/(?P<steps>\d+)(/(?P<step>\d+))?/?`
+
+	// Maximum number of hops in a flow. Each hop sets a cookie of every kind.
+	maxFlowSteps = 10
+)
+
+var flowRunPattern = regexp.MustCompile(`^[0-9a-f]{1,64}$`)
+
+// flowCookieKind is a cookie set on every hop of a flow, scoped so that a correct cookie jar either sends it back on
+// the final step, or doesn't.
+type flowCookieKind struct {
+	Name string
+
+	// The rule that this cookie checks, in the final report.
+	Rule string
+
+	// Scope sets the attributes on the cookie. The path is that of the flow endpoints, unless changed here.
+	Scope func(cookie *http.Cookie)
+
+	// Expected tells if the cookie should come back on the final step, which may depend on the origin being secure.
+	Expected func(isSecure bool) bool
+}
+
+func always(bool) bool {
+	return true
+}
+
+func never(bool) bool {
+	return false
+}
+
+var flowCookieKinds = []flowCookieKind{
+	{
+		// Path matching the final step.
+		Name:     "path",
+		Rule:     "path",
+		Scope:    func(cookie *http.Cookie) {},
+		Expected: always,
+	},
+	{
+		// A path that's a string prefix of the final step's path, but doesn't path-match it, as per RFC 6265, 5.1.4.
+		Name: "prefix",
+		Rule: "path",
+		Scope: func(cookie *http.Cookie) {
+			cookie.Path = strings.TrimSuffix(cookie.Path, "ow")
+		},
+		Expected: never,
+	},
+	{
+		Name: "persistent",
+		Rule: "expiry",
+		Scope: func(cookie *http.Cookie) {
+			cookie.MaxAge = 300
+		},
+		Expected: always,
+	},
+	{
+		Name: "expired",
+		Rule: "expiry",
+		Scope: func(cookie *http.Cookie) {
+			cookie.MaxAge = -1
+		},
+		Expected: never,
+	},
+	{
+		// Clients shouldn't store secure cookies set over plain HTTP, nor send them over it. Localhost is taken to be
+		// secure though, like browsers do.
+		Name: "secure",
+		Rule: "secure",
+		Scope: func(cookie *http.Cookie) {
+			cookie.Secure = true
+		},
+		Expected: func(isSecure bool) bool {
+			return isSecure
+		},
+	},
+	{
+		// Without a `Domain` attribute, the cookie is host-only, and should be sent back to this host.
+		Name:     "host",
+		Rule:     "hostOnly",
+		Scope:    func(cookie *http.Cookie) {},
+		Expected: always,
+	},
+	{
+		// A domain that this host isn't in, so the cookie should be rejected.
+		Name: "foreign",
+		Rule: "hostOnly",
+		Scope: func(cookie *http.Cookie) {
+			cookie.Domain = "not-this-host.invalid"
+		},
+		Expected: never,
+	},
+}
+
+// FlowRuleResult is the outcome of checking the cookies under one rule, on the final step of a flow.
+type FlowRuleResult struct {
+	Pass       bool     `json:"pass"`
+	Expected   []string `json:"expected"`
+	Missing    []string `json:"missing"`
+	Unexpected []string `json:"unexpected"`
+}
+
+// handleCookiesFlow runs a flow of redirects, setting scoped cookies on each hop. The final step reports which of them
+// came back, against which should have. Cookies are told apart from those of other runs, by having the run ID as their
+// value.
+func handleCookiesFlow(ex *ex.Exchange) response.Response {
+	steps, err := strconv.Atoi(ex.Field("steps"))
+	if err != nil || steps < 1 || steps > maxFlowSteps {
+		return response.BadRequest("Number of steps should be between 1 and %d", maxFlowSteps)
+	}
+
+	step := 1
+	if value := ex.Field("step"); value != "" {
+		step, err = strconv.Atoi(value)
+		if err != nil || step < 1 || step > steps+1 {
+			return response.BadRequest("Step should be between 1 and %d", steps+1)
+		}
+	}
+
+	run := ex.Request.URL.Query().Get("run")
+	if !flowRunPattern.MatchString(run) {
+		if step > 1 {
+			return response.BadRequest("Missing or invalid run ID, start the flow at /cookies/flow/%d", steps)
+		}
+		run = util.RandomString()
+	}
+
+	flowPath := ex.ServerSpec.PathPrefix + "/cookies/flow"
+
+	if step <= steps {
+		res := ex.RedirectResponse("/cookies/flow/" + strconv.Itoa(steps) + "/" + strconv.Itoa(step+1) + "?run=" + run)
+		for _, kind := range flowCookieKinds {
+			cookie := http.Cookie{
+				Name:  flowCookieName(step, kind.Name),
+				Value: run,
+				Path:  flowPath,
+			}
+			kind.Scope(&cookie)
+			res.Cookies = append(res.Cookies, cookie)
+		}
+		return *res
+	}
+
+	isSecure := isSecureOrigin(ex)
+
+	received := []string{}
+	for _, cookie := range ex.Request.Cookies() {
+		if strings.HasPrefix(cookie.Name, "flow") && cookie.Value == run {
+			received = append(received, cookie.Name)
+		}
+	}
+	slices.Sort(received)
+	received = slices.Compact(received)
+
+	expected := []string{}
+	missing := []string{}
+	unexpected := []string{}
+	rules := map[string]*FlowRuleResult{}
+	pass := true
+
+	for hop := 1; hop <= steps; hop++ {
+		for _, kind := range flowCookieKinds {
+			rule := rules[kind.Rule]
+			if rule == nil {
+				rule = &FlowRuleResult{Pass: true, Expected: []string{}, Missing: []string{}, Unexpected: []string{}}
+				rules[kind.Rule] = rule
+			}
+
+			name := flowCookieName(hop, kind.Name)
+			isExpected := kind.Expected(isSecure)
+			isReceived := slices.Contains(received, name)
+
+			if isExpected {
+				expected = append(expected, name)
+				rule.Expected = append(rule.Expected, name)
+			}
+
+			if isExpected && !isReceived {
+				missing = append(missing, name)
+				rule.Missing = append(rule.Missing, name)
+			} else if !isExpected && isReceived {
+				unexpected = append(unexpected, name)
+				rule.Unexpected = append(rule.Unexpected, name)
+			} else {
+				continue
+			}
+
+			rule.Pass = false
+			pass = false
+		}
+	}
+
+	return response.Response{
+		Body: map[string]any{
+			"run":        run,
+			"steps":      steps,
+			"scheme":     ex.FindScheme(),
+			"secure":     isSecure,
+			"received":   received,
+			"expected":   expected,
+			"missing":    missing,
+			"unexpected": unexpected,
+			"rules":      rules,
+			"pass":       pass,
+		},
+	}
+}
+
+// isSecureOrigin tells if the request is over HTTPS, or to localhost, which browsers treat as a secure origin.
+func isSecureOrigin(ex *ex.Exchange) bool {
+	if ex.FindScheme() == "https" {
+		return true
+	}
+
+	host := ex.Request.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	if strings.EqualFold(host, "localhost") || strings.HasSuffix(strings.ToLower(host), ".localhost") {
+		return true
+	}
+	ip := net.ParseIP(strings.Trim(host, "[]"))
+	return ip != nil && ip.IsLoopback()
+}
+
+func flowCookieName(step int, kind string) string {
+	return "flow" + strconv.Itoa(step) + "_" + kind
+}
@@ -1,23 +1,33 @@
 package cookies
 
 import (
+	"bytes"
+	"encoding/json"
+	"maps"
+	"mime"
 	"net/http"
+	"slices"
+	"strings"
 	"time"
 
+	"github.com/sharat87/httpbun/c"
 	"github.com/sharat87/httpbun/ex"
 	"github.com/sharat87/httpbun/response"
 )
 
 const (
-	CookiesRoute       = `/cookies?`
-	CookiesDeleteRoute = `/cookies?/delete`
-	CookiesSetRoute    = `/cookies?/set(/(?P<name>[^/]+)/(?P<value>[^/]+))?`
+	CookiesRoute          = `/cookies?`
+	CookiesDeleteRoute    = `/cookies?/delete`
+	CookiesSetRoute       = `/cookies?/set(/(?P<name>[^/]+)/(?P<value>[^/]+))?`
+	CookiesMalformedRoute = `/cookies?/malformed(/(?P<kind>[\w-]+))?`
 )
 
 var RouteList = []ex.Route{
 	ex.NewRoute(CookiesRoute, handleCookies),
 	ex.NewRoute(CookiesDeleteRoute, handleCookiesDelete),
 	ex.NewRoute(CookiesSetRoute, handleCookiesSet),
+	ex.NewRoute(CookiesMalformedRoute, handleCookiesMalformed),
+	ex.NewRoute(CookiesFlowRoute, handleCookiesFlow),
 }
 
 func handleCookies(ex *ex.Exchange) response.Response {
@@ -46,24 +56,62 @@ func handleCookiesDelete(ex *ex.Exchange) response.Response {
 	return *res
 }
 
+// handleCookiesSet sets cookies from query params, the path, or a JSON body. Attributes for the cookies from the query
+// and the path are given in `attr` query params, like `attr=Max-Age%3D60&attr=Secure`, and apply to all of them.
 func handleCookiesSet(ex *ex.Exchange) response.Response {
 	var cookies []http.Cookie
+	query := ex.Request.URL.Query()
 
-	if ex.Field("name") == "" {
-		for name, values := range ex.Request.URL.Query() {
+	if mediaType, _, _ := mime.ParseMediaType(ex.Request.Header.Get(c.ContentType)); mediaType == c.ApplicationJSON {
+		body := bytes.TrimSpace(ex.BodyBytes())
+		var specs []cookieJSON
+		if bytes.HasPrefix(body, []byte("[")) {
+			if err := json.Unmarshal(body, &specs); err != nil {
+				return response.BadRequest("Invalid JSON body: %s", err.Error())
+			}
+		} else {
+			var spec cookieJSON
+			if err := json.Unmarshal(body, &spec); err != nil {
+				return response.BadRequest("Invalid JSON body: %s", err.Error())
+			}
+			specs = append(specs, spec)
+		}
+		for _, spec := range specs {
+			cookie, err := spec.toCookie()
+			if err != nil {
+				return response.BadRequest("%s", err.Error())
+			}
+			cookies = append(cookies, cookie)
+		}
+
+	} else {
+		if ex.Field("name") != "" {
 			cookies = append(cookies, http.Cookie{
-				Name:  name,
-				Value: values[0],
+				Name:  ex.Field("name"),
+				Value: ex.Field("value"),
 				Path:  "/",
 			})
+
+		} else {
+			for name, values := range query {
+				if name != "attr" {
+					cookies = append(cookies, http.Cookie{
+						Name:  name,
+						Value: values[0],
+						Path:  "/",
+					})
+				}
+			}
+
 		}
 
-	} else {
-		cookies = append(cookies, http.Cookie{
-			Name:  ex.Field("name"),
-			Value: ex.Field("value"),
-			Path:  "/",
-		})
+		for i := range cookies {
+			for _, attributes := range query["attr"] {
+				if err := SetAttributes(&cookies[i], attributes); err != nil {
+					return response.BadRequest("%s", err.Error())
+				}
+			}
+		}
 
 	}
 
@@ -72,3 +120,32 @@ func handleCookiesSet(ex *ex.Exchange) response.Response {
 
 	return *res
 }
+
+// handleCookiesMalformed sends deliberately malformed `Set-Cookie` headers, of the given kind, or of all kinds. Lines
+// given in `line` query params are sent as is.
+func handleCookiesMalformed(ex *ex.Exchange) response.Response {
+	var lines []string
+
+	if kind := ex.Field("kind"); kind != "" {
+		line, ok := malformedCookies[kind]
+		if !ok {
+			return response.BadRequest("Unknown kind %q, should be one of: %s", kind, strings.Join(slices.Sorted(maps.Keys(malformedCookies)), ", "))
+		}
+		lines = append(lines, line)
+	} else if custom := ex.Request.URL.Query()["line"]; len(custom) > 0 {
+		lines = custom
+	} else {
+		for _, kind := range slices.Sorted(maps.Keys(malformedCookies)) {
+			lines = append(lines, malformedCookies[kind])
+		}
+	}
+
+	return response.Response{
+		Header: http.Header{
+			"Set-Cookie": lines,
+		},
+		Body: map[string]any{
+			"setCookie": lines,
+		},
+	}
+}
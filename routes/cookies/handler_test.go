@@ -1,7 +1,9 @@
 package cookies
 
 import (
+	"io"
 	"net/http"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/suite"
@@ -143,3 +145,163 @@ func (s *CookiesSuite) TestSetCookiesWithNameAndValueInQueryMultiple() {
 	s.Contains(expected, resp.Cookies[0].String())
 	s.Contains(expected, resp.Cookies[1].String())
 }
+
+func (s *CookiesSuite) TestSetCookiesWithAttributesInQuery() {
+	resp := ex.InvokeHandlerForTest(
+		"cookies/set?foo=bar&attr=Domain%3Dexample.com%3B+Path%3D%2Fapp%3B+Max-Age%3D60&attr=Secure&attr=HttpOnly&attr=SameSite%3DNone&attr=Partitioned",
+		http.Request{},
+		CookiesSetRoute,
+		handleCookiesSet,
+	)
+
+	s.Equal(302, resp.Status)
+	s.Equal(1, len(resp.Cookies))
+	s.Equal("foo=bar; Path=/app; Domain=example.com; Max-Age=60; HttpOnly; Secure; SameSite=None; Partitioned", resp.Cookies[0].String())
+}
+
+func (s *CookiesSuite) TestSetCookiesWithAttributesInPath() {
+	resp := ex.InvokeHandlerForTest(
+		"cookies/set/foo/bar?attr=SameSite%3Dstrict%3BExpires%3DWed,+01+Jan+2031+00:00:00+GMT",
+		http.Request{},
+		CookiesSetRoute,
+		handleCookiesSet,
+	)
+
+	s.Equal(302, resp.Status)
+	s.Equal(1, len(resp.Cookies))
+	s.Equal("foo=bar; Path=/; Expires=Wed, 01 Jan 2031 00:00:00 GMT; SameSite=Strict", resp.Cookies[0].String())
+}
+
+func (s *CookiesSuite) TestSetCookiesWithInvalidAttribute() {
+	for _, query := range []string{"foo=bar&attr=SameSite%3DSometimes", "foo=bar&attr=Max-Age%3Dsoon", "foo=bar&attr=Color%3Dblue"} {
+		resp := ex.InvokeHandlerForTest(
+			"cookies/set?"+query,
+			http.Request{},
+			CookiesSetRoute,
+			handleCookiesSet,
+		)
+		s.Equal(400, resp.Status, query)
+	}
+}
+
+func (s *CookiesSuite) TestSetCookiesWithJSONBody() {
+	resp := ex.InvokeHandlerForTest(
+		"cookies/set",
+		http.Request{
+			Method: http.MethodPost,
+			Header: http.Header{"Content-Type": {"application/json"}},
+			Body: io.NopCloser(strings.NewReader(`[
+				{"name": "a", "value": "1", "maxAge": 0},
+				{"name": "b", "value": "2", "path": "/x", "secure": true, "sameSite": "lax", "httpOnly": true}
+			]`)),
+		},
+		CookiesSetRoute,
+		handleCookiesSet,
+	)
+
+	s.Equal(302, resp.Status)
+	s.Equal(2, len(resp.Cookies))
+	s.Equal("a=1; Path=/; Max-Age=0", resp.Cookies[0].String())
+	s.Equal("b=2; Path=/x; HttpOnly; Secure; SameSite=Lax", resp.Cookies[1].String())
+}
+
+func (s *CookiesSuite) TestSetCookiesKeepsSemicolonsInPlainValues() {
+	resp := ex.InvokeHandlerForTest(
+		"cookies/set?foo=a%3Bb%3DColor",
+		http.Request{},
+		CookiesSetRoute,
+		handleCookiesSet,
+	)
+
+	s.Equal(302, resp.Status)
+	s.Equal(1, len(resp.Cookies))
+	s.Equal("foo", resp.Cookies[0].Name)
+	s.Equal("a;b=Color", resp.Cookies[0].Value)
+}
+
+func (s *CookiesSuite) TestSetCookiesIgnoresNonJSONBody() {
+	resp := ex.InvokeHandlerForTest(
+		"cookies/set?foo=bar",
+		http.Request{
+			Method: http.MethodPost,
+			Header: http.Header{"Content-Type": {"application/x-www-form-urlencoded"}},
+			Body:   io.NopCloser(strings.NewReader("a=1")),
+		},
+		CookiesSetRoute,
+		handleCookiesSet,
+	)
+
+	s.Equal(302, resp.Status)
+	s.Equal(1, len(resp.Cookies))
+	s.Equal("foo=bar; Path=/", resp.Cookies[0].String())
+}
+
+func (s *CookiesSuite) TestMalformedCookies() {
+	resp := ex.InvokeHandlerForTest(
+		"cookies/malformed/bad-expires",
+		http.Request{},
+		CookiesMalformedRoute,
+		handleCookiesMalformed,
+	)
+
+	s.Equal([]string{"malformed_bad_expires=1; Path=/; Expires=not-a-date"}, resp.Header.Values("Set-Cookie"))
+
+	resp = ex.InvokeHandlerForTest(
+		"cookies/malformed",
+		http.Request{},
+		CookiesMalformedRoute,
+		handleCookiesMalformed,
+	)
+
+	s.Equal(len(malformedCookies), len(resp.Header.Values("Set-Cookie")))
+}
+
+func (s *CookiesSuite) TestCookiesFlowHop() {
+	resp := ex.InvokeHandlerForTest(
+		"cookies/flow/2/2?run=abc",
+		http.Request{},
+		CookiesFlowRoute,
+		handleCookiesFlow,
+	)
+
+	s.Equal(http.StatusFound, resp.Status)
+	s.Equal("/cookies/flow/2/3?run=abc", resp.Header.Get("Location"))
+	s.Len(resp.Cookies, len(flowCookieKinds))
+	for _, cookie := range resp.Cookies {
+		s.True(strings.HasPrefix(cookie.Name, "flow2_"))
+		s.Equal("abc", cookie.Value)
+	}
+}
+
+func (s *CookiesSuite) TestCookiesFlowReport() {
+	resp := ex.InvokeHandlerForTest(
+		"cookies/flow/1/2?run=abc",
+		http.Request{
+			Header: http.Header{
+				"Cookie": []string{"flow1_path=abc; flow1_persistent=abc; flow1_secure=abc; flow1_prefix=old"},
+			},
+		},
+		CookiesFlowRoute,
+		handleCookiesFlow,
+	)
+
+	s.Equal(0, resp.Status)
+	body := resp.Body.(map[string]any)
+	s.Equal(false, body["pass"])
+	s.Equal([]string{"flow1_path", "flow1_persistent", "flow1_secure"}, body["received"])
+	s.Equal([]string{"flow1_host"}, body["missing"])
+	s.Equal([]string{"flow1_secure"}, body["unexpected"])
+
+	rules := body["rules"].(map[string]*FlowRuleResult)
+	s.True(rules["path"].Pass)
+	s.True(rules["expiry"].Pass)
+	s.False(rules["secure"].Pass)
+	s.False(rules["hostOnly"].Pass)
+}
+
+func (s *CookiesSuite) TestCookiesFlowInvalid() {
+	for _, path := range []string{"cookies/flow/0", "cookies/flow/11", "cookies/flow/2/4?run=abc", "cookies/flow/2/2"} {
+		resp := ex.InvokeHandlerForTest(path, http.Request{}, CookiesFlowRoute, handleCookiesFlow)
+		s.Equal(http.StatusBadRequest, resp.Status, path)
+	}
+}
@@ -1,18 +1,27 @@
 package headers
 
 import (
+	"bytes"
 	"fmt"
 	"net/http"
+	"strings"
 
 	"github.com/sharat87/httpbun/c"
 	"github.com/sharat87/httpbun/ex"
 	"github.com/sharat87/httpbun/response"
+	"github.com/sharat87/httpbun/server/wire"
 	"github.com/sharat87/httpbun/util"
 )
 
 var RouteList = []ex.Route{
 	ex.NewRoute("/headers", handleHeaders),
 	ex.NewRoute("/(response|respond-with)-headers?/?", handleResponseHeaders),
+	ex.NewRoute(`/raw(\.(?P<format>txt))?`, handleRaw),
+}
+
+type rawHeader struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
 }
 
 func handleHeaders(ex *ex.Exchange) response.Response {
@@ -54,3 +63,45 @@ func handleResponseHeaders(ex *ex.Exchange) response.Response {
 		Body:   jsonContent,
 	}
 }
+
+func handleRaw(ex *ex.Exchange) response.Response {
+	recorder := wire.FromContext(ex.Request.Context())
+	if recorder == nil || ex.Request.ProtoMajor != 1 {
+		return response.Response{
+			Status: http.StatusNotImplemented,
+			Body:   "Raw request capture is only available for HTTP/1.x requests over plain connections.",
+		}
+	}
+
+	// Read the body, so that it's part of the recording as well.
+	ex.BodyBytes()
+	raw, truncated := recorder.Bytes()
+
+	if ex.Field("format") == "txt" {
+		return response.New(http.StatusOK, http.Header{
+			c.ContentType: []string{c.TextPlain},
+		}, raw)
+	}
+
+	head, body, found := bytes.Cut(raw, []byte("\r\n\r\n"))
+	if !found {
+		head, body, _ = bytes.Cut(raw, []byte("\n\n"))
+	}
+
+	lines := strings.Split(strings.ReplaceAll(string(head), "\r\n", "\n"), "\n")
+	headers := []rawHeader{}
+	for _, line := range lines[1:] {
+		name, value, _ := strings.Cut(line, ":")
+		headers = append(headers, rawHeader{name, strings.TrimLeft(value, " \t")})
+	}
+
+	return response.Response{
+		Body: map[string]any{
+			"raw":         string(raw),
+			"requestLine": lines[0],
+			"headers":     headers,
+			"body":        string(body),
+			"truncated":   truncated,
+		},
+	}
+}
@@ -0,0 +1,162 @@
+package http2
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/http2"
+
+	"github.com/sharat87/httpbun/ex"
+	"github.com/sharat87/httpbun/response"
+	"github.com/sharat87/httpbun/server/goaway"
+)
+
+// Limits on the header lists generated by `/http2/headers`.
+const (
+	maxHeaderCount     = 10000
+	maxHeaderValueSize = 16 << 10
+	maxHeaderListSize  = 1 << 20
+)
+
+var RouteList = []ex.Route{
+	ex.NewRoute(`/trailers/?`, handleTrailers),
+	ex.NewRoute(`/http2/reset(/(?P<code>[^/]+))?/?`, handleReset),
+	ex.NewRoute(`/http2/goaway/(?P<after>\d+)(/(?P<code>[^/]+))?/?`, handleGoAway),
+	ex.NewRoute(`/http2/headers/(?P<count>\d+)/?`, handleHeaders),
+}
+
+// handleTrailers responds with the query params as trailers.
+func handleTrailers(ex *ex.Exchange) response.Response {
+	trailer := http.Header{}
+	for name, values := range ex.Request.URL.Query() {
+		for _, value := range values {
+			trailer.Add(name, value)
+		}
+	}
+
+	return response.Response{
+		Body: map[string]any{
+			"protocol": ex.Request.Proto,
+			"trailers": trailer,
+		},
+		Trailer: trailer,
+	}
+}
+
+func needsHTTP2(ex *ex.Exchange) *response.Response {
+	if ex.Request.ProtoMajor == 2 {
+		return nil
+	}
+	return &response.Response{
+		Status: http.StatusBadRequest,
+		Body:   fmt.Sprintf("This endpoint needs HTTP/2, but the request came over %s.\n", ex.Request.Proto),
+	}
+}
+
+// handleReset sends the response headers and a bit of the body, and then resets the stream. The HTTP/2 server in
+// `net/http` resets the stream of a handler that aborts, with `INTERNAL_ERROR`. Other error codes are only available
+// on the goaway listener, where the code in that `RST_STREAM` is rewritten.
+func handleReset(ex *ex.Exchange) response.Response {
+	if resp := needsHTTP2(ex); resp != nil {
+		return *resp
+	}
+
+	code := http2.ErrCodeInternal
+	if value := ex.Field("code"); value != "" {
+		var ok bool
+		if code, ok = parseErrCode(value); !ok {
+			return response.BadRequest("Invalid error code %q, should be a name like CANCEL, or a number.\n", value)
+		}
+	}
+
+	if code != http2.ErrCodeInternal && !goaway.Reset(ex.Request.Context(), code) {
+		return response.BadRequest("Error codes other than INTERNAL_ERROR are only available over cleartext HTTP/2 with prior knowledge, on the listener set with --goaway-bind.\n")
+	}
+
+	return response.Response{
+		Writer: func(w response.BodyWriter) {
+			_ = w.Write("This stream will be reset.\n")
+			panic(http.ErrAbortHandler)
+		},
+	}
+}
+
+// handleGoAway responds normally, and has GOAWAY sent on the connection, after this and the given number of responses
+// on it, with the given error code. This is only available on the listener set with `--goaway-bind`, since it's done
+// by shutting down the server of the connection.
+func handleGoAway(ex *ex.Exchange) response.Response {
+	if resp := needsHTTP2(ex); resp != nil {
+		return *resp
+	}
+
+	after, err := strconv.Atoi(ex.Field("after"))
+	if err != nil {
+		return response.BadRequest("%s", err.Error())
+	}
+
+	code := http2.ErrCodeNo
+	if value := ex.Field("code"); value != "" {
+		var ok bool
+		if code, ok = parseErrCode(value); !ok {
+			return response.BadRequest("Invalid error code %q, should be a name like ENHANCE_YOUR_CALM, or a number.\n", value)
+		}
+	}
+
+	if !goaway.After(ex.Request.Context(), after, code) {
+		return response.BadRequest("This endpoint is only available over cleartext HTTP/2 with prior knowledge, on the listener set with --goaway-bind.\n")
+	}
+
+	return response.Response{
+		Body: map[string]any{
+			"goawayAfter": after,
+			"code":        code.String(),
+		},
+	}
+}
+
+// parseErrCode parses an HTTP/2 error code, given by its name, like `CANCEL`, or its number.
+func parseErrCode(value string) (http2.ErrCode, bool) {
+	for code := http2.ErrCodeNo; code <= http2.ErrCodeHTTP11Required; code++ {
+		if strings.EqualFold(value, code.String()) {
+			return code, true
+		}
+	}
+
+	n, err := strconv.ParseUint(value, 10, 32)
+	return http2.ErrCode(n), err == nil
+}
+
+// handleHeaders responds with the given number of headers, to exercise HPACK with large header lists.
+func handleHeaders(ex *ex.Exchange) response.Response {
+	count, err := strconv.Atoi(ex.Field("count"))
+	if err != nil || count > maxHeaderCount {
+		return response.BadRequest("count must be at most %d", maxHeaderCount)
+	}
+
+	size, err := ex.QueryParamInt("size", 32)
+	if err != nil {
+		return response.BadRequest("%s", err.Error())
+	} else if size < 1 || size > maxHeaderValueSize {
+		return response.BadRequest("size must be between 1 and %d", maxHeaderValueSize)
+	} else if count*size > maxHeaderListSize {
+		return response.BadRequest("count times size must be at most %d", maxHeaderListSize)
+	}
+
+	header := http.Header{}
+	for i := range count {
+		// Values are the same across requests, so that the dynamic table gets used on repeated requests.
+		value := strings.Repeat(strconv.Itoa(i%10), size)
+		header.Set(fmt.Sprintf("X-Httpbun-Header-%d", i), value)
+	}
+
+	return response.Response{
+		Header: header,
+		Body: map[string]any{
+			"protocol": ex.Request.Proto,
+			"count":    count,
+			"size":     size,
+		},
+	}
+}
@@ -0,0 +1,134 @@
+package informational
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/sharat87/httpbun/ex"
+	"github.com/sharat87/httpbun/response"
+)
+
+const (
+	maxEarlyHints = 10
+	maxDelay      = 10 * time.Second
+
+	// Maximum number of request body bytes read by `/continue`. Anything beyond is left unread.
+	maxUploadSize = 100 << 20
+)
+
+var RouteList = []ex.Route{
+	ex.NewRoute(`/early-hints/?`, handleEarlyHints),
+	ex.NewRoute(`/continue(/(?P<mode>accept|reject))?/?`, handleContinue),
+	ex.NewRoute(`/continue/delay/(?P<delay>[^/]+)/?`, handleContinue),
+	ex.NewRoute(`/continue/final/(?P<status>\d{3})/?`, handleFinalWithoutBody),
+}
+
+// handleEarlyHints sends `103 Early Hints` responses with the given `Link` headers, before the final response.
+func handleEarlyHints(ex *ex.Exchange) response.Response {
+	count, err := ex.QueryParamInt("count", 1)
+	if err != nil {
+		return response.BadRequest("%s", err.Error())
+	} else if count < 1 || count > maxEarlyHints {
+		return response.BadRequest("count must be between 1 and %d", maxEarlyHints)
+	}
+
+	delay, err := parseDelay(ex.Request.URL.Query().Get("delay"))
+	if err != nil {
+		return response.BadRequest("%s", err.Error())
+	}
+
+	links := ex.Request.URL.Query()["link"]
+	if len(links) == 0 {
+		links = []string{"<" + ex.ServerSpec.PathPrefix + "/assets/styles.css>; rel=preload; as=style"}
+	}
+
+	interim := make([]response.Interim, count)
+	for i := range interim {
+		interim[i] = response.Interim{
+			Status: http.StatusEarlyHints,
+			Header: http.Header{"Link": links},
+			Delay:  delay,
+		}
+	}
+
+	return response.Response{
+		Interim: interim,
+		Header:  http.Header{"Link": links},
+		Body: map[string]any{
+			"earlyHints": count,
+			"links":      links,
+		},
+	}
+}
+
+// handleContinue reads the request body, and responds with its length. With `Expect: 100-continue`, the `100 Continue`
+// response is sent when the body is first read, which can be delayed, or never sent, by rejecting with 417.
+func handleContinue(ex *ex.Exchange) response.Response {
+	expect := ex.Request.Header.Get("Expect")
+
+	if ex.Field("mode") == "reject" {
+		return response.Response{
+			Status: http.StatusExpectationFailed,
+			Body: map[string]any{
+				"expect": expect,
+			},
+		}
+	}
+
+	delay, err := parseDelay(ex.Field("delay"))
+	if err != nil {
+		return response.BadRequest("%s", err.Error())
+	}
+	time.Sleep(delay)
+
+	length, err := io.Copy(io.Discard, io.LimitReader(ex.Request.Body, maxUploadSize))
+	if err != nil {
+		return response.BadRequest("Error reading body: %s", err.Error())
+	}
+
+	return response.Response{
+		Body: map[string]any{
+			"expect":        expect,
+			"continueDelay": delay.Seconds(),
+			"bodyLength":    length,
+		},
+	}
+}
+
+// handleFinalWithoutBody responds with the given status, without reading any of the request body.
+func handleFinalWithoutBody(ex *ex.Exchange) response.Response {
+	status, err := strconv.Atoi(ex.Field("status"))
+	if err != nil || status < 200 || status > 599 {
+		return response.BadRequest("status must be between 200 and 599")
+	}
+
+	if status == http.StatusNoContent || status == http.StatusNotModified {
+		return response.Response{Status: status}
+	}
+
+	return response.Response{
+		Status: status,
+		Body: map[string]any{
+			"expect":   ex.Request.Header.Get("Expect"),
+			"bodyRead": false,
+		},
+	}
+}
+
+func parseDelay(value string) (time.Duration, error) {
+	if value == "" {
+		return 0, nil
+	}
+	seconds, err := strconv.ParseFloat(value, 64)
+	if err != nil || seconds < 0 {
+		return 0, fmt.Errorf("invalid delay value: '%s'", value)
+	}
+	delay := time.Duration(seconds * float64(time.Second))
+	if delay > maxDelay {
+		return 0, fmt.Errorf("delay must be at most %v", maxDelay)
+	}
+	return delay, nil
+}
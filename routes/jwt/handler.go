@@ -0,0 +1,243 @@
+package jwt
+
+import (
+	"bytes"
+	"encoding/json"
+	"maps"
+	"math"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sharat87/httpbun/c"
+	"github.com/sharat87/httpbun/ex"
+	"github.com/sharat87/httpbun/response"
+	"github.com/sharat87/httpbun/util"
+)
+
+// Secret used for HS256, when none is given.
+const defaultSecret = "httpbun"
+
+// Minimum interval between rotations asked for with /jwt/rotate, since generating keys is expensive.
+const minRotateInterval = time.Minute
+
+// Time of the last rotation asked for with /jwt/rotate.
+var lastRotate struct {
+	mu sync.Mutex
+	at time.Time
+}
+
+var RouteList = []ex.Route{
+	ex.NewRoute(`/jwt/mint/?`, handleMint),
+	ex.NewRoute(`/jwt/verify/?`, handleVerify),
+	ex.NewRoute(`/jwt/rotate/?`, handleRotate),
+	ex.NewRoute(`/\.well-known/jwks\.json`, handleJWKS),
+}
+
+// handleMint signs a token with the claims given in a JSON body, or in the `claims` query param, along with the
+// registered claims given as query params.
+func handleMint(ex *ex.Exchange) response.Response {
+	query := ex.Request.URL.Query()
+	now := time.Now()
+
+	alg := query.Get("alg")
+	if alg == "" {
+		alg = "RS256"
+	}
+
+	claims := map[string]any{
+		"iss": ex.AbsoluteUrl(""),
+		"iat": now.Unix(),
+	}
+
+	if body := bytes.TrimSpace(ex.BodyBytes()); len(body) > 0 {
+		var bodyClaims map[string]any
+		if err := json.Unmarshal(body, &bodyClaims); err != nil {
+			return response.BadRequest("Invalid claims in body, should be a JSON object: %s", err.Error())
+		}
+		maps.Copy(claims, bodyClaims)
+	}
+
+	if value := query.Get("claims"); value != "" {
+		var paramClaims map[string]any
+		if err := json.Unmarshal([]byte(value), &paramClaims); err != nil {
+			return response.BadRequest("Invalid claims param, should be a JSON object: %s", err.Error())
+		}
+		maps.Copy(claims, paramClaims)
+	}
+
+	// Expiry is an hour from now, unless given. The value `none` leaves it out.
+	if _, ok := claims["exp"]; !ok {
+		claims["exp"] = now.Add(time.Hour).Unix()
+	}
+
+	for _, name := range []string{"exp", "nbf"} {
+		value := query.Get(name)
+		if value == "" {
+			continue
+		}
+		if value == "none" {
+			delete(claims, name)
+			continue
+		}
+		seconds, err := strconv.Atoi(value)
+		if err != nil {
+			return response.BadRequest("Invalid %s, should be seconds from now, or none: %s", name, value)
+		}
+		claims[name] = now.Add(time.Duration(seconds) * time.Second).Unix()
+	}
+
+	for _, name := range []string{"iss", "sub", "aud", "jti"} {
+		if values := query[name]; len(values) == 1 {
+			claims[name] = values[0]
+		} else if len(values) > 1 {
+			claims[name] = values
+		}
+	}
+
+	token, err := Sign(alg, claims, SignOptions{
+		Kid:    query.Get("kid"),
+		Secret: findSecret(query),
+	})
+	if err != nil {
+		return response.BadRequest("%s", err.Error())
+	}
+
+	result := Verify(token, VerifyOptions{Secret: findSecret(query)})
+
+	return response.Response{
+		Header: http.Header{
+			"Cache-Control": {"no-store"},
+		},
+		Body: map[string]any{
+			"token":  token,
+			"header": result.Header,
+			"claims": result.Claims,
+		},
+	}
+}
+
+// handleVerify verifies a token given as a bearer token, in the `token` query param, or in a `token` field in a form
+// body. Expected audience and issuer can be given in the `aud` and `iss` query params.
+func handleVerify(ex *ex.Exchange) response.Response {
+	query := ex.Request.URL.Query()
+
+	token := findToken(ex)
+	if token == "" {
+		return response.Response{
+			Status: http.StatusUnauthorized,
+			Header: http.Header{
+				c.WWWAuthenticate: {`Bearer realm="httpbun realm"`},
+			},
+			Body: map[string]any{
+				"valid": false,
+				"error": "missing token, give it in an Authorization header, or in a token query param",
+			},
+		}
+	}
+
+	leeway, err := ex.QueryParamInt("leeway", 0)
+	if err != nil || leeway < 0 {
+		return response.BadRequest("leeway should be a non-negative number of seconds")
+	}
+
+	result := Verify(token, VerifyOptions{
+		Secret:   findSecret(query),
+		Audience: query.Get("aud"),
+		Issuer:   query.Get("iss"),
+		Leeway:   time.Duration(leeway) * time.Second,
+	})
+
+	body := map[string]any{
+		"valid":    result.Valid(),
+		"header":   result.Header,
+		"claims":   result.Claims,
+		"failures": result.Failures,
+	}
+
+	if !result.Valid() {
+		description := result.Failures[0].Check + ": " + result.Failures[0].Error
+		return response.Response{
+			Status: http.StatusUnauthorized,
+			Header: http.Header{
+				c.WWWAuthenticate: {`Bearer realm="httpbun realm", error="invalid_token", error_description=` + strconv.Quote(description)},
+			},
+			Body: body,
+		}
+	}
+
+	return response.Response{Body: body}
+}
+
+func handleRotate(ex *ex.Exchange) response.Response {
+	if ex.Request.Method != http.MethodPost {
+		return response.Response{
+			Status: http.StatusMethodNotAllowed,
+			Header: http.Header{
+				"Allow": {"POST"},
+			},
+		}
+	}
+
+	lastRotate.mu.Lock()
+	wait := time.Until(lastRotate.at.Add(minRotateInterval))
+	if wait <= 0 {
+		lastRotate.at = time.Now()
+	}
+	lastRotate.mu.Unlock()
+
+	if wait > 0 {
+		return response.Response{
+			Status: http.StatusTooManyRequests,
+			Header: http.Header{
+				"Retry-After": {strconv.Itoa(int(math.Ceil(wait.Seconds())))},
+			},
+			Body: "Keys were rotated less than a minute ago, try again in a bit",
+		}
+	}
+
+	Keys().Rotate()
+
+	return response.Response{
+		Body: Keys().JWKS(),
+	}
+}
+
+func handleJWKS(ex *ex.Exchange) response.Response {
+	return response.Response{
+		Header: http.Header{
+			c.ContentType:   {"application/jwk-set+json"},
+			"Cache-Control": {"public, max-age=300"},
+		},
+		Body: util.ToJsonMust(Keys().JWKS()),
+	}
+}
+
+func findSecret(query url.Values) []byte {
+	if secret := query.Get("secret"); secret != "" {
+		return []byte(secret)
+	}
+	return []byte(defaultSecret)
+}
+
+func findToken(ex *ex.Exchange) string {
+	if scheme, value, ok := strings.Cut(ex.HeaderValueLast("Authorization"), " "); ok && strings.EqualFold(scheme, "Bearer") {
+		return strings.TrimSpace(value)
+	}
+
+	if token := ex.Request.URL.Query().Get("token"); token != "" {
+		return token
+	}
+
+	if mediaType, _, _ := mime.ParseMediaType(ex.Request.Header.Get(c.ContentType)); mediaType == "application/x-www-form-urlencoded" {
+		if form, err := url.ParseQuery(ex.BodyString()); err == nil {
+			return form.Get("token")
+		}
+	}
+
+	return ""
+}
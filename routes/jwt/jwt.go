@@ -0,0 +1,356 @@
+package jwt
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Algorithms supported for signing and verifying.
+var Algorithms = []string{"HS256", "RS256", "ES256", "EdDSA"}
+
+// SignOptions are the options for signing a token, besides the algorithm and the claims.
+type SignOptions struct {
+	// The `kid` header. The token is signed with that key, which has to be a key of the algorithm in the JWKS. For
+	// HS256, it's put in the header as is.
+	Kid string
+
+	// Shared secret for HS256.
+	Secret []byte
+}
+
+// Sign makes a token with the claims, signed with the algorithm, in the JWS compact serialization.
+func Sign(alg string, claims map[string]any, opts SignOptions) (string, error) {
+	header := map[string]any{
+		"alg": alg,
+		"typ": "JWT",
+	}
+
+	var key Key
+	if alg != "HS256" {
+		var ok bool
+		if opts.Kid != "" {
+			key, ok = Keys().Find(opts.Kid)
+			if !ok {
+				return "", fmt.Errorf("unknown key %q, not in the JWKS", opts.Kid)
+			}
+			if key.Alg != alg {
+				return "", fmt.Errorf("key %q is for %s, not %s", opts.Kid, key.Alg, alg)
+			}
+		} else {
+			key, ok = Keys().Current(alg)
+			if !ok {
+				return "", fmt.Errorf("unsupported algorithm %q, should be one of: %s", alg, strings.Join(Algorithms, ", "))
+			}
+		}
+		header["kid"] = key.ID
+	} else if len(opts.Secret) == 0 {
+		return "", errors.New("a secret is needed for HS256")
+	}
+
+	if opts.Kid != "" {
+		header["kid"] = opts.Kid
+	}
+
+	headerJSON, err := json.Marshal(header)
+	if err != nil {
+		return "", err
+	}
+
+	claimsJSON, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	signingInput := encodeSegment(headerJSON) + "." + encodeSegment(claimsJSON)
+
+	var signature []byte
+	if alg == "HS256" {
+		mac := hmac.New(sha256.New, opts.Secret)
+		mac.Write([]byte(signingInput))
+		signature = mac.Sum(nil)
+	} else {
+		signature, err = signWithKey(key, signingInput)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	return signingInput + "." + encodeSegment(signature), nil
+}
+
+func signWithKey(key Key, signingInput string) ([]byte, error) {
+	hash := sha256.Sum256([]byte(signingInput))
+
+	switch priv := key.Private.(type) {
+	case *rsa.PrivateKey:
+		return rsa.SignPKCS1v15(nil, priv, crypto.SHA256, hash[:])
+
+	case *ecdsa.PrivateKey:
+		// The signature is R and S, each 32 bytes, as per RFC 7518, section 3.4. Not the ASN.1 encoding.
+		r, s, err := ecdsa.Sign(rand.Reader, priv, hash[:])
+		if err != nil {
+			return nil, err
+		}
+		signature := make([]byte, 64)
+		r.FillBytes(signature[:32])
+		s.FillBytes(signature[32:])
+		return signature, nil
+
+	case ed25519.PrivateKey:
+		return ed25519.Sign(priv, []byte(signingInput)), nil
+
+	}
+
+	return nil, fmt.Errorf("unsupported key type %T", key.Private)
+}
+
+// VerifyOptions are the expectations that a token is verified against.
+type VerifyOptions struct {
+	// Shared secret for HS256.
+	Secret []byte
+
+	// Expected `aud` and `iss` claims, not checked if empty.
+	Audience string
+	Issuer   string
+
+	// Allowed clock skew, for the time based claims.
+	Leeway time.Duration
+}
+
+// Failure is a check that a token failed.
+type Failure struct {
+	Check string `json:"check"`
+	Error string `json:"error"`
+}
+
+// Result is the outcome of verifying a token. All checks are run, even after one of them fails, so that every failure
+// is reported. Only if the token can't be parsed at all, no other checks are run.
+type Result struct {
+	Header   map[string]any `json:"header"`
+	Claims   map[string]any `json:"claims"`
+	Failures []Failure      `json:"failures"`
+}
+
+func (r Result) Valid() bool {
+	return len(r.Failures) == 0
+}
+
+func (r *Result) fail(check string, format string, args ...any) {
+	r.Failures = append(r.Failures, Failure{Check: check, Error: fmt.Sprintf(format, args...)})
+}
+
+// Verify parses the token, and checks its signature and claims.
+func Verify(token string, opts VerifyOptions) Result {
+	result := Result{Failures: []Failure{}}
+
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		result.fail("format", "token should have three parts separated by dots, found %d", len(parts))
+		return result
+	}
+
+	if err := decodeJSONSegment(parts[0], &result.Header); err != nil {
+		result.fail("format", "invalid header: %v", err)
+		return result
+	}
+
+	if err := decodeJSONSegment(parts[1], &result.Claims); err != nil {
+		result.fail("format", "invalid claims: %v", err)
+		return result
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		result.fail("format", "invalid signature encoding: %v", err)
+		return result
+	}
+
+	result.verifySignature(parts[0]+"."+parts[1], signature, opts)
+	result.verifyClaims(opts)
+
+	return result
+}
+
+func (r *Result) verifySignature(signingInput string, signature []byte, opts VerifyOptions) {
+	alg, _ := r.Header["alg"].(string)
+	if !slices.Contains(Algorithms, alg) {
+		r.fail("alg", "unsupported algorithm %q, should be one of: %s", alg, strings.Join(Algorithms, ", "))
+		return
+	}
+
+	if alg == "HS256" {
+		if len(opts.Secret) == 0 {
+			r.fail("signature", "a secret is needed to verify HS256")
+			return
+		}
+		mac := hmac.New(sha256.New, opts.Secret)
+		mac.Write([]byte(signingInput))
+		if !hmac.Equal(signature, mac.Sum(nil)) {
+			r.fail("signature", "signature doesn't match")
+		}
+		return
+	}
+
+	var key Key
+	var ok bool
+	if kid, _ := r.Header["kid"].(string); kid != "" {
+		key, ok = Keys().Find(kid)
+		if !ok {
+			r.fail("kid", "unknown key %q, not in the JWKS", kid)
+			return
+		}
+	} else {
+		key, ok = Keys().Current(alg)
+		if !ok {
+			r.fail("kid", "no key for %s", alg)
+			return
+		}
+	}
+
+	if key.Alg != alg {
+		r.fail("alg", "key %q is for %s, not %s", key.ID, key.Alg, alg)
+		return
+	}
+
+	if !verifyWithKey(key, signingInput, signature) {
+		r.fail("signature", "signature doesn't match")
+	}
+}
+
+func verifyWithKey(key Key, signingInput string, signature []byte) bool {
+	hash := sha256.Sum256([]byte(signingInput))
+
+	switch pub := key.Private.Public().(type) {
+	case *rsa.PublicKey:
+		return rsa.VerifyPKCS1v15(pub, crypto.SHA256, hash[:], signature) == nil
+
+	case *ecdsa.PublicKey:
+		if len(signature) != 64 {
+			return false
+		}
+		r := new(big.Int).SetBytes(signature[:32])
+		s := new(big.Int).SetBytes(signature[32:])
+		return ecdsa.Verify(pub, hash[:], r, s)
+
+	case ed25519.PublicKey:
+		return ed25519.Verify(pub, []byte(signingInput), signature)
+
+	}
+
+	return false
+}
+
+func (r *Result) verifyClaims(opts VerifyOptions) {
+	now := time.Now()
+
+	if exp, ok := r.timeClaim("exp"); ok && !now.Before(exp.Add(opts.Leeway)) {
+		r.fail("exp", "token expired at %s", exp.UTC().Format(time.RFC3339))
+	}
+
+	if nbf, ok := r.timeClaim("nbf"); ok && now.Before(nbf.Add(-opts.Leeway)) {
+		r.fail("nbf", "token not valid before %s", nbf.UTC().Format(time.RFC3339))
+	}
+
+	if iat, ok := r.timeClaim("iat"); ok && now.Before(iat.Add(-opts.Leeway)) {
+		r.fail("iat", "token issued in the future, at %s", iat.UTC().Format(time.RFC3339))
+	}
+
+	if opts.Audience != "" {
+		var audiences []string
+		switch aud := r.Claims["aud"].(type) {
+		case string:
+			audiences = []string{aud}
+		case []any:
+			for _, item := range aud {
+				if s, ok := item.(string); ok {
+					audiences = append(audiences, s)
+				}
+			}
+		}
+		if !slices.Contains(audiences, opts.Audience) {
+			r.fail("aud", "audience %v doesn't include %q", r.Claims["aud"], opts.Audience)
+		}
+	}
+
+	if opts.Issuer != "" {
+		if iss, _ := r.Claims["iss"].(string); iss != opts.Issuer {
+			r.fail("iss", "issuer %q isn't %q", iss, opts.Issuer)
+		}
+	}
+}
+
+// Range of NumericDate values that are accepted, from year 1 to year 9999, so they fit in a time.Time.
+const (
+	minNumericDate = -62135596800
+	maxNumericDate = 253402300799
+)
+
+// timeClaim gives the time in a NumericDate claim. A claim that is present, but not a number in range, is a failure.
+func (r *Result) timeClaim(name string) (time.Time, bool) {
+	value, present := r.Claims[name]
+	if !present {
+		return time.Time{}, false
+	}
+
+	t, ok := numericDate(value)
+	if !ok {
+		r.fail(name, "should be a number of seconds since the epoch, found %v", value)
+	}
+	return t, ok
+}
+
+// numericDate gives the time for a number of seconds since the epoch, which can have a fraction, if it's between the
+// years 1 and 9999.
+func numericDate(value any) (time.Time, bool) {
+	var seconds float64
+	switch v := value.(type) {
+	case json.Number:
+		if n, err := v.Int64(); err == nil {
+			if n < minNumericDate || n > maxNumericDate {
+				return time.Time{}, false
+			}
+			return time.Unix(n, 0), true
+		}
+		var err error
+		if seconds, err = v.Float64(); err != nil {
+			return time.Time{}, false
+		}
+	case float64:
+		seconds = v
+	default:
+		return time.Time{}, false
+	}
+
+	if !(seconds >= minNumericDate && seconds <= maxNumericDate) {
+		return time.Time{}, false
+	}
+
+	whole, frac := math.Modf(seconds)
+	return time.Unix(int64(whole), int64(frac*1e9)), true
+}
+
+func decodeJSONSegment(segment string, target *map[string]any) error {
+	b, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	// Numbers are kept as they are, so large integers in claims don't lose precision.
+	decoder := json.NewDecoder(bytes.NewReader(b))
+	decoder.UseNumber()
+	return decoder.Decode(target)
+}
@@ -0,0 +1,221 @@
+package jwt
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSignAndVerify(t *testing.T) {
+	for _, alg := range Algorithms {
+		t.Run(alg, func(t *testing.T) {
+			s := assert.New(t)
+
+			token, err := Sign(alg, map[string]any{"sub": "dave"}, SignOptions{Secret: []byte("s3cret")})
+			s.NoError(err)
+
+			result := Verify(token, VerifyOptions{Secret: []byte("s3cret")})
+			s.Empty(result.Failures)
+			s.Equal(alg, result.Header["alg"])
+			s.Equal("dave", result.Claims["sub"])
+
+			// Tampered claims don't match the signature anymore.
+			parts := strings.Split(token, ".")
+			parts[1] = encodeSegment([]byte(`{"sub":"eve"}`))
+			result = Verify(strings.Join(parts, "."), VerifyOptions{Secret: []byte("s3cret")})
+			s.Equal([]Failure{{"signature", "signature doesn't match"}}, result.Failures)
+		})
+	}
+}
+
+func TestSignedWithPublishedKey(t *testing.T) {
+	s := assert.New(t)
+
+	for _, alg := range keyAlgorithms {
+		token, err := Sign(alg, map[string]any{"sub": "dave"}, SignOptions{})
+		s.NoError(err)
+
+		parts := strings.Split(token, ".")
+		result := Verify(token, VerifyOptions{})
+		jwk := findJWK(Keys().JWKS(), result.Header["kid"].(string))
+		if !s.NotNil(jwk, alg) {
+			continue
+		}
+
+		signingInput := []byte(parts[0] + "." + parts[1])
+		hash := sha256.Sum256(signingInput)
+		signature := decode(parts[2])
+
+		switch jwk["kty"] {
+		case "RSA":
+			pub := &rsa.PublicKey{
+				N: new(big.Int).SetBytes(decode(jwk["n"].(string))),
+				E: int(new(big.Int).SetBytes(decode(jwk["e"].(string))).Int64()),
+			}
+			s.NoError(rsa.VerifyPKCS1v15(pub, crypto.SHA256, hash[:], signature))
+
+		case "EC":
+			x, y := decode(jwk["x"].(string)), decode(jwk["y"].(string))
+			s.Len(x, 32)
+			s.Len(y, 32)
+			pub, err := ecdsa.ParseUncompressedPublicKey(elliptic.P256(), append(append([]byte{4}, x...), y...))
+			s.NoError(err)
+			s.Len(signature, 64)
+			s.True(ecdsa.Verify(pub, hash[:], new(big.Int).SetBytes(signature[:32]), new(big.Int).SetBytes(signature[32:])))
+
+		case "OKP":
+			s.True(ed25519.Verify(decode(jwk["x"].(string)), signingInput, signature))
+
+		default:
+			s.Failf("unexpected key type", "%v", jwk["kty"])
+		}
+	}
+}
+
+func TestVerifyReportsAllFailures(t *testing.T) {
+	s := assert.New(t)
+	now := time.Now()
+
+	token, err := Sign("HS256", map[string]any{
+		"iss": "someone",
+		"aud": []string{"a", "b"},
+		"exp": now.Add(-time.Minute).Unix(),
+		"nbf": now.Add(time.Minute).Unix(),
+		"iat": "yesterday",
+	}, SignOptions{Secret: []byte("one")})
+	s.NoError(err)
+
+	result := Verify(token, VerifyOptions{
+		Secret:   []byte("two"),
+		Audience: "c",
+		Issuer:   "me",
+	})
+
+	var checks []string
+	for _, failure := range result.Failures {
+		checks = append(checks, failure.Check)
+	}
+	s.Equal([]string{"signature", "exp", "nbf", "iat", "aud", "iss"}, checks)
+
+	// With enough leeway, and the right expectations, only the bad `iat` is left.
+	result = Verify(token, VerifyOptions{
+		Secret:   []byte("one"),
+		Audience: "b",
+		Issuer:   "someone",
+		Leeway:   2 * time.Minute,
+	})
+	s.Equal([]Failure{{"iat", "should be a number of seconds since the epoch, found yesterday"}}, result.Failures)
+}
+
+func TestVerifyMalformed(t *testing.T) {
+	s := assert.New(t)
+
+	s.Equal("format", Verify("abc", VerifyOptions{}).Failures[0].Check)
+	s.Equal("format", Verify("a.b.c", VerifyOptions{}).Failures[0].Check)
+
+	none := encodeSegment([]byte(`{"alg":"none"}`)) + "." + encodeSegment([]byte(`{}`)) + "."
+	s.Equal([]Failure{{"alg", `unsupported algorithm "none", should be one of: HS256, RS256, ES256, EdDSA`}}, Verify(none, VerifyOptions{}).Failures)
+}
+
+func TestUnknownKid(t *testing.T) {
+	s := assert.New(t)
+
+	_, err := Sign("ES256", map[string]any{}, SignOptions{Kid: "nope"})
+	s.EqualError(err, `unknown key "nope", not in the JWKS`)
+
+	// A token with a kid that's not in the JWKS doesn't verify, even if the signature is right.
+	current, _ := Keys().Current("ES256")
+	signingInput := encodeSegment([]byte(`{"alg":"ES256","kid":"nope"}`)) + "." + encodeSegment([]byte(`{}`))
+	signature, err := signWithKey(current, signingInput)
+	s.NoError(err)
+
+	result := Verify(signingInput+"."+encodeSegment(signature), VerifyOptions{})
+	s.Equal("nope", result.Header["kid"])
+	s.Equal([]Failure{{"kid", `unknown key "nope", not in the JWKS`}}, result.Failures)
+
+	current, _ = Keys().Current("RS256")
+	_, err = Sign("ES256", map[string]any{}, SignOptions{Kid: current.ID})
+	s.Error(err)
+}
+
+func TestTimeClaims(t *testing.T) {
+	s := assert.New(t)
+
+	token, err := Sign("HS256", map[string]any{"exp": int64(9999999999), "nbf": 1.5, "iat": 1e300}, SignOptions{Secret: []byte("s")})
+	s.NoError(err)
+
+	result := Verify(token, VerifyOptions{Secret: []byte("s")})
+	s.Equal([]Failure{{"iat", "should be a number of seconds since the epoch, found 1e+300"}}, result.Failures)
+
+	exp, ok := result.timeClaim("exp")
+	s.True(ok)
+	s.Equal(int64(9999999999), exp.Unix())
+
+	nbf, ok := result.timeClaim("nbf")
+	s.True(ok)
+	s.Equal(time.Unix(1, 5e8), nbf)
+}
+
+func TestRotation(t *testing.T) {
+	s := assert.New(t)
+	ks := NewKeySet()
+
+	key, _ := ks.Current("EdDSA")
+
+	// Keys replaced in a rotation are still found, for previousGenerations rotations.
+	for range previousGenerations {
+		ks.Rotate()
+		_, ok := ks.Find(key.ID)
+		s.True(ok)
+	}
+	s.Len(ks.JWKS()["keys"], (previousGenerations+1)*len(keyAlgorithms))
+
+	ks.Rotate()
+	_, ok := ks.Find(key.ID)
+	s.False(ok)
+	s.Len(ks.JWKS()["keys"], (previousGenerations+1)*len(keyAlgorithms))
+}
+
+func TestRotateIfDue(t *testing.T) {
+	s := assert.New(t)
+	ks := NewKeySet()
+	key, _ := ks.Current("EdDSA")
+
+	ks.mu.Lock()
+	ks.rotatedAt = ks.rotatedAt.Add(-rotationInterval)
+	ks.mu.Unlock()
+
+	// A rotation that's due happens when the keys are next used, and the replaced keys are still found.
+	newKey, ok := ks.Current("EdDSA")
+	s.True(ok)
+	s.NotEqual(key.ID, newKey.ID)
+	s.False(ks.rotating)
+	s.WithinDuration(time.Now().Add(rotationInterval), ks.NextRotation(), time.Minute)
+
+	_, ok = ks.Find(key.ID)
+	s.True(ok)
+}
+
+func findJWK(jwks map[string]any, kid string) map[string]any {
+	for _, jwk := range jwks["keys"].([]map[string]any) {
+		if jwk["kid"] == kid {
+			return jwk
+		}
+	}
+	return nil
+}
+
+func decode(segment string) []byte {
+	b, _ := base64.RawURLEncoding.DecodeString(segment)
+	return b
+}
@@ -0,0 +1,244 @@
+package jwt
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"log"
+	"math/big"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/sharat87/httpbun/util"
+)
+
+// Interval after which keys are replaced by new ones. The keys they replace are still published, and accepted, for the
+// next previousGenerations rotations, so tokens signed before a rotation stay valid.
+const rotationInterval = 24 * time.Hour
+
+// Number of generations of replaced keys that are kept.
+const previousGenerations = 2
+
+// Algorithms that are signed with keys generated by the server, and published in the JWKS. HS256 isn't one of them,
+// since it uses a shared secret.
+var keyAlgorithms = []string{"RS256", "ES256", "EdDSA"}
+
+// Key is a signing key, generated by the server.
+type Key struct {
+	ID        string
+	Alg       string
+	Private   crypto.Signer
+	CreatedAt time.Time
+}
+
+// JWK gives the public part of the key, as a JSON Web Key, as per RFC 7517.
+func (k Key) JWK() map[string]any {
+	jwk := map[string]any{
+		"kid": k.ID,
+		"alg": k.Alg,
+		"use": "sig",
+	}
+
+	switch pub := k.Private.Public().(type) {
+	case *rsa.PublicKey:
+		jwk["kty"] = "RSA"
+		jwk["n"] = encodeSegment(pub.N.Bytes())
+		jwk["e"] = encodeSegment(big.NewInt(int64(pub.E)).Bytes())
+
+	case *ecdsa.PublicKey:
+		// The uncompressed point is 0x04, followed by the X and Y coordinates.
+		point, err := pub.ECDH()
+		if err != nil {
+			log.Printf("Error converting EC key %s: %v", k.ID, err)
+			break
+		}
+		b := point.Bytes()[1:]
+		jwk["kty"] = "EC"
+		jwk["crv"] = "P-256"
+		jwk["x"] = encodeSegment(b[:len(b)/2])
+		jwk["y"] = encodeSegment(b[len(b)/2:])
+
+	case ed25519.PublicKey:
+		jwk["kty"] = "OKP"
+		jwk["crv"] = "Ed25519"
+		jwk["x"] = encodeSegment(pub)
+
+	}
+
+	return jwk
+}
+
+// KeySet holds the current keys, one for each algorithm, and the ones they replaced in the last few rotations.
+type KeySet struct {
+	mu      sync.Mutex
+	current []Key
+
+	// Keys replaced in earlier rotations, latest first, up to previousGenerations of them.
+	previous  [][]Key
+	rotatedAt time.Time
+	rotations int
+
+	// Whether keys are being generated for a rotation that's due, so other callers don't generate them as well.
+	rotating bool
+}
+
+// Keys gives the key set, which is generated when it's first needed, and rotated every rotationInterval.
+var Keys = sync.OnceValue(NewKeySet)
+
+func NewKeySet() *KeySet {
+	ks := &KeySet{}
+	ks.rotate()
+	return ks
+}
+
+// Rotate replaces the current keys with new ones, right away. The keys are generated without holding the lock, so
+// tokens can be signed and verified meanwhile.
+func (ks *KeySet) Rotate() {
+	keys := generateKeys()
+
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	ks.install(keys)
+}
+
+func (ks *KeySet) rotate() {
+	ks.install(generateKeys())
+}
+
+// install makes the keys the current ones, and the current ones the latest previous generation. Must be called with
+// the lock held.
+func (ks *KeySet) install(keys []Key) {
+	if ks.current != nil {
+		ks.previous = slices.Insert(ks.previous, 0, ks.current)
+		if len(ks.previous) > previousGenerations {
+			ks.previous = ks.previous[:previousGenerations]
+		}
+	}
+	ks.rotatedAt = time.Now()
+	ks.rotations++
+
+	ks.current = nil
+	for _, key := range keys {
+		key.ID = key.Alg + "-" + strconv.Itoa(ks.rotations) + "-" + encodeSegment(util.RandomBytes(6))
+		key.CreatedAt = ks.rotatedAt
+		ks.current = append(ks.current, key)
+	}
+}
+
+// all gives the current keys, followed by the previous ones, latest first. Must be called with the lock held.
+func (ks *KeySet) all() []Key {
+	return slices.Concat(append([][]Key{ks.current}, ks.previous...)...)
+}
+
+// rotateIfDue rotates the keys, if they are older than the rotation interval. Must be called without the lock held,
+// since the new keys are generated without it. Callers meanwhile get the keys being replaced, which are still valid.
+func (ks *KeySet) rotateIfDue() {
+	ks.mu.Lock()
+	rotatedAt := ks.rotatedAt
+	due := !ks.rotating && time.Since(rotatedAt) >= rotationInterval
+	ks.rotating = ks.rotating || due
+	ks.mu.Unlock()
+
+	if !due {
+		return
+	}
+
+	keys := generateKeys()
+
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	ks.rotating = false
+
+	// The keys could have been rotated with Rotate, meanwhile.
+	if ks.rotatedAt.Equal(rotatedAt) {
+		ks.install(keys)
+	}
+}
+
+// Current gives the current key for the algorithm.
+func (ks *KeySet) Current(alg string) (Key, bool) {
+	ks.rotateIfDue()
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+
+	for _, key := range ks.current {
+		if key.Alg == alg {
+			return key, true
+		}
+	}
+	return Key{}, false
+}
+
+// Find gives the key with the ID, current or previous.
+func (ks *KeySet) Find(kid string) (Key, bool) {
+	ks.rotateIfDue()
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+
+	for _, key := range ks.all() {
+		if key.ID == kid {
+			return key, true
+		}
+	}
+	return Key{}, false
+}
+
+// JWKS gives the public keys, current and previous, as a JSON Web Key Set.
+func (ks *KeySet) JWKS() map[string]any {
+	ks.rotateIfDue()
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+
+	keys := []map[string]any{}
+	for _, key := range ks.all() {
+		keys = append(keys, key.JWK())
+	}
+	return map[string]any{"keys": keys}
+}
+
+// NextRotation gives the time when the keys will be rotated next.
+func (ks *KeySet) NextRotation() time.Time {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	return ks.rotatedAt.Add(rotationInterval)
+}
+
+// generateKeys makes a new key for each of keyAlgorithms, skipping any that fail.
+func generateKeys() []Key {
+	var keys []Key
+	for _, alg := range keyAlgorithms {
+		key, err := generateKey(alg)
+		if err != nil {
+			log.Printf("Error generating %s key: %v", alg, err)
+			continue
+		}
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+func generateKey(alg string) (Key, error) {
+	var signer crypto.Signer
+	var err error
+
+	switch alg {
+	case "RS256":
+		signer, err = rsa.GenerateKey(rand.Reader, 2048)
+	case "ES256":
+		signer, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case "EdDSA":
+		_, signer, err = ed25519.GenerateKey(rand.Reader)
+	}
+
+	return Key{Alg: alg, Private: signer}, err
+}
+
+func encodeSegment(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
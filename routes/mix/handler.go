@@ -18,6 +18,7 @@ import (
 	"github.com/sharat87/httpbun/c"
 	"github.com/sharat87/httpbun/ex"
 	"github.com/sharat87/httpbun/response"
+	"github.com/sharat87/httpbun/routes/cookies"
 	"github.com/sharat87/httpbun/util"
 )
 
@@ -37,11 +38,13 @@ var RouteList = []ex.Route{
 var singleValueDirectives = map[string]any{
 	"s":     nil,
 	"cd":    nil,
+	"ca":    nil,
 	"r":     nil,
 	"b64":   nil,
 	"d":     nil,
 	"t":     nil,
 	"slack": nil,
+	"tr":    nil,
 }
 
 var pairValueDirectives = map[string]any{
@@ -139,6 +142,14 @@ func handleMix(ex *ex.Exchange) response.Response {
 				Path:  "/",
 			})
 
+		case "ca":
+			if len(res.Cookies) == 0 {
+				return response.BadRequest("ca must come after a c directive")
+			}
+			if err := cookies.SetAttributes(&res.Cookies[len(res.Cookies)-1], entry.Args[0]); err != nil {
+				return response.BadRequest("%s", err.Error())
+			}
+
 		case "cd":
 			res.Cookies = append(res.Cookies, http.Cookie{
 				Name:    entry.Args[0],
@@ -188,6 +199,18 @@ func handleMix(ex *ex.Exchange) response.Response {
 				return response.BadRequest("%s", err.Error())
 			}
 
+		case "tr":
+			// Without a value, the trailer is declared in the `Trailer` header, but not sent.
+			if res.Trailer == nil {
+				res.Trailer = http.Header{}
+			}
+			name, value, found := strings.Cut(entry.Args[0], ":")
+			if found {
+				res.Trailer.Add(name, value)
+			} else if key := http.CanonicalHeaderKey(name); res.Trailer[key] == nil {
+				res.Trailer[key] = nil
+			}
+
 		case "slack":
 			sendRequestToSlack(entry.Args[0], ex)
 
@@ -207,7 +230,8 @@ func handleMix(ex *ex.Exchange) response.Response {
 
 	if len(payload) > 0 {
 		res.Body = payload
-		if _, ok := res.Header["Content-Length"]; !ok {
+		// No `Content-Length` with trailers, since they need chunked transfer in HTTP/1.1.
+		if _, ok := res.Header["Content-Length"]; !ok && len(res.Trailer) == 0 {
 			res.Header.Set("Content-Length", strconv.Itoa(len(payload)))
 		}
 	}
@@ -184,6 +184,24 @@ func TestMixMultipleCookies(t *testing.T) {
 	s.Equal("value3", resp.Cookies[2].Value)
 }
 
+func TestMixTrailers(t *testing.T) {
+	s := assert.New(t)
+
+	resp := ex.InvokeHandlerForTest(
+		"mix/tr=grpc-status:0/tr=grpc-message/b64=b2s=",
+		http.Request{},
+		PatMix,
+		handleMix,
+	)
+
+	s.Equal([]byte("ok"), resp.Body)
+	s.Equal(http.Header{
+		"Grpc-Status":  {"0"},
+		"Grpc-Message": nil,
+	}, resp.Trailer)
+	s.Empty(resp.Header.Get("Content-Length"))
+}
+
 func TestMixRedirect(t *testing.T) {
 	s := assert.New(t)
 
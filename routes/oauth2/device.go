@@ -0,0 +1,306 @@
+package oauth2
+
+import (
+	"crypto/rand"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sharat87/httpbun/assets"
+	"github.com/sharat87/httpbun/ex"
+	"github.com/sharat87/httpbun/response"
+	"github.com/sharat87/httpbun/util"
+)
+
+const (
+	DeviceCodeGrantType = "urn:ietf:params:oauth:grant-type:device_code"
+
+	deviceCodeTTL = 10 * time.Minute
+
+	// Minimum seconds between polls of the token endpoint, for a device code. Each `slow_down` response adds
+	// devicePollInterval to this, for that device code, as per RFC 8628, section 3.5.
+	devicePollInterval = 5 * time.Second
+
+	// Maximum number of pending device authorizations. When exceeded, the one expiring soonest is dropped.
+	maxDeviceAuthorizations = 10000
+
+	// Characters of user codes, without vowels, to avoid making words, as suggested in RFC 8628, section 6.1.
+	userCodeAlphabet = "BCDFGHJKLMNPQRSTVWXZ"
+)
+
+type deviceStatus string
+
+const (
+	devicePending  deviceStatus = "pending"
+	deviceApproved deviceStatus = "approved"
+	deviceDenied   deviceStatus = "denied"
+)
+
+type deviceAuthorization struct {
+	DeviceCode string
+	UserCode   string
+	ClientID   string
+	Scope      string
+	ExpiresAt  time.Time
+	Status     deviceStatus
+	Email      string
+	AuthTime   time.Time
+	LastPolled time.Time
+
+	// Minimum time between polls, which grows with each `slow_down`.
+	Interval time.Duration
+}
+
+type deviceStore struct {
+	mu         sync.Mutex
+	byDevice   map[string]*deviceAuthorization
+	byUserCode map[string]*deviceAuthorization
+}
+
+var devices = &deviceStore{
+	byDevice:   map[string]*deviceAuthorization{},
+	byUserCode: map[string]*deviceAuthorization{},
+}
+
+func (s *deviceStore) add(clientID, scope string) deviceAuthorization {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.byDevice) >= maxDeviceAuthorizations {
+		s.evict()
+	}
+
+	auth := &deviceAuthorization{
+		DeviceCode: util.RandomString(),
+		ClientID:   clientID,
+		Scope:      scope,
+		ExpiresAt:  time.Now().Add(deviceCodeTTL),
+		Status:     devicePending,
+		Interval:   devicePollInterval,
+	}
+
+	for {
+		auth.UserCode = newUserCode()
+		if s.byUserCode[auth.UserCode] == nil {
+			break
+		}
+	}
+
+	s.byDevice[auth.DeviceCode] = auth
+	s.byUserCode[auth.UserCode] = auth
+	return *auth
+}
+
+func (s *deviceStore) evict() {
+	now := time.Now()
+	var soonest *deviceAuthorization
+	for _, auth := range s.byDevice {
+		if !now.Before(auth.ExpiresAt) {
+			s.remove(auth)
+		} else if soonest == nil || auth.ExpiresAt.Before(soonest.ExpiresAt) {
+			soonest = auth
+		}
+	}
+
+	if len(s.byDevice) >= maxDeviceAuthorizations && soonest != nil {
+		s.remove(soonest)
+	}
+}
+
+func (s *deviceStore) remove(auth *deviceAuthorization) {
+	delete(s.byDevice, auth.DeviceCode)
+	delete(s.byUserCode, auth.UserCode)
+}
+
+// decide approves or denies the pending authorization with the user code.
+func (s *deviceStore) decide(userCode string, approve bool, email string) (deviceAuthorization, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	auth := s.byUserCode[normalizeUserCode(userCode)]
+	if auth == nil || auth.Status != devicePending || !time.Now().Before(auth.ExpiresAt) {
+		return deviceAuthorization{}, false
+	}
+
+	if approve {
+		auth.Status = deviceApproved
+		auth.Email = email
+		auth.AuthTime = time.Now()
+	} else {
+		auth.Status = deviceDenied
+	}
+
+	return *auth, true
+}
+
+// poll checks the authorization for the device code, as the client polls the token endpoint. An authorization that's
+// approved or denied is removed, so that the device code can only be exchanged once.
+func (s *deviceStore) poll(deviceCode, clientID string) (deviceAuthorization, string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	auth := s.byDevice[deviceCode]
+	if auth == nil || auth.ClientID != clientID {
+		return deviceAuthorization{}, "invalid_grant"
+	}
+
+	now := time.Now()
+	if !now.Before(auth.ExpiresAt) {
+		s.remove(auth)
+		return deviceAuthorization{}, "expired_token"
+	}
+
+	switch auth.Status {
+	case deviceApproved:
+		s.remove(auth)
+		return *auth, ""
+
+	case deviceDenied:
+		s.remove(auth)
+		return deviceAuthorization{}, "access_denied"
+
+	}
+
+	tooSoon := now.Sub(auth.LastPolled) < auth.Interval
+	auth.LastPolled = now
+	if tooSoon {
+		auth.Interval += devicePollInterval
+		return deviceAuthorization{Interval: auth.Interval}, "slow_down"
+	}
+
+	return deviceAuthorization{}, "authorization_pending"
+}
+
+// newUserCode makes a code like `BCDF-GHJK`, for the user to type in.
+func newUserCode() string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+
+	var code strings.Builder
+	for i, ch := range b {
+		if i == 4 {
+			code.WriteByte('-')
+		}
+		code.WriteByte(userCodeAlphabet[int(ch)%len(userCodeAlphabet)])
+	}
+	return code.String()
+}
+
+// normalizeUserCode makes a user code typed in by a user comparable to the issued one, ignoring case, spaces and
+// dashes.
+func normalizeUserCode(code string) string {
+	code = strings.ToUpper(strings.NewReplacer("-", "", " ", "").Replace(code))
+	if len(code) != 8 {
+		return code
+	}
+	return code[:4] + "-" + code[4:]
+}
+
+// handleDeviceAuthorization starts a device authorization, as per RFC 8628, section 3.1.
+func handleDeviceAuthorization(ex *ex.Exchange) response.Response {
+	if ex.Request.Method != http.MethodPost {
+		return errorResponse(http.StatusMethodNotAllowed, "invalid_request", "Method not allowed. Use POST.")
+	}
+
+	if err := ex.Request.ParseForm(); err != nil {
+		return errorResponse(http.StatusBadRequest, "invalid_request", "Failed to parse form data")
+	}
+
+	clientID, _ := clientCredentials(ex)
+	if clientID == "" {
+		return errorResponse(http.StatusBadRequest, "invalid_request", "Missing required parameter: client_id")
+	}
+
+	auth := devices.add(clientID, ex.Request.FormValue("scope"))
+	verificationURI := ex.AbsoluteUrl("/oauth2/device")
+
+	return response.Response{
+		Header: http.Header{
+			"Cache-Control": []string{"no-store"},
+		},
+		Body: map[string]any{
+			"device_code":               auth.DeviceCode,
+			"user_code":                 auth.UserCode,
+			"verification_uri":          verificationURI,
+			"verification_uri_complete": verificationURI + "?user_code=" + auth.UserCode,
+			"expires_in":                int(deviceCodeTTL / time.Second),
+			"interval":                  int(devicePollInterval / time.Second),
+		},
+	}
+}
+
+// handleDevice shows the page where the user enters the code shown on the device, and approves or denies it.
+func handleDevice(ex *ex.Exchange) response.Response {
+	data := map[string]any{
+		"userCode": ex.Request.URL.Query().Get("user_code"),
+	}
+
+	if ex.Request.Method == http.MethodPost {
+		if err := ex.Request.ParseForm(); err != nil {
+			return response.BadRequest("Failed to parse form data")
+		}
+
+		userCode := ex.Request.PostFormValue("user_code")
+		email := ex.Request.PostFormValue("email")
+		approve := ex.Request.PostFormValue("decision") == "approve"
+		data["userCode"] = userCode
+
+		if approve && email == "" {
+			data["error"] = "An email is needed, to approve."
+		} else if auth, ok := devices.decide(userCode, approve, email); !ok {
+			data["error"] = "This code is invalid, or has expired, or has already been used."
+		} else if approve {
+			data["message"] = "Approved. The device " + auth.ClientID + " can now continue."
+		} else {
+			data["message"] = "Denied. The device " + auth.ClientID + " won't get access."
+		}
+	} else if ex.Request.Method != http.MethodGet {
+		return response.Response{
+			Status: http.StatusMethodNotAllowed,
+			Body:   "Method not allowed. Use GET or POST.",
+		}
+	}
+
+	resp := assets.Render("oauth2-device.html", *ex, data)
+	if data["error"] != nil {
+		resp.Status = http.StatusBadRequest
+	}
+	return resp
+}
+
+// handleDeviceCodeGrant exchanges an approved device code for tokens, as per RFC 8628, section 3.4.
+func handleDeviceCodeGrant(ex *ex.Exchange) response.Response {
+	deviceCode := ex.Request.FormValue("device_code")
+	if deviceCode == "" {
+		return errorResponse(http.StatusBadRequest, "invalid_request", "Missing required parameter: device_code")
+	}
+
+	clientID, _ := clientCredentials(ex)
+	if clientID == "" {
+		return errorResponse(http.StatusBadRequest, "invalid_request", "Missing required parameter: client_id")
+	}
+
+	auth, errorCode := devices.poll(deviceCode, clientID)
+	switch errorCode {
+	case "":
+		return tokenResponse(ex, grant{
+			Email:    auth.Email,
+			ClientID: auth.ClientID,
+			Scope:    auth.Scope,
+			AuthTime: auth.AuthTime.Unix(),
+			Family:   util.RandomString(),
+		})
+	case "authorization_pending":
+		return errorResponse(http.StatusBadRequest, errorCode, "The user hasn't approved the device yet")
+	case "slow_down":
+		return errorResponse(http.StatusBadRequest, errorCode, fmt.Sprintf("Polling too often, wait %d seconds between polls", int(auth.Interval/time.Second)))
+	case "access_denied":
+		return errorResponse(http.StatusBadRequest, errorCode, "The user denied the device")
+	case "expired_token":
+		return errorResponse(http.StatusBadRequest, errorCode, "The device code has expired")
+	}
+
+	return errorResponse(http.StatusBadRequest, "invalid_grant", "Invalid device code")
+}
@@ -0,0 +1,206 @@
+package oauth2
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/sharat87/httpbun/ex"
+	"github.com/sharat87/httpbun/response"
+	"github.com/sharat87/httpbun/util"
+)
+
+const (
+	authCodeTTL     = 10 * time.Minute
+	accessTokenTTL  = time.Hour
+	refreshTokenTTL = 24 * time.Hour
+)
+
+// refreshTokenPayload is the data encoded in the refresh token. All tokens that came from the same authorization share
+// a family, which is revoked as a whole if a refresh token is used more than once.
+type refreshTokenPayload struct {
+	ID        string     `json:"jti"`
+	Family    string     `json:"fam"`
+	Email     string     `json:"email"`
+	ClientID  string     `json:"cid"`
+	Scope     string     `json:"scope,omitempty"`
+	Claims    userClaims `json:"claims,omitzero"`
+	AuthTime  int64      `json:"auth_time,omitempty"`
+	CreatedAt int64      `json:"iat"`
+}
+
+// grant is what's been granted to a client, carried over from an authorization code, device code or refresh token, to
+// the tokens issued for it.
+type grant struct {
+	Email    string
+	ClientID string
+	Scope    string
+	Claims   userClaims
+	AuthTime int64
+	Nonce    string
+
+	// Family of refresh tokens to issue a new one in. No refresh token is issued if this is empty.
+	Family string
+}
+
+// tokenResponse issues an access token for the grant, a refresh token if it has a family, and an ID token if the
+// `openid` scope is granted.
+func tokenResponse(ex *ex.Exchange, g grant) response.Response {
+	now := time.Now()
+
+	accessToken, err := encodePayload(kindAccessToken, accessTokenPayload{
+		ID:        util.RandomString(),
+		Family:    g.Family,
+		Email:     g.Email,
+		ClientID:  g.ClientID,
+		Scope:     g.Scope,
+		Claims:    g.Claims,
+		CreatedAt: now.Unix(),
+	})
+	if err != nil {
+		return errorResponse(http.StatusInternalServerError, "server_error", "Failed to generate access token")
+	}
+
+	body := map[string]any{
+		"access_token": accessToken,
+		"token_type":   "Bearer",
+		"expires_in":   int(accessTokenTTL / time.Second),
+	}
+
+	if g.Scope != "" {
+		body["scope"] = g.Scope
+	}
+
+	if g.Family != "" {
+		refreshToken, err := encodePayload(kindRefreshToken, refreshTokenPayload{
+			ID:        util.RandomString(),
+			Family:    g.Family,
+			Email:     g.Email,
+			ClientID:  g.ClientID,
+			Scope:     g.Scope,
+			Claims:    g.Claims,
+			AuthTime:  g.AuthTime,
+			CreatedAt: now.Unix(),
+		})
+		if err != nil {
+			return errorResponse(http.StatusInternalServerError, "server_error", "Failed to generate refresh token")
+		}
+		body["refresh_token"] = refreshToken
+	}
+
+	if g.Email != "" && hasScope(g.Scope, "openid") {
+		idToken, err := signIDToken(ex, g, accessToken, now)
+		if err != nil {
+			return errorResponse(http.StatusInternalServerError, "server_error", "Failed to generate ID token")
+		}
+		body["id_token"] = idToken
+	}
+
+	return response.Response{
+		Status: http.StatusOK,
+		Header: http.Header{
+			"Cache-Control": []string{"no-store"},
+			"Pragma":        []string{"no-cache"},
+		},
+		Body: body,
+	}
+}
+
+// handleClientCredentialsGrant issues an access token to the client itself, with no user involved. There's no refresh
+// token, as per RFC 6749, section 4.4.3.
+func handleClientCredentialsGrant(ex *ex.Exchange) response.Response {
+	clientID, clientSecret := clientCredentials(ex)
+	if clientID == "" || clientSecret == "" {
+		resp := errorResponse(http.StatusUnauthorized, "invalid_client", "Client authentication is required, with client_id and client_secret")
+		resp.Header.Set("WWW-Authenticate", `Basic realm="httpbun"`)
+		return resp
+	}
+
+	return tokenResponse(ex, grant{
+		ClientID: clientID,
+		Scope:    ex.Request.FormValue("scope"),
+	})
+}
+
+// handleRefreshTokenGrant exchanges a refresh token for a new access token, and a new refresh token. The refresh token
+// can't be used again.
+func handleRefreshTokenGrant(ex *ex.Exchange) response.Response {
+	token := ex.Request.FormValue("refresh_token")
+	if token == "" {
+		return errorResponse(http.StatusBadRequest, "invalid_request", "Missing required parameter: refresh_token")
+	}
+
+	var payload refreshTokenPayload
+	if err := decodePayload(kindRefreshToken, token, &payload); err != nil || payload.ID == "" || payload.Family == "" {
+		return errorResponse(http.StatusBadRequest, "invalid_grant", "Invalid refresh token")
+	}
+
+	if clientID, _ := clientCredentials(ex); clientID != payload.ClientID {
+		return errorResponse(http.StatusBadRequest, "invalid_grant", "client_id does not match the refresh token")
+	}
+
+	if time.Since(time.Unix(payload.CreatedAt, 0)) > refreshTokenTTL {
+		return errorResponse(http.StatusBadRequest, "invalid_grant", "Refresh token has expired")
+	}
+
+	// A narrower scope can be asked for, but not a wider one, as per RFC 6749, section 6.
+	scope := payload.Scope
+	if requested := ex.Request.FormValue("scope"); requested != "" {
+		if !isScopeSubset(requested, payload.Scope) {
+			return errorResponse(http.StatusBadRequest, "invalid_scope", "Requested scope exceeds the scope of the refresh token")
+		}
+		scope = requested
+	}
+
+	if ok, description := tokens.use(payload.ID, payload.Family, time.Unix(payload.CreatedAt, 0).Add(refreshTokenTTL)); !ok {
+		return errorResponse(http.StatusBadRequest, "invalid_grant", "Refresh token "+description)
+	}
+
+	return tokenResponse(ex, grant{
+		Email:    payload.Email,
+		ClientID: payload.ClientID,
+		Scope:    scope,
+		Claims:   payload.Claims,
+		AuthTime: payload.AuthTime,
+		Family:   payload.Family,
+	})
+}
+
+// hasScope tells if the space separated list of scopes has the given one.
+func hasScope(scope, name string) bool {
+	return slices.Contains(strings.Fields(scope), name)
+}
+
+// isScopeSubset tells if all the scopes in the first space separated list are in the second.
+func isScopeSubset(scope, of string) bool {
+	granted := strings.Fields(of)
+	for _, s := range strings.Fields(scope) {
+		if !slices.Contains(granted, s) {
+			return false
+		}
+	}
+	return true
+}
+
+// clientCredentials gives the client ID and secret from HTTP Basic auth, or from the form body, as per RFC 6749,
+// section 2.3.1.
+func clientCredentials(ex *ex.Exchange) (string, string) {
+	if clientID, clientSecret, ok := ex.Request.BasicAuth(); ok {
+		return clientID, clientSecret
+	}
+	return ex.Request.FormValue("client_id"), ex.Request.FormValue("client_secret")
+}
+
+func errorResponse(status int, code, description string) response.Response {
+	return response.Response{
+		Status: status,
+		Header: http.Header{
+			"Cache-Control": []string{"no-store"},
+		},
+		Body: map[string]any{
+			"error":             code,
+			"error_description": description,
+		},
+	}
+}
@@ -1,8 +1,6 @@
 package oauth2
 
 import (
-	"encoding/base64"
-	"encoding/json"
 	"net/http"
 	"net/url"
 	"strings"
@@ -11,28 +9,47 @@ import (
 	"github.com/sharat87/httpbun/assets"
 	"github.com/sharat87/httpbun/ex"
 	"github.com/sharat87/httpbun/response"
+	"github.com/sharat87/httpbun/util"
 )
 
 // authCodePayload is the data encoded in the authorization code
 type authCodePayload struct {
-	ClientID    string `json:"cid"`
-	RedirectURI string `json:"uri"`
-	State       string `json:"st,omitempty"`
-	Email       string `json:"email"`
-	CreatedAt   int64  `json:"iat"`
+	ID          string     `json:"jti"`
+	ClientID    string     `json:"cid"`
+	RedirectURI string     `json:"uri"`
+	State       string     `json:"st,omitempty"`
+	Email       string     `json:"email"`
+	Scope       string     `json:"scope,omitempty"`
+	Claims      userClaims `json:"claims,omitzero"`
+	Nonce       string     `json:"nonce,omitempty"`
+	CreatedAt   int64      `json:"iat"`
+
+	// PKCE challenge, as per RFC 7636.
+	CodeChallenge       string `json:"cc,omitempty"`
+	CodeChallengeMethod string `json:"ccm,omitempty"`
 }
 
 // accessTokenPayload is the data encoded in the access token
 type accessTokenPayload struct {
-	Email     string `json:"email"`
-	ClientID  string `json:"cid"`
-	CreatedAt int64  `json:"iat"`
+	ID        string     `json:"jti"`
+	Family    string     `json:"fam,omitempty"`
+	Email     string     `json:"email"`
+	ClientID  string     `json:"cid"`
+	Scope     string     `json:"scope,omitempty"`
+	Claims    userClaims `json:"claims,omitzero"`
+	CreatedAt int64      `json:"iat"`
 }
 
 var RouteList = []ex.Route{
 	ex.NewRoute("/oauth2/authorize", handleAuthorize),
 	ex.NewRoute("/oauth2/token", handleToken),
 	ex.NewRoute("/oauth2/userinfo", handleUserinfo),
+	ex.NewRoute("/oauth2/device_authorization", handleDeviceAuthorization),
+	ex.NewRoute("/oauth2/device", handleDevice),
+	ex.NewRoute("/oauth2/introspect", handleIntrospect),
+	ex.NewRoute("/oauth2/revoke", handleRevoke),
+	ex.NewRoute("/oauth2/logout", handleLogout),
+	ex.NewRoute(`/\.well-known/openid-configuration`, handleDiscovery),
 }
 
 func handleAuthorize(ex *ex.Exchange) response.Response {
@@ -68,12 +85,27 @@ func handleAuthorizeGet(ex *ex.Exchange) response.Response {
 	state := query.Get("state")
 	scope := query.Get("scope")
 
+	codeChallenge := query.Get("code_challenge")
+	codeChallengeMethod := query.Get("code_challenge_method")
+	if codeChallenge != "" {
+		var err error
+		if codeChallengeMethod, err = validateCodeChallenge(codeChallenge, codeChallengeMethod); err != nil {
+			return response.BadRequest("Invalid PKCE challenge: %s", err.Error())
+		}
+	} else if codeChallengeMethod != "" {
+		return response.BadRequest("Missing required parameter: code_challenge, since code_challenge_method is given")
+	}
+
 	// Render the consent page
 	return assets.Render("oauth2.html", *ex, map[string]any{
-		"clientID":    clientID,
-		"redirectURI": redirectURI,
-		"state":       state,
-		"scope":       scope,
+		"clientID":            clientID,
+		"redirectURI":         redirectURI,
+		"state":               state,
+		"scope":               scope,
+		"codeChallenge":       codeChallenge,
+		"codeChallengeMethod": codeChallengeMethod,
+		"nonce":               query.Get("nonce"),
+		"openid":              hasScope(scope, "openid"),
 	})
 }
 
@@ -110,19 +142,30 @@ func handleAuthorizePost(ex *ex.Exchange) response.Response {
 
 		// Create authorization code payload
 		payload := authCodePayload{
+			ID:          util.RandomString(),
 			ClientID:    clientID,
 			RedirectURI: redirectURI,
 			State:       state,
 			Email:       email,
+			Scope:       ex.Request.FormValue("scope"),
+			Claims:      userClaimsFromForm(ex),
+			Nonce:       ex.Request.FormValue("nonce"),
 			CreatedAt:   time.Now().Unix(),
+
+			CodeChallenge:       ex.Request.FormValue("code_challenge"),
+			CodeChallengeMethod: ex.Request.FormValue("code_challenge_method"),
 		}
 
-		// Encode as JSON then base64
-		jsonBytes, err := json.Marshal(payload)
+		if payload.CodeChallenge != "" {
+			if payload.CodeChallengeMethod, err = validateCodeChallenge(payload.CodeChallenge, payload.CodeChallengeMethod); err != nil {
+				return response.BadRequest("Invalid PKCE challenge: %s", err.Error())
+			}
+		}
+
+		code, err := encodePayload(kindAuthCode, payload)
 		if err != nil {
 			return response.BadRequest("Failed to generate authorization code")
 		}
-		code := base64.URLEncoding.EncodeToString(jsonBytes)
 
 		q.Set("code", code)
 		if state != "" {
@@ -149,169 +192,100 @@ func handleAuthorizePost(ex *ex.Exchange) response.Response {
 
 func handleToken(ex *ex.Exchange) response.Response {
 	if ex.Request.Method != http.MethodPost {
-		return response.Response{
-			Status: http.StatusMethodNotAllowed,
-			Body: map[string]any{
-				"error":             "invalid_request",
-				"error_description": "Method not allowed. Use POST.",
-			},
-		}
+		return errorResponse(http.StatusMethodNotAllowed, "invalid_request", "Method not allowed. Use POST.")
 	}
 
 	if err := ex.Request.ParseForm(); err != nil {
-		return response.Response{
-			Status: http.StatusBadRequest,
-			Body: map[string]any{
-				"error":             "invalid_request",
-				"error_description": "Failed to parse form data",
-			},
-		}
+		return errorResponse(http.StatusBadRequest, "invalid_request", "Failed to parse form data")
 	}
 
-	grantType := ex.Request.FormValue("grant_type")
-	if grantType != "authorization_code" {
-		return response.Response{
-			Status: http.StatusBadRequest,
-			Body: map[string]any{
-				"error":             "unsupported_grant_type",
-				"error_description": "Only 'authorization_code' grant type is supported",
-			},
-		}
+	switch grantType := ex.Request.FormValue("grant_type"); grantType {
+	case "authorization_code":
+		return handleAuthorizationCodeGrant(ex)
+	case "client_credentials":
+		return handleClientCredentialsGrant(ex)
+	case "refresh_token":
+		return handleRefreshTokenGrant(ex)
+	case DeviceCodeGrantType:
+		return handleDeviceCodeGrant(ex)
 	}
 
+	return errorResponse(
+		http.StatusBadRequest,
+		"unsupported_grant_type",
+		"Supported grant types are 'authorization_code', 'client_credentials', 'refresh_token' and '"+DeviceCodeGrantType+"'",
+	)
+}
+
+func handleAuthorizationCodeGrant(ex *ex.Exchange) response.Response {
 	code := ex.Request.FormValue("code")
 	if code == "" {
-		return response.Response{
-			Status: http.StatusBadRequest,
-			Body: map[string]any{
-				"error":             "invalid_request",
-				"error_description": "Missing required parameter: code",
-			},
-		}
+		return errorResponse(http.StatusBadRequest, "invalid_request", "Missing required parameter: code")
 	}
 
-	clientID := ex.Request.FormValue("client_id")
+	clientID, clientSecret := clientCredentials(ex)
 	if clientID == "" {
-		return response.Response{
-			Status: http.StatusBadRequest,
-			Body: map[string]any{
-				"error":             "invalid_request",
-				"error_description": "Missing required parameter: client_id",
-			},
-		}
-	}
-
-	clientSecret := ex.Request.FormValue("client_secret")
-	if clientSecret == "" {
-		return response.Response{
-			Status: http.StatusBadRequest,
-			Body: map[string]any{
-				"error":             "invalid_request",
-				"error_description": "Missing required parameter: client_secret",
-			},
-		}
+		return errorResponse(http.StatusBadRequest, "invalid_request", "Missing required parameter: client_id")
 	}
 
 	redirectURI := ex.Request.FormValue("redirect_uri")
 	if redirectURI == "" {
-		return response.Response{
-			Status: http.StatusBadRequest,
-			Body: map[string]any{
-				"error":             "invalid_request",
-				"error_description": "Missing required parameter: redirect_uri",
-			},
-		}
+		return errorResponse(http.StatusBadRequest, "invalid_request", "Missing required parameter: redirect_uri")
 	}
 
-	// Decode the authorization code
-	jsonBytes, err := base64.URLEncoding.DecodeString(code)
-	if err != nil {
-		return response.Response{
-			Status: http.StatusBadRequest,
-			Body: map[string]any{
-				"error":             "invalid_grant",
-				"error_description": "Invalid authorization code format",
-			},
-		}
+	var codePayload authCodePayload
+	if err := decodePayload(kindAuthCode, code, &codePayload); err != nil || codePayload.ID == "" {
+		return errorResponse(http.StatusBadRequest, "invalid_grant", "Invalid authorization code")
 	}
 
-	var codePayload authCodePayload
-	if err := json.Unmarshal(jsonBytes, &codePayload); err != nil {
-		return response.Response{
-			Status: http.StatusBadRequest,
-			Body: map[string]any{
-				"error":             "invalid_grant",
-				"error_description": "Invalid authorization code",
-			},
-		}
+	// Public clients, that can't keep a secret, use PKCE instead. Others need the secret.
+	codeVerifier := ex.Request.FormValue("code_verifier")
+	if clientSecret == "" && codePayload.CodeChallenge == "" {
+		return errorResponse(http.StatusBadRequest, "invalid_request", "Missing required parameter: client_secret")
 	}
 
 	// Verify client_id matches
 	if codePayload.ClientID != clientID {
-		return response.Response{
-			Status: http.StatusBadRequest,
-			Body: map[string]any{
-				"error":             "invalid_grant",
-				"error_description": "client_id does not match the authorization request",
-			},
-		}
+		return errorResponse(http.StatusBadRequest, "invalid_grant", "client_id does not match the authorization request")
 	}
 
 	// Verify redirect_uri matches
 	if codePayload.RedirectURI != redirectURI {
-		return response.Response{
-			Status: http.StatusBadRequest,
-			Body: map[string]any{
-				"error":             "invalid_grant",
-				"error_description": "redirect_uri does not match the authorization request",
-			},
-		}
+		return errorResponse(http.StatusBadRequest, "invalid_grant", "redirect_uri does not match the authorization request")
 	}
 
-	// Check if code is expired (10 minutes)
 	createdAt := time.Unix(codePayload.CreatedAt, 0)
-	if time.Since(createdAt) > 10*time.Minute {
-		return response.Response{
-			Status: http.StatusBadRequest,
-			Body: map[string]any{
-				"error":             "invalid_grant",
-				"error_description": "Authorization code has expired",
-			},
-		}
-	}
-
-	// Create access token payload with email
-	tokenPayload := accessTokenPayload{
-		Email:     codePayload.Email,
-		ClientID:  clientID,
-		CreatedAt: time.Now().Unix(),
+	if time.Since(createdAt) > authCodeTTL {
+		return errorResponse(http.StatusBadRequest, "invalid_grant", "Authorization code has expired")
 	}
 
-	tokenBytes, err := json.Marshal(tokenPayload)
-	if err != nil {
-		return response.Response{
-			Status: http.StatusInternalServerError,
-			Body: map[string]any{
-				"error":             "server_error",
-				"error_description": "Failed to generate access token",
-			},
+	// Verify the PKCE code verifier, if a challenge was given to the authorization endpoint, as per RFC 7636.
+	if codePayload.CodeChallenge != "" {
+		if codeVerifier == "" {
+			return errorResponse(http.StatusBadRequest, "invalid_request", "Missing required parameter: code_verifier")
+		}
+		if !verifyCodeVerifier(codeVerifier, codePayload.CodeChallenge, codePayload.CodeChallengeMethod) {
+			return errorResponse(http.StatusBadRequest, "invalid_grant", "code_verifier does not match the code_challenge")
 		}
+	} else if codeVerifier != "" {
+		return errorResponse(http.StatusBadRequest, "invalid_grant", "code_verifier given, but there was no code_challenge in the authorization request")
 	}
 
-	accessToken := base64.URLEncoding.EncodeToString(tokenBytes)
-
-	return response.Response{
-		Status: http.StatusOK,
-		Header: http.Header{
-			"Cache-Control": []string{"no-store"},
-			"Pragma":        []string{"no-cache"},
-		},
-		Body: map[string]any{
-			"access_token": accessToken,
-			"token_type":   "Bearer",
-			"expires_in":   3600,
-		},
+	// Codes are single-use, and the code's ID is the family of the tokens issued for it, so that they're all revoked
+	// if the code is used again.
+	if ok, description := tokens.use(codePayload.ID, codePayload.ID, time.Unix(codePayload.CreatedAt, 0).Add(authCodeTTL)); !ok {
+		return errorResponse(http.StatusBadRequest, "invalid_grant", "Authorization code "+description)
 	}
+
+	return tokenResponse(ex, grant{
+		Email:    codePayload.Email,
+		ClientID: clientID,
+		Scope:    codePayload.Scope,
+		Claims:   codePayload.Claims,
+		AuthTime: codePayload.CreatedAt,
+		Nonce:    codePayload.Nonce,
+		Family:   codePayload.ID,
+	})
 }
 
 func handleUserinfo(ex *ex.Exchange) response.Response {
@@ -329,81 +303,48 @@ func handleUserinfo(ex *ex.Exchange) response.Response {
 	// Get the access token from Authorization header
 	authHeader := ex.HeaderValueLast("Authorization")
 	if authHeader == "" {
-		return response.Response{
-			Status: http.StatusUnauthorized,
-			Header: http.Header{
-				"WWW-Authenticate": []string{"Bearer"},
-			},
-			Body: map[string]any{
-				"error":             "invalid_token",
-				"error_description": "Missing Authorization header",
-			},
-		}
+		return invalidTokenResponse("Missing Authorization header")
 	}
 
 	if !strings.HasPrefix(authHeader, "Bearer ") {
-		return response.Response{
-			Status: http.StatusUnauthorized,
-			Header: http.Header{
-				"WWW-Authenticate": []string{"Bearer"},
-			},
-			Body: map[string]any{
-				"error":             "invalid_token",
-				"error_description": "Invalid Authorization header format. Expected: Bearer <token>",
-			},
-		}
+		return invalidTokenResponse("Invalid Authorization header format. Expected: Bearer <token>")
 	}
 
 	token := strings.TrimPrefix(authHeader, "Bearer ")
 
-	// Decode the access token
-	jsonBytes, err := base64.URLEncoding.DecodeString(token)
-	if err != nil {
-		return response.Response{
-			Status: http.StatusUnauthorized,
-			Header: http.Header{
-				"WWW-Authenticate": []string{"Bearer"},
-			},
-			Body: map[string]any{
-				"error":             "invalid_token",
-				"error_description": "Invalid access token format",
-			},
-		}
-	}
-
 	var tokenPayload accessTokenPayload
-	if err := json.Unmarshal(jsonBytes, &tokenPayload); err != nil {
-		return response.Response{
-			Status: http.StatusUnauthorized,
-			Header: http.Header{
-				"WWW-Authenticate": []string{"Bearer"},
-			},
-			Body: map[string]any{
-				"error":             "invalid_token",
-				"error_description": "Invalid access token",
-			},
-		}
+	if err := decodePayload(kindAccessToken, token, &tokenPayload); err != nil {
+		return invalidTokenResponse("Invalid access token")
 	}
 
-	// Check if token is expired (1 hour)
 	createdAt := time.Unix(tokenPayload.CreatedAt, 0)
-	if time.Since(createdAt) > time.Hour {
-		return response.Response{
-			Status: http.StatusUnauthorized,
-			Header: http.Header{
-				"WWW-Authenticate": []string{"Bearer"},
-			},
-			Body: map[string]any{
-				"error":             "invalid_token",
-				"error_description": "Access token has expired",
-			},
-		}
+	if time.Since(createdAt) > accessTokenTTL {
+		return invalidTokenResponse("Access token has expired")
+	}
+
+	if tokens.isRevoked(tokenPayload.ID, tokenPayload.Family) {
+		return invalidTokenResponse("Access token has been revoked")
+	}
+
+	if tokenPayload.Email == "" {
+		return invalidTokenResponse("Access token was issued to a client, there's no user")
 	}
 
 	return response.Response{
 		Status: http.StatusOK,
+		Body:   tokenPayload.Claims.forScope(tokenPayload.Email, tokenPayload.Scope),
+	}
+}
+
+func invalidTokenResponse(description string) response.Response {
+	return response.Response{
+		Status: http.StatusUnauthorized,
+		Header: http.Header{
+			"WWW-Authenticate": []string{"Bearer"},
+		},
 		Body: map[string]any{
-			"email": tokenPayload.Email,
+			"error":             "invalid_token",
+			"error_description": description,
 		},
 	}
 }
@@ -0,0 +1,175 @@
+package oauth2
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/sharat87/httpbun/ex"
+	"github.com/sharat87/httpbun/response"
+)
+
+// tokenInfo is what's common to access and refresh tokens, to introspect or revoke either.
+type tokenInfo struct {
+	TokenType string
+	ID        string
+	Family    string
+	Email     string
+	ClientID  string
+	Scope     string
+	CreatedAt time.Time
+	ExpiresAt time.Time
+}
+
+// findTokenInfo decodes the token as an access token or a refresh token, trying the kind in the hint first, as per RFC
+// 7009, section 2.1.
+func findTokenInfo(token, hint string) (tokenInfo, bool) {
+	kinds := []string{kindAccessToken, kindRefreshToken}
+	if hint == "refresh_token" {
+		kinds = []string{kindRefreshToken, kindAccessToken}
+	}
+
+	for _, kind := range kinds {
+		if kind == kindAccessToken {
+			var payload accessTokenPayload
+			if decodePayload(kindAccessToken, token, &payload) == nil {
+				createdAt := time.Unix(payload.CreatedAt, 0)
+				return tokenInfo{
+					TokenType: "Bearer",
+					ID:        payload.ID,
+					Family:    payload.Family,
+					Email:     payload.Email,
+					ClientID:  payload.ClientID,
+					Scope:     payload.Scope,
+					CreatedAt: createdAt,
+					ExpiresAt: createdAt.Add(accessTokenTTL),
+				}, true
+			}
+		} else {
+			var payload refreshTokenPayload
+			if decodePayload(kindRefreshToken, token, &payload) == nil {
+				createdAt := time.Unix(payload.CreatedAt, 0)
+				return tokenInfo{
+					TokenType: "refresh_token",
+					ID:        payload.ID,
+					Family:    payload.Family,
+					Email:     payload.Email,
+					ClientID:  payload.ClientID,
+					Scope:     payload.Scope,
+					CreatedAt: createdAt,
+					ExpiresAt: createdAt.Add(refreshTokenTTL),
+				}, true
+			}
+		}
+	}
+
+	return tokenInfo{}, false
+}
+
+// isActive tells if the token can still be used. Refresh tokens can only be used once.
+func (info tokenInfo) isActive() bool {
+	if !time.Now().Before(info.ExpiresAt) || tokens.isRevoked(info.ID, info.Family) {
+		return false
+	}
+	return info.TokenType != "refresh_token" || !tokens.isUsed(info.ID)
+}
+
+// handleIntrospect tells if a token is active, and what it grants, as per RFC 7662. It needs client credentials, of any
+// client, like a resource server would have.
+func handleIntrospect(ex *ex.Exchange) response.Response {
+	token, errResp := parseTokenRequest(ex)
+	if errResp != nil {
+		return *errResp
+	}
+
+	if clientID, clientSecret := clientCredentials(ex); clientID == "" || clientSecret == "" {
+		resp := errorResponse(http.StatusUnauthorized, "invalid_client", "Client authentication is required, with client_id and client_secret")
+		resp.Header.Set("WWW-Authenticate", `Basic realm="httpbun"`)
+		return resp
+	}
+
+	body := map[string]any{
+		"active": false,
+	}
+
+	if info, ok := findTokenInfo(token, ex.Request.FormValue("token_type_hint")); ok && info.isActive() {
+		body["active"] = true
+		body["token_type"] = info.TokenType
+		body["client_id"] = info.ClientID
+		body["iss"] = issuer(ex)
+		body["jti"] = info.ID
+		body["iat"] = info.CreatedAt.Unix()
+		body["exp"] = info.ExpiresAt.Unix()
+
+		if info.Scope != "" {
+			body["scope"] = info.Scope
+		}
+
+		if info.Email != "" {
+			body["sub"] = subjectFor(info.Email)
+			body["username"] = info.Email
+		}
+	}
+
+	return response.Response{
+		Status: http.StatusOK,
+		Header: http.Header{
+			"Cache-Control": []string{"no-store"},
+		},
+		Body: body,
+	}
+}
+
+// handleRevoke revokes a token, as per RFC 7009. Revoking a refresh token revokes all the tokens from the same
+// authorization, while revoking an access token revokes only that.
+func handleRevoke(ex *ex.Exchange) response.Response {
+	token, errResp := parseTokenRequest(ex)
+	if errResp != nil {
+		return *errResp
+	}
+
+	clientID, _ := clientCredentials(ex)
+	if clientID == "" {
+		return errorResponse(http.StatusBadRequest, "invalid_request", "Missing required parameter: client_id")
+	}
+
+	// Invalid tokens are not an error, since the client can't do anything about them, as per RFC 7009, section 2.2.
+	if info, ok := findTokenInfo(token, ex.Request.FormValue("token_type_hint")); ok {
+		if info.ClientID != clientID {
+			return errorResponse(http.StatusBadRequest, "unauthorized_client", "The token was issued to another client")
+		}
+
+		if info.TokenType == "refresh_token" {
+			tokens.revokeFamily(info.Family)
+		} else {
+			tokens.revoke(info.ID, info.ExpiresAt)
+		}
+	}
+
+	return response.Response{
+		Status: http.StatusOK,
+		Header: http.Header{
+			"Cache-Control": []string{"no-store"},
+		},
+		Body: map[string]any{},
+	}
+}
+
+func parseTokenRequest(ex *ex.Exchange) (string, *response.Response) {
+	if ex.Request.Method != http.MethodPost {
+		resp := errorResponse(http.StatusMethodNotAllowed, "invalid_request", "Method not allowed. Use POST.")
+		return "", &resp
+	}
+
+	if err := ex.Request.ParseForm(); err != nil {
+		resp := errorResponse(http.StatusBadRequest, "invalid_request", "Failed to parse form data")
+		return "", &resp
+	}
+
+	token := ex.Request.FormValue("token")
+	if token == "" {
+		resp := errorResponse(http.StatusBadRequest, "invalid_request", "Missing required parameter: token")
+		return "", &resp
+	}
+
+	return token, nil
+}
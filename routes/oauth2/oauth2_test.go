@@ -0,0 +1,439 @@
+package oauth2
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/sharat87/httpbun/ex"
+	"github.com/sharat87/httpbun/routes/jwt"
+	"github.com/sharat87/httpbun/util"
+)
+
+func postForm(path string, fn ex.HandlerFn, form url.Values) map[string]any {
+	resp := ex.InvokeHandlerForTest(
+		path[1:],
+		http.Request{
+			Method: http.MethodPost,
+			Header: http.Header{
+				"Content-Type": {"application/x-www-form-urlencoded"},
+			},
+			Body: io.NopCloser(strings.NewReader(form.Encode())),
+		},
+		path,
+		fn,
+	)
+	body := resp.Body.(map[string]any)
+	body["status"] = resp.Status
+	return body
+}
+
+func TestVerifyCodeVerifier(t *testing.T) {
+	s := assert.New(t)
+
+	verifier := "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFbEjXk"
+	challenge := "N4-5v7LG-T8x3fWSLZ-7W4IevaqpPl0Ln-6oRgYUj1Q"
+
+	s.True(verifyCodeVerifier(verifier, challenge, "S256"))
+	s.False(verifyCodeVerifier(verifier, challenge, "plain"))
+	s.True(verifyCodeVerifier(verifier, verifier, "plain"))
+	s.False(verifyCodeVerifier("short", "short", "plain"))
+
+	method, err := validateCodeChallenge(challenge, "")
+	s.NoError(err)
+	s.Equal("plain", method)
+
+	_, err = validateCodeChallenge(challenge, "S512")
+	s.Error(err)
+
+	_, err = validateCodeChallenge("too-short", "S256")
+	s.Error(err)
+}
+
+func TestAuthorizationCodeWithPKCE(t *testing.T) {
+	s := assert.New(t)
+
+	verifier := "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFbEjXk"
+	code, _ := encodePayload(kindAuthCode, authCodePayload{
+		ID:                  util.RandomString(),
+		ClientID:            "app",
+		RedirectURI:         "http://example.com/cb",
+		Email:               "dave@example.com",
+		Scope:               "read",
+		CreatedAt:           time.Now().Unix(),
+		CodeChallenge:       "N4-5v7LG-T8x3fWSLZ-7W4IevaqpPl0Ln-6oRgYUj1Q",
+		CodeChallengeMethod: "S256",
+	})
+
+	form := url.Values{
+		"grant_type":   {"authorization_code"},
+		"code":         {code},
+		"client_id":    {"app"},
+		"redirect_uri": {"http://example.com/cb"},
+	}
+
+	body := postForm("/oauth2/token", handleToken, form)
+	s.Equal(400, body["status"])
+	s.Equal("invalid_request", body["error"])
+
+	form.Set("code_verifier", strings.Repeat("x", 43))
+	body = postForm("/oauth2/token", handleToken, form)
+	s.Equal(400, body["status"])
+	s.Equal("invalid_grant", body["error"])
+
+	form.Set("code_verifier", verifier)
+	body = postForm("/oauth2/token", handleToken, form)
+	s.Equal(200, body["status"])
+	s.Equal("read", body["scope"])
+	s.NotEmpty(body["access_token"])
+	s.NotEmpty(body["refresh_token"])
+}
+
+func TestRefreshTokenRotation(t *testing.T) {
+	s := assert.New(t)
+
+	first := tokenResponse(nil, grant{Email: "dave@example.com", ClientID: "app", Scope: "read write", Family: "family-1"}).Body.(map[string]any)
+
+	form := url.Values{
+		"grant_type":    {"refresh_token"},
+		"refresh_token": {first["refresh_token"].(string)},
+		"client_id":     {"app"},
+	}
+
+	second := postForm("/oauth2/token", handleToken, form)
+	s.Equal(200, second["status"])
+	s.Equal("read write", second["scope"])
+	s.NotEqual(first["refresh_token"], second["refresh_token"])
+
+	// Reusing the first refresh token revokes the whole family, including the second refresh token.
+	body := postForm("/oauth2/token", handleToken, form)
+	s.Equal(400, body["status"])
+	s.Equal("invalid_grant", body["error"])
+
+	form.Set("refresh_token", second["refresh_token"].(string))
+	body = postForm("/oauth2/token", handleToken, form)
+	s.Equal(400, body["status"])
+	s.Equal("Refresh token has been revoked", body["error_description"])
+}
+
+func TestRefreshTokenNarrowerScope(t *testing.T) {
+	s := assert.New(t)
+
+	first := tokenResponse(nil, grant{Email: "dave@example.com", ClientID: "app", Scope: "read write", Family: "family-2"}).Body.(map[string]any)
+
+	form := url.Values{
+		"grant_type":    {"refresh_token"},
+		"refresh_token": {first["refresh_token"].(string)},
+		"client_id":     {"app"},
+		"scope":         {"read admin"},
+	}
+
+	body := postForm("/oauth2/token", handleToken, form)
+	s.Equal(400, body["status"])
+	s.Equal("invalid_scope", body["error"])
+
+	form.Set("scope", "read")
+	body = postForm("/oauth2/token", handleToken, form)
+	s.Equal(200, body["status"])
+	s.Equal("read", body["scope"])
+}
+
+func TestClientCredentials(t *testing.T) {
+	s := assert.New(t)
+
+	body := postForm("/oauth2/token", handleToken, url.Values{
+		"grant_type": {"client_credentials"},
+		"client_id":  {"app"},
+	})
+	s.Equal(401, body["status"])
+	s.Equal("invalid_client", body["error"])
+
+	body = postForm("/oauth2/token", handleToken, url.Values{
+		"grant_type":    {"client_credentials"},
+		"client_id":     {"app"},
+		"client_secret": {"secret"},
+		"scope":         {"reports"},
+	})
+	s.Equal(200, body["status"])
+	s.Equal("reports", body["scope"])
+	s.Nil(body["refresh_token"])
+}
+
+func TestDeviceCodeFlow(t *testing.T) {
+	s := assert.New(t)
+
+	auth := devices.add("tv", "watch")
+	s.Regexp(`^[BCDFGHJKLMNPQRSTVWXZ]{4}-[BCDFGHJKLMNPQRSTVWXZ]{4}$`, auth.UserCode)
+
+	form := url.Values{
+		"grant_type":  {DeviceCodeGrantType},
+		"device_code": {auth.DeviceCode},
+		"client_id":   {"tv"},
+	}
+
+	s.Equal("authorization_pending", postForm("/oauth2/token", handleToken, form)["error"])
+	s.Equal("slow_down", postForm("/oauth2/token", handleToken, form)["error"])
+
+	// Each slow_down adds 5 seconds to the interval, so polling after the first interval is still too soon.
+	devices.mu.Lock()
+	devices.byDevice[auth.DeviceCode].LastPolled = time.Now().Add(-devicePollInterval - time.Second)
+	devices.mu.Unlock()
+	body := postForm("/oauth2/token", handleToken, form)
+	s.Equal("slow_down", body["error"])
+	s.Equal("Polling too often, wait 15 seconds between polls", body["error_description"])
+
+	devices.mu.Lock()
+	devices.byDevice[auth.DeviceCode].LastPolled = time.Now().Add(-3 * devicePollInterval)
+	devices.mu.Unlock()
+	s.Equal("authorization_pending", postForm("/oauth2/token", handleToken, form)["error"])
+
+	_, ok := devices.decide(strings.ToLower(strings.ReplaceAll(auth.UserCode, "-", "")), true, "dave@example.com")
+	s.True(ok)
+
+	body = postForm("/oauth2/token", handleToken, form)
+	s.Equal(200, body["status"])
+	s.Equal("watch", body["scope"])
+
+	// The device code can only be exchanged once.
+	s.Equal("invalid_grant", postForm("/oauth2/token", handleToken, form)["error"])
+
+	auth = devices.add("tv", "")
+	form.Set("device_code", auth.DeviceCode)
+	_, ok = devices.decide(auth.UserCode, false, "")
+	s.True(ok)
+	s.Equal("access_denied", postForm("/oauth2/token", handleToken, form)["error"])
+}
+
+func TestIDToken(t *testing.T) {
+	s := assert.New(t)
+
+	authTime := time.Now().Add(-time.Minute).Unix()
+	code, _ := encodePayload(kindAuthCode, authCodePayload{
+		ID:          util.RandomString(),
+		ClientID:    "app",
+		RedirectURI: "http://example.com/cb",
+		Email:       "dave@example.com",
+		Scope:       "openid email",
+		Claims:      userClaims{Name: "Dave", EmailVerified: true},
+		Nonce:       "n-0S6_WzA2Mj",
+		CreatedAt:   authTime,
+	})
+
+	body := postForm("/oauth2/token", handleToken, url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"client_id":     {"app"},
+		"client_secret": {"secret"},
+		"redirect_uri":  {"http://example.com/cb"},
+	})
+	s.Equal(200, body["status"])
+
+	result := jwt.Verify(body["id_token"].(string), jwt.VerifyOptions{Audience: "app"})
+	s.Empty(result.Failures)
+	s.Equal("RS256", result.Header["alg"])
+	s.Equal(subjectFor("dave@example.com"), result.Claims["sub"])
+	s.Equal("n-0S6_WzA2Mj", result.Claims["nonce"])
+	s.Equal(json.Number(strconv.FormatInt(authTime, 10)), result.Claims["auth_time"])
+	s.Equal("dave@example.com", result.Claims["email"])
+	s.Equal(true, result.Claims["email_verified"])
+	s.Nil(result.Claims["name"], "profile scope wasn't granted")
+
+	sum := sha256.Sum256([]byte(body["access_token"].(string)))
+	s.Equal(base64.RawURLEncoding.EncodeToString(sum[:16]), result.Claims["at_hash"])
+
+	// A refreshed ID token keeps the auth_time, but not the nonce.
+	refreshed := postForm("/oauth2/token", handleToken, url.Values{
+		"grant_type":    {"refresh_token"},
+		"refresh_token": {body["refresh_token"].(string)},
+		"client_id":     {"app"},
+	})
+	result = jwt.Verify(refreshed["id_token"].(string), jwt.VerifyOptions{Audience: "app"})
+	s.Empty(result.Failures)
+	s.Equal(json.Number(strconv.FormatInt(authTime, 10)), result.Claims["auth_time"])
+	s.Nil(result.Claims["nonce"])
+}
+
+func TestUserClaimsForScope(t *testing.T) {
+	s := assert.New(t)
+
+	claims := userClaims{Name: "Dave", Locale: "en-IN", PhoneNumber: "+91 555 0100"}
+	sub := subjectFor("Dave@example.com")
+	s.Equal(sub, subjectFor("dave@example.com"))
+
+	s.Equal(map[string]any{
+		"sub":            sub,
+		"email":          "dave@example.com",
+		"email_verified": false,
+		"name":           "Dave",
+		"locale":         "en-IN",
+		"phone_number":   "+91 555 0100",
+	}, claims.forScope("dave@example.com", "read"))
+
+	s.Equal(map[string]any{
+		"sub":    sub,
+		"name":   "Dave",
+		"locale": "en-IN",
+	}, claims.forScope("dave@example.com", "openid profile"))
+
+	s.Equal(map[string]any{"sub": sub}, claims.forScope("dave@example.com", "openid"))
+}
+
+func TestTokensAreSigned(t *testing.T) {
+	s := assert.New(t)
+
+	token, err := encodePayload(kindAccessToken, accessTokenPayload{Email: "dave@example.com"})
+	s.NoError(err)
+
+	var payload accessTokenPayload
+	s.NoError(decodePayload(kindAccessToken, token, &payload))
+	s.Equal("dave@example.com", payload.Email)
+
+	// Another kind of token, with the same payload, doesn't pass.
+	s.ErrorIs(decodePayload(kindRefreshToken, token, &payload), errInvalidSignature)
+
+	// Changing the payload breaks the signature.
+	encoded, signature, _ := strings.Cut(token, ".")
+	forged := base64.RawURLEncoding.EncodeToString([]byte(`{"email":"eve@example.com"}`))
+	s.ErrorIs(decodePayload(kindAccessToken, forged+"."+signature, &payload), errInvalidSignature)
+
+	// Unsigned base64 JSON, like tokens used to be, doesn't pass either.
+	s.ErrorIs(decodePayload(kindAccessToken, encoded, &payload), errInvalidSignature)
+}
+
+func TestAuthorizationCodeIsSingleUse(t *testing.T) {
+	s := assert.New(t)
+
+	code, _ := encodePayload(kindAuthCode, authCodePayload{
+		ID:          util.RandomString(),
+		ClientID:    "app",
+		RedirectURI: "http://example.com/cb",
+		Email:       "dave@example.com",
+		CreatedAt:   time.Now().Unix(),
+	})
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"client_id":     {"app"},
+		"client_secret": {"secret"},
+		"redirect_uri":  {"http://example.com/cb"},
+	}
+
+	first := postForm("/oauth2/token", handleToken, form)
+	s.Equal(200, first["status"])
+
+	body := postForm("/oauth2/token", handleToken, form)
+	s.Equal(400, body["status"])
+	s.Equal("invalid_grant", body["error"])
+
+	// Tokens from the first use of the code are revoked now.
+	introspected := postForm("/oauth2/introspect", handleIntrospect, url.Values{
+		"token":         {first["access_token"].(string)},
+		"client_id":     {"gateway"},
+		"client_secret": {"secret"},
+	})
+	s.Equal(false, introspected["active"])
+}
+
+func TestIntrospectAndRevoke(t *testing.T) {
+	s := assert.New(t)
+
+	issued := tokenResponse(nil, grant{Email: "dave@example.com", ClientID: "app", Scope: "read", Family: util.RandomString()}).Body.(map[string]any)
+	accessToken := issued["access_token"].(string)
+	refreshToken := issued["refresh_token"].(string)
+
+	introspect := func(token string) map[string]any {
+		return postForm("/oauth2/introspect", handleIntrospect, url.Values{
+			"token":         {token},
+			"client_id":     {"gateway"},
+			"client_secret": {"secret"},
+		})
+	}
+
+	body := postForm("/oauth2/introspect", handleIntrospect, url.Values{"token": {accessToken}})
+	s.Equal(401, body["status"])
+	s.Equal("invalid_client", body["error"])
+
+	body = introspect(accessToken)
+	s.Equal(true, body["active"])
+	s.Equal("Bearer", body["token_type"])
+	s.Equal("app", body["client_id"])
+	s.Equal("read", body["scope"])
+	s.Equal("dave@example.com", body["username"])
+	s.Equal(subjectFor("dave@example.com"), body["sub"])
+
+	body = introspect(refreshToken)
+	s.Equal(true, body["active"])
+	s.Equal("refresh_token", body["token_type"])
+
+	s.Equal(map[string]any{"active": false, "status": 200}, introspect("not-a-token"))
+
+	// Only the client the token was issued to can revoke it.
+	body = postForm("/oauth2/revoke", handleRevoke, url.Values{"token": {accessToken}, "client_id": {"other"}})
+	s.Equal(400, body["status"])
+	s.Equal("unauthorized_client", body["error"])
+
+	// Invalid tokens are fine to revoke.
+	body = postForm("/oauth2/revoke", handleRevoke, url.Values{"token": {"not-a-token"}, "client_id": {"app"}})
+	s.Equal(200, body["status"])
+
+	// Revoking the access token leaves the refresh token.
+	body = postForm("/oauth2/revoke", handleRevoke, url.Values{"token": {accessToken}, "client_id": {"app"}})
+	s.Equal(200, body["status"])
+	s.Equal(false, introspect(accessToken)["active"])
+	s.Equal(true, introspect(refreshToken)["active"])
+
+	// Revoking the refresh token revokes everything from the same authorization.
+	refreshed := postForm("/oauth2/token", handleToken, url.Values{"grant_type": {"refresh_token"}, "refresh_token": {refreshToken}, "client_id": {"app"}})
+	s.Equal(200, refreshed["status"])
+	s.Equal(false, introspect(refreshToken)["active"], "used refresh tokens are not active")
+	s.Equal(true, introspect(refreshed["access_token"].(string))["active"])
+
+	body = postForm("/oauth2/revoke", handleRevoke, url.Values{
+		"token":           {refreshed["refresh_token"].(string)},
+		"token_type_hint": {"refresh_token"},
+		"client_id":       {"app"},
+	})
+	s.Equal(200, body["status"])
+	s.Equal(false, introspect(refreshed["access_token"].(string))["active"])
+	s.Equal(false, introspect(refreshed["refresh_token"].(string))["active"])
+}
+
+func TestTokenStoreKeepsLiveEntries(t *testing.T) {
+	s := assert.New(t)
+	store := &tokenStore{
+		used:            map[string]time.Time{},
+		revoked:         map[string]time.Time{},
+		revokedFamilies: map[string]time.Time{},
+	}
+
+	store.revoke("expired", time.Now().Add(-time.Second))
+	for i := range 20000 {
+		ok, _ := store.use("code-"+strconv.Itoa(i), "code-"+strconv.Itoa(i), time.Now().Add(authCodeTTL))
+		s.True(ok)
+	}
+	store.revoke("live", time.Now().Add(accessTokenTTL))
+	store.revokeFamily("family")
+
+	// Nothing live is ever forgotten, however many entries there are.
+	s.True(store.isUsed("code-0"))
+	s.True(store.isRevoked("live", ""))
+	s.True(store.isRevoked("other", "family"))
+	ok, _ := store.use("code-0", "code-0", time.Now().Add(authCodeTTL))
+	s.False(ok)
+
+	// Expired entries are pruned.
+	store.nextPrune = time.Time{}
+	store.prune()
+	s.False(store.isRevoked("expired", ""))
+	s.Len(store.used, 20000)
+}
@@ -0,0 +1,219 @@
+package oauth2
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/sharat87/httpbun/assets"
+	"github.com/sharat87/httpbun/ex"
+	"github.com/sharat87/httpbun/response"
+	"github.com/sharat87/httpbun/routes/jwt"
+)
+
+// Algorithm ID tokens are signed with. RS256 is the one all OpenID Connect clients support.
+const idTokenAlgorithm = "RS256"
+
+var supportedScopes = []string{"openid", "profile", "email", "phone"}
+
+// userClaims are the claims about the user, other than the email, entered on the consent page.
+type userClaims struct {
+	Name              string `json:"name,omitempty"`
+	GivenName         string `json:"given_name,omitempty"`
+	FamilyName        string `json:"family_name,omitempty"`
+	PreferredUsername string `json:"preferred_username,omitempty"`
+	Picture           string `json:"picture,omitempty"`
+	Locale            string `json:"locale,omitempty"`
+	PhoneNumber       string `json:"phone_number,omitempty"`
+	EmailVerified     bool   `json:"email_verified,omitempty"`
+}
+
+func userClaimsFromForm(ex *ex.Exchange) userClaims {
+	return userClaims{
+		Name:              ex.Request.FormValue("name"),
+		GivenName:         ex.Request.FormValue("given_name"),
+		FamilyName:        ex.Request.FormValue("family_name"),
+		PreferredUsername: ex.Request.FormValue("preferred_username"),
+		Picture:           ex.Request.FormValue("picture"),
+		Locale:            ex.Request.FormValue("locale"),
+		PhoneNumber:       ex.Request.FormValue("phone_number"),
+		EmailVerified:     ex.Request.FormValue("email_verified") != "",
+	}
+}
+
+// forScope gives the claims the scope allows, as per OpenID Connect Core, section 5.4. Tokens without the `openid`
+// scope are plain OAuth2 tokens, and get all the claims.
+func (u userClaims) forScope(email, scope string) map[string]any {
+	all := !hasScope(scope, "openid")
+	claims := map[string]any{
+		"sub": subjectFor(email),
+	}
+
+	if all || hasScope(scope, "email") {
+		claims["email"] = email
+		claims["email_verified"] = u.EmailVerified
+	}
+
+	if all || hasScope(scope, "profile") {
+		for name, value := range map[string]string{
+			"name":               u.Name,
+			"given_name":         u.GivenName,
+			"family_name":        u.FamilyName,
+			"preferred_username": u.PreferredUsername,
+			"picture":            u.Picture,
+			"locale":             u.Locale,
+		} {
+			if value != "" {
+				claims[name] = value
+			}
+		}
+	}
+
+	if (all || hasScope(scope, "phone")) && u.PhoneNumber != "" {
+		claims["phone_number"] = u.PhoneNumber
+	}
+
+	return claims
+}
+
+// subjectFor gives the `sub` claim for the user with the email. It's always the same for the same email.
+func subjectFor(email string) string {
+	sum := sha256.Sum256([]byte(strings.ToLower(email)))
+	return hex.EncodeToString(sum[:16])
+}
+
+// signIDToken makes the ID token for the grant, as per OpenID Connect Core, section 2.
+func signIDToken(ex *ex.Exchange, g grant, accessToken string, now time.Time) (string, error) {
+	claims := g.Claims.forScope(g.Email, g.Scope)
+
+	// Left half of the hash of the access token, as per OpenID Connect Core, section 3.1.3.6.
+	atHash := sha256.Sum256([]byte(accessToken))
+
+	claims["iss"] = issuer(ex)
+	claims["aud"] = g.ClientID
+	claims["iat"] = now.Unix()
+	claims["exp"] = now.Add(accessTokenTTL).Unix()
+	claims["at_hash"] = base64.RawURLEncoding.EncodeToString(atHash[:len(atHash)/2])
+
+	if g.AuthTime != 0 {
+		claims["auth_time"] = g.AuthTime
+	}
+
+	if g.Nonce != "" {
+		claims["nonce"] = g.Nonce
+	}
+
+	return jwt.Sign(idTokenAlgorithm, claims, jwt.SignOptions{})
+}
+
+func issuer(ex *ex.Exchange) string {
+	return ex.AbsoluteUrl("")
+}
+
+// handleDiscovery serves the provider metadata, as per OpenID Connect Discovery, section 3.
+func handleDiscovery(ex *ex.Exchange) response.Response {
+	return response.Response{
+		Header: http.Header{
+			"Cache-Control": {"public, max-age=300"},
+		},
+		Body: map[string]any{
+			"issuer":                                issuer(ex),
+			"authorization_endpoint":                ex.AbsoluteUrl("/oauth2/authorize"),
+			"token_endpoint":                        ex.AbsoluteUrl("/oauth2/token"),
+			"userinfo_endpoint":                     ex.AbsoluteUrl("/oauth2/userinfo"),
+			"jwks_uri":                              ex.AbsoluteUrl("/.well-known/jwks.json"),
+			"end_session_endpoint":                  ex.AbsoluteUrl("/oauth2/logout"),
+			"device_authorization_endpoint":         ex.AbsoluteUrl("/oauth2/device_authorization"),
+			"introspection_endpoint":                ex.AbsoluteUrl("/oauth2/introspect"),
+			"revocation_endpoint":                   ex.AbsoluteUrl("/oauth2/revoke"),
+			"scopes_supported":                      supportedScopes,
+			"response_types_supported":              []string{"code"},
+			"response_modes_supported":              []string{"query"},
+			"grant_types_supported":                 []string{"authorization_code", "client_credentials", "refresh_token", DeviceCodeGrantType},
+			"subject_types_supported":               []string{"public"},
+			"id_token_signing_alg_values_supported": []string{idTokenAlgorithm},
+			"token_endpoint_auth_methods_supported": []string{"client_secret_basic", "client_secret_post", "none"},
+			"code_challenge_methods_supported":      []string{"S256", "plain"},
+			"claims_supported": []string{
+				"sub", "iss", "aud", "exp", "iat", "auth_time", "nonce", "at_hash",
+				"email", "email_verified", "name", "given_name", "family_name", "preferred_username", "picture",
+				"locale", "phone_number",
+			},
+		},
+	}
+}
+
+// handleLogout is the end session endpoint, for RP-initiated logout, as per OpenID Connect RP-Initiated Logout 1.0.
+// There's no session to end, so this only checks the request, and then redirects back, or shows a logged out page.
+func handleLogout(ex *ex.Exchange) response.Response {
+	if ex.Request.Method != http.MethodGet && ex.Request.Method != http.MethodPost {
+		return response.Response{
+			Status: http.StatusMethodNotAllowed,
+			Body:   "Method not allowed. Use GET or POST.",
+		}
+	}
+
+	if err := ex.Request.ParseForm(); err != nil {
+		return response.BadRequest("Failed to parse form data")
+	}
+
+	clientID := ex.Request.FormValue("client_id")
+	idTokenHint := ex.Request.FormValue("id_token_hint")
+	redirectURI := ex.Request.FormValue("post_logout_redirect_uri")
+	state := ex.Request.FormValue("state")
+
+	var subject string
+	if idTokenHint != "" {
+		// An expired ID token is fine as a hint, as per section 2 of the spec.
+		result := jwt.Verify(idTokenHint, jwt.VerifyOptions{Issuer: issuer(ex)})
+		for _, failure := range result.Failures {
+			if failure.Check != "exp" {
+				return response.BadRequest("Invalid id_token_hint, %s: %s", failure.Check, failure.Error)
+			}
+		}
+
+		audience, _ := result.Claims["aud"].(string)
+		if clientID == "" {
+			clientID = audience
+		} else if clientID != audience {
+			return response.BadRequest("client_id does not match the audience of id_token_hint")
+		}
+
+		subject, _ = result.Claims["sub"].(string)
+	}
+
+	// Redirecting back needs an ID token issued here, so this can't be used to redirect anywhere with a made up
+	// client_id.
+	if redirectURI != "" {
+		if idTokenHint == "" {
+			return response.BadRequest("Missing id_token_hint, needed with post_logout_redirect_uri")
+		}
+
+		parsedURI, err := url.Parse(redirectURI)
+		if err != nil || !parsedURI.IsAbs() {
+			return response.BadRequest("Invalid post_logout_redirect_uri")
+		}
+
+		if state != "" {
+			q := parsedURI.Query()
+			q.Set("state", state)
+			parsedURI.RawQuery = q.Encode()
+		}
+
+		return response.Response{
+			Status: http.StatusFound,
+			Header: http.Header{
+				"Location": []string{parsedURI.String()},
+			},
+		}
+	}
+
+	return assets.Render("oauth2-logout.html", *ex, map[string]any{
+		"clientID": clientID,
+		"subject":  subject,
+	})
+}
@@ -0,0 +1,46 @@
+package oauth2
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"regexp"
+)
+
+// Syntax of a PKCE code verifier, and of a code challenge, as per RFC 7636, section 4.1.
+var pkcePattern = regexp.MustCompile(`^[A-Za-z0-9\-._~]{43,128}$`)
+
+// validateCodeChallenge checks the challenge given to the authorization endpoint, and gives the method, which defaults
+// to `plain`.
+func validateCodeChallenge(challenge, method string) (string, error) {
+	if method == "" {
+		method = "plain"
+	}
+
+	if method != "plain" && method != "S256" {
+		return "", errors.New("code_challenge_method should be 'S256' or 'plain'")
+	}
+
+	if !pkcePattern.MatchString(challenge) {
+		return "", errors.New("code_challenge should be 43 to 128 characters, of letters, digits, '-', '.', '_' or '~'")
+	}
+
+	return method, nil
+}
+
+// verifyCodeVerifier checks the verifier given to the token endpoint against the challenge given to the authorization
+// endpoint, as per RFC 7636, section 4.6.
+func verifyCodeVerifier(verifier, challenge, method string) bool {
+	if !pkcePattern.MatchString(verifier) {
+		return false
+	}
+
+	expected := verifier
+	if method == "S256" {
+		sum := sha256.Sum256([]byte(verifier))
+		expected = base64.RawURLEncoding.EncodeToString(sum[:])
+	}
+
+	return subtle.ConstantTimeCompare([]byte(expected), []byte(challenge)) == 1
+}
@@ -0,0 +1,175 @@
+package oauth2
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sharat87/httpbun/util"
+)
+
+// Kinds of tokens. The kind is part of what's signed, so that one kind of token can't be passed off as another.
+const (
+	kindAuthCode     = "code"
+	kindAccessToken  = "access"
+	kindRefreshToken = "refresh"
+)
+
+// How often entries for expired tokens are pruned from the token store.
+const tokenPruneInterval = time.Minute
+
+// Key that codes and tokens are signed with. It's made afresh on each start, so codes and tokens from before a restart
+// don't work anymore.
+var signingKey = util.RandomBytes(32)
+
+var errInvalidSignature = errors.New("invalid signature")
+
+// tokenStore remembers the codes and refresh tokens that have been used, and the tokens and token families that have
+// been revoked. All tokens that came from the same authorization share a family. Each entry is kept until the tokens it
+// is about have expired, since they can't be used after that anyway.
+type tokenStore struct {
+	mu sync.Mutex
+
+	// Expiry of each entry.
+	used            map[string]time.Time
+	revoked         map[string]time.Time
+	revokedFamilies map[string]time.Time
+
+	nextPrune time.Time
+}
+
+var tokens = &tokenStore{
+	used:            map[string]time.Time{},
+	revoked:         map[string]time.Time{},
+	revokedFamilies: map[string]time.Time{},
+}
+
+// use marks the single-use code or refresh token, which expires at the given time, as used, and tells if it's fine to
+// use it. Using one a second time revokes its family, so that the tokens issued with the first use stop working too,
+// as per RFC 6749, section 4.1.2, and the OAuth 2.0 Security BCP.
+func (s *tokenStore) use(id, family string, expires time.Time) (ok bool, description string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.prune()
+
+	if _, revoked := s.revokedFamilies[family]; revoked {
+		return false, "has been revoked"
+	}
+
+	if _, used := s.used[id]; used {
+		s.revokedFamilies[family] = familyExpiry()
+		return false, "has already been used, all tokens from this grant are now revoked"
+	}
+
+	s.used[id] = expires
+	return true, ""
+}
+
+// revoke revokes the single token with the ID, which expires at the given time.
+func (s *tokenStore) revoke(id string, expires time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.prune()
+	s.revoked[id] = expires
+}
+
+// revokeFamily revokes all the tokens in the family.
+func (s *tokenStore) revokeFamily(family string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.prune()
+	s.revokedFamilies[family] = familyExpiry()
+}
+
+// familyExpiry gives the time when all the tokens in a family revoked now will have expired. No more tokens are issued
+// in a revoked family, and the ones already issued don't last longer than a refresh token.
+func familyExpiry() time.Time {
+	return time.Now().Add(max(authCodeTTL, accessTokenTTL, refreshTokenTTL))
+}
+
+// isRevoked tells if the token with the ID, or its family, has been revoked. Tokens without a family, like those from
+// the client credentials grant, can only be revoked by themselves.
+func (s *tokenStore) isRevoked(id, family string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, revoked := s.revoked[id]; revoked {
+		return true
+	}
+
+	if family != "" {
+		if _, revoked := s.revokedFamilies[family]; revoked {
+			return true
+		}
+	}
+
+	return false
+}
+
+// isUsed tells if the single-use code or refresh token with the ID has been used.
+func (s *tokenStore) isUsed(id string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, used := s.used[id]
+	return used
+}
+
+// prune drops the entries that have expired, at most once every tokenPruneInterval. Live entries are never dropped.
+// Needs s.mu to be held.
+func (s *tokenStore) prune() {
+	now := time.Now()
+	if now.Before(s.nextPrune) {
+		return
+	}
+	s.nextPrune = now.Add(tokenPruneInterval)
+
+	for _, m := range []map[string]time.Time{s.used, s.revoked, s.revokedFamilies} {
+		for key, expires := range m {
+			if !now.Before(expires) {
+				delete(m, key)
+			}
+		}
+	}
+}
+
+// encodePayload makes a token of the kind, with the payload as base64 JSON, followed by an HMAC-SHA256 signature.
+func encodePayload(kind string, payload any) (string, error) {
+	jsonBytes, err := json.Marshal(payload)
+	if err != nil {
+		return "", err
+	}
+
+	encoded := base64.RawURLEncoding.EncodeToString(jsonBytes)
+	return encoded + "." + base64.RawURLEncoding.EncodeToString(signPayload(kind, encoded)), nil
+}
+
+// decodePayload checks the signature on the token of the kind, and decodes the payload from it.
+func decodePayload(kind, token string, payload any) error {
+	encoded, signature, ok := strings.Cut(token, ".")
+	if !ok {
+		return errInvalidSignature
+	}
+
+	signatureBytes, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil || !hmac.Equal(signatureBytes, signPayload(kind, encoded)) {
+		return errInvalidSignature
+	}
+
+	jsonBytes, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(jsonBytes, payload)
+}
+
+func signPayload(kind, encoded string) []byte {
+	mac := hmac.New(sha256.New, signingKey)
+	mac.Write([]byte(kind + "." + encoded))
+	return mac.Sum(nil)
+}
@@ -60,14 +60,14 @@ func handleRedirectCount(ex *ex.Exchange) response.Response {
 	} else if n > 1 {
 		target := fmt.Sprint(n - 1)
 		if isAbsolute {
-			target = "/absolute-redirect/" + target
+			target = ex.AbsoluteUrl("/absolute-redirect/" + target)
 		}
 		return *ex.RedirectResponse(target)
 
 	} else {
 		var target string
 		if isAbsolute {
-			target = "/anything"
+			target = ex.AbsoluteUrl("/anything")
 		} else {
 			target = "../anything"
 		}
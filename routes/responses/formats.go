@@ -0,0 +1,322 @@
+package responses
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/vmihailenco/msgpack/v5"
+	"gopkg.in/yaml.v3"
+)
+
+// Limits how deep nested protobuf messages are decoded, to avoid going down pathological inputs.
+const maxProtobufDepth = 16
+
+type ProtobufField struct {
+	Number   uint64 `json:"field"`
+	WireType string `json:"wireType"`
+	Value    any    `json:"value"` // uint64, uint32, string, []byte or []ProtobufField
+}
+
+var protobufWireTypes = []string{"varint", "i64", "len", "sgroup", "egroup", "i32"}
+
+func isXMLContentType(contentType string) bool {
+	return contentType == "application/xml" || contentType == "text/xml" || strings.HasSuffix(contentType, "+xml")
+}
+
+func isYAMLContentType(contentType string) bool {
+	switch contentType {
+	case "application/yaml", "application/x-yaml", "text/yaml", "text/x-yaml":
+		return true
+	}
+	return false
+}
+
+func isMsgpackContentType(contentType string) bool {
+	switch contentType {
+	case "application/msgpack", "application/x-msgpack", "application/vnd.msgpack":
+		return true
+	}
+	return false
+}
+
+func isProtobufContentType(contentType string) bool {
+	switch contentType {
+	case "application/x-protobuf", "application/protobuf", "application/vnd.google.protobuf":
+		return true
+	}
+	return false
+}
+
+func decodeYAML(body []byte) (any, error) {
+	var result any
+	if err := yaml.Unmarshal(body, &result); err != nil {
+		return nil, err
+	}
+	return jsonSafe(result), nil
+}
+
+func decodeCBOR(body []byte) (any, error) {
+	var result any
+	if err := cbor.Unmarshal(body, &result); err != nil {
+		return nil, err
+	}
+	return jsonSafe(result), nil
+}
+
+func decodeMsgpack(body []byte) (any, error) {
+	var result any
+	if err := msgpack.Unmarshal(body, &result); err != nil {
+		return nil, err
+	}
+	return jsonSafe(result), nil
+}
+
+// jsonSafe converts values produced by the YAML, CBOR and MessagePack decoders into something that can be serialized
+// to JSON. Maps with non-string keys, and special floats like NaN, can't be, as is.
+func jsonSafe(value any) any {
+	switch v := value.(type) {
+	case map[string]any:
+		for key, item := range v {
+			v[key] = jsonSafe(item)
+		}
+		return v
+	case map[any]any:
+		result := make(map[string]any, len(v))
+		for key, item := range v {
+			result[fmt.Sprint(key)] = jsonSafe(item)
+		}
+		return result
+	case []any:
+		for i, item := range v {
+			v[i] = jsonSafe(item)
+		}
+		return v
+	case float64:
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return fmt.Sprint(v)
+		}
+	case float32:
+		if math.IsNaN(float64(v)) || math.IsInf(float64(v), 0) {
+			return fmt.Sprint(v)
+		}
+	case cbor.Tag:
+		return map[string]any{
+			"tag":     v.Number,
+			"content": jsonSafe(v.Content),
+		}
+	}
+	return value
+}
+
+// decodeXML converts an XML document into a JSON-like structure. Elements become objects, keyed by child element
+// names, with attributes prefixed with `@` and text content under `#text`. Elements with only text become strings, and
+// repeated elements become lists.
+func decodeXML(body []byte) (any, error) {
+	type frame struct {
+		name     string
+		children map[string]any
+		text     strings.Builder
+	}
+
+	decoder := xml.NewDecoder(bytes.NewReader(body))
+	var stack []*frame
+	var root map[string]any
+
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			f := &frame{name: t.Name.Local, children: map[string]any{}}
+			for _, attr := range t.Attr {
+				f.children["@"+attr.Name.Local] = attr.Value
+			}
+			stack = append(stack, f)
+
+		case xml.CharData:
+			if len(stack) > 0 {
+				stack[len(stack)-1].text.Write(t)
+			}
+
+		case xml.EndElement:
+			f := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+
+			var value any
+			text := strings.TrimSpace(f.text.String())
+			if len(f.children) == 0 {
+				value = text
+			} else {
+				if text != "" {
+					f.children["#text"] = text
+				}
+				value = f.children
+			}
+
+			if len(stack) == 0 {
+				root = map[string]any{f.name: value}
+				continue
+			}
+
+			parent := stack[len(stack)-1].children
+			if existing, ok := parent[f.name]; !ok {
+				parent[f.name] = value
+			} else if list, isList := existing.([]any); isList {
+				parent[f.name] = append(list, value)
+			} else {
+				parent[f.name] = []any{existing, value}
+			}
+
+		}
+	}
+
+	if root == nil {
+		return nil, errors.New("no root element in XML")
+	}
+
+	return root, nil
+}
+
+// decodeProtobuf decodes a protobuf message without a schema, into its field numbers, wire types and values.
+// Length-delimited values are shown as strings if they look like text, as nested messages if they parse as such, or
+// as raw bytes otherwise.
+func decodeProtobuf(body []byte) ([]ProtobufField, error) {
+	fields, _, err := decodeProtobufFields(body, 0, 0)
+	return fields, err
+}
+
+// decodeProtobufFields decodes fields until the input ends, or until an end group for the given group number. The
+// input left after the end group is returned.
+func decodeProtobufFields(body []byte, group uint64, depth int) ([]ProtobufField, []byte, error) {
+	fields := []ProtobufField{}
+
+	for len(body) > 0 {
+		key, n := decodeVarint(body)
+		if n == 0 {
+			return nil, nil, errors.New("invalid field key in protobuf message")
+		}
+		body = body[n:]
+
+		number, wireType := key>>3, key&7
+		if number == 0 || wireType >= uint64(len(protobufWireTypes)) {
+			return nil, nil, fmt.Errorf("invalid field %d with wire type %d in protobuf message", number, wireType)
+		}
+
+		field := ProtobufField{Number: number, WireType: protobufWireTypes[wireType]}
+
+		switch wireType {
+		case 0:
+			if field.Value, n = decodeVarint(body); n == 0 {
+				return nil, nil, errors.New("invalid varint in protobuf message")
+			}
+			body = body[n:]
+
+		case 1:
+			if len(body) < 8 {
+				return nil, nil, errors.New("truncated i64 in protobuf message")
+			}
+			var v uint64
+			for i := 7; i >= 0; i-- {
+				v = v<<8 | uint64(body[i])
+			}
+			field.Value = v
+			body = body[8:]
+
+		case 2:
+			length, n := decodeVarint(body)
+			if n == 0 || uint64(len(body)-n) < length {
+				return nil, nil, errors.New("truncated length-delimited value in protobuf message")
+			}
+			value := body[n : n+int(length)]
+			body = body[n+int(length):]
+
+			if isPrintableText(value) {
+				field.Value = string(value)
+			} else if nested, err := decodeNestedProtobuf(value, depth); err == nil {
+				field.Value = nested
+			} else {
+				field.Value = value
+			}
+
+		case 3:
+			if depth >= maxProtobufDepth {
+				return nil, nil, errors.New("protobuf message nested too deep")
+			}
+			var err error
+			if field.Value, body, err = decodeProtobufFields(body, number, depth+1); err != nil {
+				return nil, nil, err
+			}
+
+		case 4:
+			if number != group {
+				return nil, nil, fmt.Errorf("unexpected end group %d in protobuf message", number)
+			}
+			return fields, body, nil
+
+		case 5:
+			if len(body) < 4 {
+				return nil, nil, errors.New("truncated i32 in protobuf message")
+			}
+			field.Value = uint32(body[0]) | uint32(body[1])<<8 | uint32(body[2])<<16 | uint32(body[3])<<24
+			body = body[4:]
+
+		}
+
+		fields = append(fields, field)
+	}
+
+	if group != 0 {
+		return nil, nil, fmt.Errorf("missing end group %d in protobuf message", group)
+	}
+
+	return fields, nil, nil
+}
+
+func decodeNestedProtobuf(value []byte, depth int) ([]ProtobufField, error) {
+	if len(value) == 0 || depth >= maxProtobufDepth {
+		return nil, errors.New("not a nested message")
+	}
+	fields, rest, err := decodeProtobufFields(value, 0, depth+1)
+	if err != nil || len(rest) > 0 {
+		return nil, errors.New("not a nested message")
+	}
+	return fields, nil
+}
+
+// decodeVarint reads a base 128 varint, returning the value and number of bytes read. Zero bytes read means it's
+// invalid.
+func decodeVarint(buf []byte) (uint64, int) {
+	var value uint64
+	for i := 0; i < len(buf) && i < 10; i++ {
+		value |= uint64(buf[i]&0x7f) << (7 * i)
+		if buf[i] < 0x80 {
+			return value, i + 1
+		}
+	}
+	return 0, 0
+}
+
+func isPrintableText(value []byte) bool {
+	if !utf8.Valid(value) {
+		return false
+	}
+	for _, r := range string(value) {
+		if !unicode.IsPrint(r) && !unicode.IsSpace(r) {
+			return false
+		}
+	}
+	return true
+}
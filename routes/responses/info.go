@@ -1,11 +1,11 @@
 package responses
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"io"
 	"mime"
-	"mime/multipart"
 	"net/url"
 	"strings"
 	"unicode/utf8"
@@ -15,15 +15,38 @@ import (
 )
 
 type Info struct {
-	Method  string         `json:"method"`
-	Args    map[string]any `json:"args"`
-	Headers map[string]any `json:"headers"`
-	Origin  string         `json:"origin"`
-	Url     string         `json:"url"`
-	Form    map[string]any `json:"form"`
-	Data    any            `json:"data"` // string or []byte
-	Json    *any           `json:"json"`
-	Files   map[string]any `json:"files"`
+	Method   string         `json:"method"`
+	Protocol string         `json:"protocol"`
+	Args     map[string]any `json:"args"`
+	Headers  map[string]any `json:"headers"`
+	Origin   string         `json:"origin"`
+	Url      string         `json:"url"`
+	Form     map[string]any `json:"form"`
+	Data     any            `json:"data"` // string or []byte
+	Json     *any           `json:"json"`
+	Files    map[string]any `json:"files"`
+
+	// Decoded bodies of other structured formats. Each is present only if the body is of that type, and parses.
+	Xml      *any            `json:"xml,omitempty"`
+	Yaml     *any            `json:"yaml,omitempty"`
+	Cbor     *any            `json:"cbor,omitempty"`
+	Msgpack  *any            `json:"msgpack,omitempty"`
+	Protobuf []ProtobufField `json:"protobuf,omitempty"`
+
+	// All parts of a multipart body, in order.
+	Parts []Part `json:"parts,omitempty"`
+
+	// Details of the TLS connection, only present if the request came over TLS.
+	TLS *TLSInfo `json:"tls,omitempty"`
+
+	// Details of the content codings on the request body, only present if the body was encoded.
+	ContentEncoding *ContentEncodingInfo `json:"contentEncoding,omitempty"`
+}
+
+type ContentEncodingInfo struct {
+	Encodings    []string `json:"encodings"`
+	OriginalSize int      `json:"originalSize"`
+	DecodedSize  int      `json:"decodedSize"`
 }
 
 func InfoJSON(ex *ex.Exchange) (*Info, error) {
@@ -37,11 +60,13 @@ func InfoJSON(ex *ex.Exchange) (*Info, error) {
 	}
 
 	result := Info{
-		Method:  ex.Request.Method,
-		Args:    args,
-		Headers: ex.ExposableHeadersMap(),
-		Origin:  ex.FindIncomingIPAddress(),
-		Url:     ex.FullUrl(),
+		Method:   ex.Request.Method,
+		Protocol: ex.Request.Proto,
+		TLS:      NewTLSInfo(ex.Request.TLS),
+		Args:     args,
+		Headers:  ex.ExposableHeadersMap(),
+		Origin:   ex.FindIncomingIPAddress(),
+		Url:      ex.FullUrl(),
 	}
 
 	contentTypeHeaderValue := ex.HeaderValueLast(c.ContentType)
@@ -53,15 +78,31 @@ func InfoJSON(ex *ex.Exchange) (*Info, error) {
 		return nil, fmt.Errorf("error parsing content type %q %v", ex.HeaderValueLast(c.ContentType), err)
 	}
 
+	// Multipart bodies are streamed from the request, unless they need decoding first. Everything else is read fully.
+	encodings := ex.BodyEncodings()
+	var body []byte
+	if !strings.HasPrefix(contentType, "multipart/") || len(encodings) > 0 {
+		if body, err = ex.DecodedBodyBytes(); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(encodings) > 0 {
+		result.ContentEncoding = &ContentEncodingInfo{
+			Encodings:    encodings,
+			OriginalSize: len(ex.BodyBytes()),
+			DecodedSize:  len(body),
+		}
+	}
+
 	form := make(map[string]any)
 	var jsonData *any
 	files := make(map[string]any)
 	var data any // string or []byte
 
 	if contentType == "application/x-www-form-urlencoded" {
-		body := ex.BodyString()
-		if parsed, err := url.ParseQuery(body); err != nil {
-			data = body
+		if parsed, err := url.ParseQuery(string(body)); err != nil {
+			data = string(body)
 		} else {
 			for name, values := range parsed {
 				if len(values) > 1 {
@@ -73,53 +114,43 @@ func InfoJSON(ex *ex.Exchange) (*Info, error) {
 		}
 
 	} else if contentType == c.ApplicationJSON {
-		body := ex.BodyString()
 		var result any
-		if json.Unmarshal([]byte(body), &result) == nil {
+		if json.Unmarshal(body, &result) == nil {
 			jsonData = &result
 		}
-		data = body
+		data = string(body)
 
-	} else if contentType == "multipart/form-data" {
-		// This might work for `multipart/mixed` as well. Confirm.
-		reader := multipart.NewReader(ex.Request.Body, params["boundary"])
-		allFileData, err := reader.ReadForm(32 << 20)
-		if err != nil {
-			return nil, fmt.Errorf("error reading multipart form data: %v", err)
+	} else if strings.HasPrefix(contentType, "multipart/") {
+		var bodyReader io.Reader = ex.Request.Body
+		if body != nil {
+			bodyReader = bytes.NewReader(body)
 		}
-
-		for name, fileHeaders := range allFileData.File {
-			fileHeader := fileHeaders[0]
-			var content any
-			if f, err := fileHeader.Open(); err != nil {
-				fmt.Println("Error opening fileHeader", err)
-			} else if content, err = io.ReadAll(f); err != nil {
-				fmt.Println("Error reading from fileHeader", err)
-			} else {
-				if utf8.Valid(content.([]byte)) {
-					content = string(content.([]byte))
-				}
-				headers := map[string]string{}
-				for name, values := range fileHeader.Header {
-					headers[name] = strings.Join(values, ",")
-				}
-				files[name] = map[string]any{
-					"filename": fileHeader.Filename,
-					"size":     fileHeader.Size,
-					"headers":  headers,
-					"content":  content,
-				}
-			}
+		multipartData, err := readMultipart(bodyReader, params["boundary"], contentType == "multipart/form-data")
+		if err != nil {
+			return nil, err
 		}
+		form = multipartData.form
+		files = multipartData.files
+		result.Parts = multipartData.parts
 
-		for name, valueInfo := range allFileData.Value {
-			form[name] = valueInfo[0]
+	} else {
+		data = body
+		if utf8.Valid(body) {
+			data = string(body)
 		}
 
-	} else {
-		data = ex.BodyBytes()
-		if utf8.Valid(data.([]byte)) {
-			data = string(data.([]byte))
+		if isXMLContentType(contentType) {
+			result.Xml = decodeInto(body, decodeXML)
+		} else if isYAMLContentType(contentType) {
+			result.Yaml = decodeInto(body, decodeYAML)
+		} else if contentType == "application/cbor" {
+			result.Cbor = decodeInto(body, decodeCBOR)
+		} else if isMsgpackContentType(contentType) {
+			result.Msgpack = decodeInto(body, decodeMsgpack)
+		} else if isProtobufContentType(contentType) {
+			if fields, err := decodeProtobuf(body); err == nil {
+				result.Protobuf = fields
+			}
 		}
 
 	}
@@ -135,3 +166,11 @@ func InfoJSON(ex *ex.Exchange) (*Info, error) {
 
 	return &result, nil
 }
+
+// decodeInto runs the given decoder on the body, and returns nil if it fails, like how invalid JSON bodies are handled.
+func decodeInto(body []byte, decoder func([]byte) (any, error)) *any {
+	if value, err := decoder(body); err == nil {
+		return &value
+	}
+	return nil
+}
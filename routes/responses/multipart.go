@@ -0,0 +1,138 @@
+package responses
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	// Maximum total size of all parts in a multipart body.
+	maxMultipartSize = 32 << 20
+
+	// Part contents in the `parts` list are truncated to this many bytes. Files in `files` are not.
+	maxPartContentSize = 1024
+)
+
+type Part struct {
+	Name        string            `json:"name,omitempty"`
+	Filename    string            `json:"filename,omitempty"`
+	ContentType string            `json:"contentType"`
+	Headers     map[string]string `json:"headers"`
+	Size        int               `json:"size"`
+	Sha256      string            `json:"sha256"`
+	Content     any               `json:"content"` // string or []byte
+	Truncated   bool              `json:"truncated"`
+}
+
+type multipartInfo struct {
+	form  map[string]any
+	files map[string]any
+	parts []Part
+}
+
+// readMultipart reads all parts of a multipart body, in order. For `multipart/form-data`, the parts are also collected
+// into form values and files, by their names. Repeated names show up as lists.
+func readMultipart(body io.Reader, boundary string, isFormData bool) (*multipartInfo, error) {
+	if boundary == "" {
+		return nil, errors.New("error reading multipart data: missing boundary")
+	}
+
+	info := &multipartInfo{
+		form:  map[string]any{},
+		files: map[string]any{},
+		parts: []Part{},
+	}
+
+	reader := multipart.NewReader(body, boundary)
+	remaining := int64(maxMultipartSize)
+
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("error reading multipart data: %v", err)
+		}
+
+		content, err := io.ReadAll(io.LimitReader(part, remaining+1))
+		if err != nil {
+			return nil, fmt.Errorf("error reading multipart data: %v", err)
+		}
+		remaining -= int64(len(content))
+		if remaining < 0 {
+			return nil, fmt.Errorf("multipart data is larger than %d bytes", maxMultipartSize)
+		}
+
+		headers := map[string]string{}
+		for name, values := range part.Header {
+			headers[name] = strings.Join(values, ",")
+		}
+
+		info.parts = append(info.parts, Part{
+			Name:        part.FormName(),
+			Filename:    part.FileName(),
+			ContentType: part.Header.Get("Content-Type"),
+			Headers:     headers,
+			Size:        len(content),
+			Sha256:      hex.EncodeToString(sha256Sum(content)),
+			Content:     textOrBytes(truncateContent(content, maxPartContentSize)),
+			Truncated:   len(content) > maxPartContentSize,
+		})
+
+		if !isFormData || part.FormName() == "" {
+			continue
+		}
+
+		if part.FileName() != "" {
+			appendValue(info.files, part.FormName(), map[string]any{
+				"filename": part.FileName(),
+				"size":     len(content),
+				"headers":  headers,
+				"content":  textOrBytes(content),
+			})
+		} else {
+			appendValue(info.form, part.FormName(), string(content))
+		}
+	}
+
+	return info, nil
+}
+
+// appendValue sets the value for the name, turning it into a list if the name repeats.
+func appendValue(m map[string]any, name string, value any) {
+	if existing, ok := m[name]; !ok {
+		m[name] = value
+	} else if list, isList := existing.([]any); isList {
+		m[name] = append(list, value)
+	} else {
+		m[name] = []any{existing, value}
+	}
+}
+
+// truncateContent cuts the content to at most size bytes. If the content is text, the cut doesn't split a character,
+// so the truncated content is still text.
+func truncateContent(content []byte, size int) []byte {
+	if len(content) <= size {
+		return content
+	}
+
+	if utf8.Valid(content) {
+		for size > 0 && !utf8.RuneStart(content[size]) {
+			size--
+		}
+	}
+
+	return content[:size]
+}
+
+func textOrBytes(content []byte) any {
+	if utf8.Valid(content) {
+		return string(content)
+	}
+	return content
+}
@@ -0,0 +1,85 @@
+package responses
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"time"
+)
+
+type TLSInfo struct {
+	Version            string            `json:"version"`
+	CipherSuite        string            `json:"cipherSuite"`
+	ServerName         string            `json:"serverName"`
+	ALPN               string            `json:"alpn"`
+	Resumed            bool              `json:"resumed"`
+	ClientCertificates []CertificateInfo `json:"clientCertificates"`
+}
+
+type CertificateInfo struct {
+	Subject           string    `json:"subject"`
+	Issuer            string    `json:"issuer"`
+	SerialNumber      string    `json:"serialNumber"`
+	NotBefore         time.Time `json:"notBefore"`
+	NotAfter          time.Time `json:"notAfter"`
+	DNSNames          []string  `json:"dnsNames"`
+	IPAddresses       []string  `json:"ipAddresses"`
+	EmailAddresses    []string  `json:"emailAddresses"`
+	URIs              []string  `json:"uris"`
+	IsCA              bool      `json:"isCA"`
+	FingerprintSHA256 string    `json:"fingerprintSha256"`
+}
+
+// NewTLSInfo summarizes the TLS connection a request came on. Returns nil if it didn't come over TLS.
+func NewTLSInfo(state *tls.ConnectionState) *TLSInfo {
+	if state == nil {
+		return nil
+	}
+
+	info := &TLSInfo{
+		Version:            tls.VersionName(state.Version),
+		CipherSuite:        tls.CipherSuiteName(state.CipherSuite),
+		ServerName:         state.ServerName,
+		ALPN:               state.NegotiatedProtocol,
+		Resumed:            state.DidResume,
+		ClientCertificates: []CertificateInfo{},
+	}
+
+	for _, cert := range state.PeerCertificates {
+		info.ClientCertificates = append(info.ClientCertificates, NewCertificateInfo(cert))
+	}
+
+	return info
+}
+
+func NewCertificateInfo(cert *x509.Certificate) CertificateInfo {
+	info := CertificateInfo{
+		Subject:           cert.Subject.String(),
+		Issuer:            cert.Issuer.String(),
+		SerialNumber:      cert.SerialNumber.Text(16),
+		NotBefore:         cert.NotBefore.UTC(),
+		NotAfter:          cert.NotAfter.UTC(),
+		DNSNames:          append([]string{}, cert.DNSNames...),
+		IPAddresses:       []string{},
+		EmailAddresses:    append([]string{}, cert.EmailAddresses...),
+		URIs:              []string{},
+		IsCA:              cert.IsCA,
+		FingerprintSHA256: hex.EncodeToString(sha256Sum(cert.Raw)),
+	}
+
+	for _, ip := range cert.IPAddresses {
+		info.IPAddresses = append(info.IPAddresses, ip.String())
+	}
+
+	for _, uri := range cert.URIs {
+		info.URIs = append(info.URIs, uri.String())
+	}
+
+	return info
+}
+
+func sha256Sum(data []byte) []byte {
+	hash := sha256.Sum256(data)
+	return hash[:]
+}
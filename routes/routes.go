@@ -18,13 +18,19 @@ import (
 	"github.com/sharat87/httpbun/response"
 	"github.com/sharat87/httpbun/routes/auth"
 	"github.com/sharat87/httpbun/routes/cache"
+	"github.com/sharat87/httpbun/routes/chunked"
+	"github.com/sharat87/httpbun/routes/compression"
 	"github.com/sharat87/httpbun/routes/cookies"
 	"github.com/sharat87/httpbun/routes/headers"
+	"github.com/sharat87/httpbun/routes/http2"
+	"github.com/sharat87/httpbun/routes/informational"
+	"github.com/sharat87/httpbun/routes/jwt"
 	"github.com/sharat87/httpbun/routes/llm"
 	"github.com/sharat87/httpbun/routes/method"
 	"github.com/sharat87/httpbun/routes/mix"
 	"github.com/sharat87/httpbun/routes/oauth2"
 	"github.com/sharat87/httpbun/routes/redirect"
+	"github.com/sharat87/httpbun/routes/responses"
 	"github.com/sharat87/httpbun/routes/run"
 	"github.com/sharat87/httpbun/routes/sse"
 	"github.com/sharat87/httpbun/routes/static"
@@ -32,6 +38,9 @@ import (
 	"github.com/sharat87/httpbun/util"
 )
 
+// Modification time for content generated from a fixed seed, which never changes.
+var seededContentModTime = time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)
+
 func GetRoutes() []ex.Route {
 	return slices.Concat(
 		[]ex.Route{
@@ -53,11 +62,18 @@ func GetRoutes() []ex.Route {
 			ex.NewRoute("/payload", handlePayload),
 			ex.NewRoute("/status/(?P<codes>[\\w,]+)", handleStatus),
 			ex.NewRoute("/ip(\\.(?P<format>txt|json))?", handleIp),
+			ex.NewRoute("/tls", handleTLS),
+			ex.NewRoute(`/tls/ca\.pem`, handleTLSCA),
 		},
 		auth.RouteList,
 		cache.RouteList,
+		chunked.RouteList,
+		compression.RouteList,
 		cookies.RouteList,
 		headers.RouteList,
+		http2.RouteList,
+		informational.RouteList,
+		jwt.RouteList,
 		method.RouteList,
 		mix.RouteList,
 		oauth2.RouteList,
@@ -155,6 +171,31 @@ func handleIp(ex *ex.Exchange) response.Response {
 	}
 }
 
+func handleTLS(ex *ex.Exchange) response.Response {
+	return response.Response{
+		Body: map[string]any{
+			"protocol": ex.Request.Proto,
+			"tls":      responses.NewTLSInfo(ex.Request.TLS),
+		},
+	}
+}
+
+func handleTLSCA(ex *ex.Exchange) response.Response {
+	if ex.ServerSpec.TLSAutoCAPEM == nil {
+		return response.Response{
+			Status: http.StatusNotFound,
+			Body:   "No CA certificate, since the server isn't running with --tls-auto.\n",
+		}
+	}
+
+	return response.Response{
+		Header: http.Header{
+			c.ContentType: []string{"application/x-pem-file"},
+		},
+		Body: ex.ServerSpec.TLSAutoCAPEM,
+	}
+}
+
 func handleDecodeBase64(ex *ex.Exchange) response.Response {
 	encoded := ex.Field("encoded")
 	if encoded == "" {
@@ -181,17 +222,32 @@ func handleRandomBytes(ex *ex.Exchange) response.Response {
 		return response.BadRequest("Invalid size: %s", sizeField)
 	}
 
-	if n > ex.ServerSpec.EndpointBytesSizeLimit {
-		return response.BadRequest("Size can't be greater than %v", ex.ServerSpec.EndpointBytesSizeLimit)
+	if limit := ex.ServerSpec.BytesSizeLimit(); n > limit {
+		return response.BadRequest("Size can't be greater than %v", limit)
 	}
 
-	return response.Response{
-		Header: http.Header{
-			c.ContentType:   []string{"application/octet-stream"},
-			c.ContentLength: []string{fmt.Sprint(n)},
-		},
-		Body: util.RandomBytes(n),
+	header := http.Header{
+		c.ContentType: []string{"application/octet-stream"},
+	}
+
+	var b []byte
+	var validators cache.Validators
+	if seedField := ex.Request.URL.Query().Get("seed"); seedField != "" {
+		seed, err := strconv.ParseInt(seedField, 10, 64)
+		if err != nil {
+			return response.BadRequest("Invalid seed: %s", seedField)
+		}
+		b = make([]byte, n)
+		rand.New(rand.NewSource(seed)).Read(b)
+		// Same seed gives the same bytes, so they can be considered unmodified since forever.
+		validators.LastModified = seededContentModTime
+	} else {
+		b = util.RandomBytes(n)
 	}
+	validators.ETag = `"` + util.Md5sum(string(b)) + `"`
+	validators.SetHeaders(header)
+
+	return cache.Conditional(ex, validators, ex.RangeResponse(header, b))
 }
 
 func handleDelayedResponse(ex *ex.Exchange) response.Response {
@@ -303,8 +359,8 @@ func handleRange(ex *ex.Exchange) response.Response {
 	// TODO: Cache range response, don't have to generate over and over again.
 	count, _ := strconv.Atoi(ex.Field("count"))
 
-	if count > 1000 {
-		count = 1000
+	if limit := ex.ServerSpec.RangeSizeLimit(); count > limit {
+		count = limit
 	} else if count < 0 {
 		count = 0
 	}
@@ -315,12 +371,16 @@ func handleRange(ex *ex.Exchange) response.Response {
 		rand.New(rand.NewSource(42)).Read(b)
 	}
 
-	return response.Response{
-		Header: http.Header{
-			c.ContentType: []string{"application/octet-stream"},
-		},
-		Body: b,
+	header := http.Header{
+		c.ContentType: []string{"application/octet-stream"},
 	}
+	validators := cache.Validators{
+		ETag:         fmt.Sprintf(`"range-%d"`, count),
+		LastModified: seededContentModTime,
+	}
+	validators.SetHeaders(header)
+
+	return cache.Conditional(ex, validators, ex.RangeResponse(header, b))
 }
 
 func handleInfo(_ *ex.Exchange) response.Response {
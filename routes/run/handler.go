@@ -3,6 +3,7 @@ package run
 import (
 	"encoding/base64"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"time"
 
@@ -73,27 +74,15 @@ func handleRunJS(ex *ex.Exchange) response.Response {
 		status = 200
 	}
 
-	var headers http.Header
-	if headersRaw, haveHeaders := result["headers"]; haveHeaders {
-		switch headersTyped := headersRaw.(type) {
-		case map[string]any:
-			headers = http.Header{}
-			for k, v := range headersTyped {
-				if vString, isString := v.(string); isString {
-					headers.Add(k, vString)
-				} else if vList, isList := v.([]string); isList {
-					for _, vString := range vList {
-						headers.Add(k, vString)
-					}
-				} else {
-					return response.BadRequest("Invalid header value type for key: %s", k)
-				}
-			}
-		case nil:
-			headers = nil
-		default:
-			return response.BadRequest("Invalid headers value: %v", headersRaw)
-		}
+	headers, err := toHeader(result["headers"], "header", false)
+	if err != nil {
+		return response.BadRequest("%s", err.Error())
+	}
+
+	// A trailer with a `null` value is declared in the `Trailer` header, but not sent.
+	trailer, err := toHeader(result["trailers"], "trailer", true)
+	if err != nil {
+		return response.BadRequest("%s", err.Error())
 	}
 
 	var body []byte
@@ -109,5 +98,33 @@ func handleRunJS(ex *ex.Exchange) response.Response {
 		}
 	}
 
-	return response.New(status, headers, body)
+	resp := response.New(status, headers, body)
+	resp.Trailer = trailer
+	return resp
+}
+
+// toHeader turns a JS object into a header. The kind, like `header` or `trailer`, is used in error messages.
+func toHeader(raw any, kind string, allowNull bool) (http.Header, error) {
+	switch typed := raw.(type) {
+	case map[string]any:
+		header := http.Header{}
+		for k, v := range typed {
+			if vString, isString := v.(string); isString {
+				header.Add(k, vString)
+			} else if vList, isList := v.([]string); isList {
+				for _, vString := range vList {
+					header.Add(k, vString)
+				}
+			} else if v == nil && allowNull {
+				header[http.CanonicalHeaderKey(k)] = nil
+			} else {
+				return nil, fmt.Errorf("Invalid %s value type for key: %s", kind, k)
+			}
+		}
+		return header, nil
+	case nil:
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("Invalid %ss value: %v", kind, raw)
+	}
 }
@@ -0,0 +1,140 @@
+package autotls
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net"
+	"slices"
+	"time"
+)
+
+// Kinds of certificates that fail validation in different ways, to test clients against.
+const (
+	Expired     = "expired"
+	NotYetValid = "not-yet-valid"
+	WrongHost   = "wrong-host"
+	SelfSigned  = "self-signed"
+)
+
+var InvalidKinds = []string{Expired, NotYetValid, WrongHost, SelfSigned}
+
+// The host used in wrong-host certificates. The `.invalid` TLD is reserved, so this will never match a real host.
+const wrongHost = "wrong-host.httpbun.invalid"
+
+// Authority is an in-memory CA, generated at startup, that issues certificates for the server.
+type Authority struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	PEM  []byte
+}
+
+func NewAuthority() (*Authority, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber:          randomSerial(),
+		Subject:               pkix.Name{Organization: []string{"Httpbun"}, CommonName: "Httpbun Auto TLS CA"},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.AddDate(1, 0, 0),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		MaxPathLenZero:        true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, err
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Authority{
+		cert: cert,
+		key:  key,
+		PEM:  pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+	}, nil
+}
+
+// Issue creates a leaf certificate for the given hosts, which can be DNS names or IP addresses. The kind is empty for
+// a valid certificate, or one of InvalidKinds.
+func (a *Authority) Issue(hosts []string, kind string) (tls.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber: randomSerial(),
+		Subject:      pkix.Name{Organization: []string{"Httpbun"}},
+		NotBefore:    now.Add(-time.Hour),
+		NotAfter:     now.AddDate(0, 3, 0),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+
+	switch kind {
+	case "":
+	case Expired:
+		template.NotBefore = now.AddDate(0, 0, -60)
+		template.NotAfter = now.AddDate(0, 0, -30)
+	case NotYetValid:
+		template.NotBefore = now.AddDate(0, 0, 30)
+		template.NotAfter = now.AddDate(0, 0, 60)
+	case WrongHost:
+		hosts = []string{wrongHost}
+	case SelfSigned:
+	default:
+		return tls.Certificate{}, fmt.Errorf("unknown certificate kind %q, should be one of %v", kind, InvalidKinds)
+	}
+
+	for _, host := range hosts {
+		if ip := net.ParseIP(host); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, host)
+		}
+	}
+	if len(hosts) > 0 {
+		template.Subject.CommonName = hosts[0]
+	}
+
+	parent, parentKey := a.cert, a.key
+	if kind == SelfSigned {
+		parent, parentKey = template, key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, nil
+}
+
+func IsInvalidKind(kind string) bool {
+	return slices.Contains(InvalidKinds, kind)
+}
+
+func randomSerial() *big.Int {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		panic(err)
+	}
+	return serial
+}
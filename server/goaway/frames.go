@@ -0,0 +1,163 @@
+package goaway
+
+import (
+	"encoding/binary"
+	"net"
+	"sync"
+	"sync/atomic"
+
+	"golang.org/x/net/http2"
+)
+
+// Size of an HTTP/2 frame header, as per RFC 9113, section 4.1.
+const frameHeaderLen = 9
+
+// codeConn is a connection that rewrites the error codes of the `RST_STREAM` and `GOAWAY` frames written on it, as
+// asked for by handlers. Nothing else about the frames changes, so the HTTP/2 server's state, like flow control, stays
+// as it is. This is only done if the client started with the HTTP/2 preface, so that every byte written is in a frame.
+type codeConn struct {
+	net.Conn
+	taken atomic.Bool
+
+	// Bytes read, until the first write, which is when it's decided if they start with the HTTP/2 client preface.
+	readMu    sync.Mutex
+	preface   []byte
+	decided   bool
+	http2Conn atomic.Bool
+
+	mu sync.Mutex
+
+	// Frame being written, its header, and how much of its payload is left.
+	header      [frameHeaderLen]byte
+	headerLen   int
+	payloadSeen int
+	payloadLen  int
+
+	// Bytes of an error code seen so far, which are held back until the code is complete.
+	code []byte
+
+	resetCodes []http2.ErrCode
+	goAwayCode *http2.ErrCode
+}
+
+// take gives the connection the first time it's called, and nil after.
+func (c *codeConn) take() net.Conn {
+	if c.taken.Swap(true) {
+		return nil
+	}
+	return c
+}
+
+func (c *codeConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+
+	c.readMu.Lock()
+	if !c.decided && len(c.preface) < len(http2.ClientPreface) {
+		c.preface = append(c.preface, p[:min(n, len(http2.ClientPreface)-len(c.preface))]...)
+		c.http2Conn.Store(string(c.preface) == http2.ClientPreface)
+	}
+	c.readMu.Unlock()
+
+	return n, err
+}
+
+// isHTTP2 tells if the connection started with the HTTP/2 client preface, which is cleartext HTTP/2 with prior
+// knowledge.
+func (c *codeConn) isHTTP2() bool {
+	return c.http2Conn.Load()
+}
+
+func (c *codeConn) addResetCode(code http2.ErrCode) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.resetCodes = append(c.resetCodes, code)
+}
+
+func (c *codeConn) setGoAwayCode(code http2.ErrCode) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.goAwayCode = &code
+}
+
+func (c *codeConn) Write(p []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// The server only writes after reading the start of the request, so by now the preface has been read, if it was
+	// sent. Connections that aren't HTTP/2 from the start are written to as is.
+	c.readMu.Lock()
+	c.decided = true
+	c.readMu.Unlock()
+	if !c.isHTTP2() {
+		return c.Conn.Write(p)
+	}
+
+	out := make([]byte, 0, len(p)+len(c.code))
+	for i := 0; i < len(p); {
+		if c.headerLen < frameHeaderLen {
+			n := copy(c.header[c.headerLen:], p[i:])
+			out = append(out, p[i:i+n]...)
+			i += n
+			c.headerLen += n
+			if c.headerLen == frameHeaderLen {
+				c.payloadLen = int(c.header[0])<<16 | int(c.header[1])<<8 | int(c.header[2])
+				c.payloadSeen = 0
+				c.code = c.code[:0]
+			}
+		} else {
+			start, end := c.codeOffsets()
+			n := min(c.payloadLen-c.payloadSeen, len(p)-i)
+			for _, b := range p[i : i+n] {
+				if c.payloadSeen >= start && c.payloadSeen < end {
+					c.code = append(c.code, b)
+					if len(c.code) == end-start {
+						out = append(out, c.rewriteCode()...)
+					}
+				} else {
+					out = append(out, b)
+				}
+				c.payloadSeen++
+			}
+			i += n
+		}
+
+		if c.headerLen == frameHeaderLen && c.payloadSeen == c.payloadLen {
+			c.headerLen = 0
+		}
+	}
+
+	if _, err := c.Conn.Write(out); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// codeOffsets gives where the error code is in the payload of the current frame, as per RFC 9113, sections 6.4 and
+// 6.8. For other frames, that's an empty range.
+func (c *codeConn) codeOffsets() (int, int) {
+	switch http2.FrameType(c.header[3]) {
+	case http2.FrameRSTStream:
+		return 0, 4
+	case http2.FrameGoAway:
+		return 4, 8
+	}
+	return 0, 0
+}
+
+// rewriteCode gives the error code of the current frame, replaced with the one asked for, if any.
+func (c *codeConn) rewriteCode() []byte {
+	code := http2.ErrCode(binary.BigEndian.Uint32(c.code))
+
+	switch http2.FrameType(c.header[3]) {
+	case http2.FrameRSTStream:
+		if code == http2.ErrCodeInternal && len(c.resetCodes) > 0 {
+			code, c.resetCodes = c.resetCodes[0], c.resetCodes[1:]
+		}
+	case http2.FrameGoAway:
+		if code == http2.ErrCodeNo && c.goAwayCode != nil {
+			code = *c.goAwayCode
+		}
+	}
+
+	return binary.BigEndian.AppendUint32(nil, uint32(code))
+}
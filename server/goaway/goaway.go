@@ -0,0 +1,216 @@
+// Package goaway serves a listener where handlers can have `GOAWAY` sent on their connection, and pick the error codes
+// of the `GOAWAY` and `RST_STREAM` frames sent on it. Each connection gets its own `http.Server`, so `GOAWAY` is sent by
+// gracefully shutting down that server, with `Shutdown`. The error codes are set by rewriting the code in the frames the
+// HTTP/2 server sends, which is only done for cleartext HTTP/2 with prior knowledge.
+package goaway
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/net/http2"
+)
+
+// Time to wait for a connection to finish its streams, after sending it GOAWAY.
+const shutdownTimeout = 10 * time.Second
+
+type contextKey struct{}
+
+// Server serves a handler on a listener, with a new `http.Server` for each connection.
+type Server struct {
+	listener  net.Listener
+	newServer func() *http.Server
+
+	mu      sync.Mutex
+	servers map[*connServer]struct{}
+	closed  bool
+}
+
+// connServer is the `http.Server` serving a single connection.
+type connServer struct {
+	server *http.Server
+	conn   *codeConn
+	done   chan struct{}
+	once   sync.Once
+
+	// Responses left before shutting down, if armed, and zero if not.
+	remaining atomic.Int64
+}
+
+// NewServer makes a server that serves on the listener, with servers made by newServer. Their handler, base context
+// and connection hooks are wrapped.
+func NewServer(listener net.Listener, newServer func() *http.Server) *Server {
+	return &Server{
+		listener:  listener,
+		newServer: newServer,
+		servers:   map[*connServer]struct{}{},
+	}
+}
+
+// After has GOAWAY sent on the connection the request came on, with the error code, after this and n more responses on
+// it. It returns false if the request didn't come over HTTP/2 with prior knowledge on a goaway listener.
+func After(ctx context.Context, n int, code http2.ErrCode) bool {
+	cs, ok := ctx.Value(contextKey{}).(*connServer)
+	if !ok || !cs.conn.isHTTP2() {
+		return false
+	}
+	cs.conn.setGoAwayCode(code)
+	cs.remaining.Store(int64(n) + 1)
+	return true
+}
+
+// Reset has the next `RST_STREAM` with `INTERNAL_ERROR` on the connection the request came on, which is the one sent
+// when a handler aborts, carry the given error code instead. It returns false if the request didn't come over HTTP/2
+// with prior knowledge on a goaway listener.
+func Reset(ctx context.Context, code http2.ErrCode) bool {
+	cs, ok := ctx.Value(contextKey{}).(*connServer)
+	if !ok || !cs.conn.isHTTP2() {
+		return false
+	}
+	cs.conn.addResetCode(code)
+	return true
+}
+
+// Serve accepts connections and serves each with a new server, until Close is called.
+func (s *Server) Serve() error {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			s.mu.Lock()
+			closed := s.closed
+			s.mu.Unlock()
+			if closed {
+				return http.ErrServerClosed
+			}
+			return err
+		}
+
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			_ = conn.Close()
+			return http.ErrServerClosed
+		}
+		cs := s.start(&codeConn{Conn: conn})
+		s.servers[cs] = struct{}{}
+		s.mu.Unlock()
+	}
+}
+
+// start makes a new server for the connection, and serves it. Needs s.mu to be held.
+func (s *Server) start(conn *codeConn) *connServer {
+	cs := &connServer{
+		server: s.newServer(),
+		conn:   conn,
+		done:   make(chan struct{}),
+	}
+
+	handler := cs.server.Handler
+	cs.server.Handler = http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		handler.ServeHTTP(w, req)
+		if cs.remaining.Load() > 0 && cs.remaining.Add(-1) == 0 {
+			go shutdown(cs.server)
+		}
+	})
+
+	cs.server.BaseContext = func(net.Listener) context.Context {
+		return context.WithValue(context.Background(), contextKey{}, cs)
+	}
+
+	// The hooks get the connection that was accepted, without the wrapper.
+	if connContext := cs.server.ConnContext; connContext != nil {
+		cs.server.ConnContext = func(ctx context.Context, c net.Conn) context.Context {
+			return connContext(ctx, unwrap(c))
+		}
+	}
+	connState := cs.server.ConnState
+	cs.server.ConnState = func(c net.Conn, state http.ConnState) {
+		if connState != nil {
+			connState(unwrap(c), state)
+		}
+		// The server has nothing more to serve once its connection is gone, or taken over, as for an h2c upgrade.
+		if state == http.StateClosed || state == http.StateHijacked {
+			cs.close()
+		}
+	}
+
+	go func() {
+		if err := cs.server.Serve(singleConnListener{cs, s.listener.Addr()}); !errors.Is(err, http.ErrServerClosed) {
+			log.Printf("Error serving goaway listener: %v", err)
+		}
+		s.mu.Lock()
+		delete(s.servers, cs)
+		s.mu.Unlock()
+	}()
+
+	return cs
+}
+
+func (cs *connServer) close() {
+	cs.once.Do(func() {
+		close(cs.done)
+	})
+}
+
+// Close stops accepting connections, and shuts down the servers of the connections.
+func (s *Server) Close() {
+	s.mu.Lock()
+	s.closed = true
+	var servers []*http.Server
+	for cs := range s.servers {
+		servers = append(servers, cs.server)
+	}
+	s.mu.Unlock()
+
+	if err := s.listener.Close(); err != nil {
+		log.Printf("Error closing goaway listener: %v", err)
+	}
+	for _, server := range servers {
+		shutdown(server)
+	}
+}
+
+func shutdown(server *http.Server) {
+	ctx, cancelFunc := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancelFunc()
+	if err := server.Shutdown(ctx); err != nil {
+		_ = server.Close()
+	}
+}
+
+func unwrap(conn net.Conn) net.Conn {
+	if c, ok := conn.(*codeConn); ok {
+		return c.Conn
+	}
+	return conn
+}
+
+// singleConnListener gives the one connection of a server, and then blocks until it's closed, which `Shutdown` does,
+// or the connection is gone.
+type singleConnListener struct {
+	cs   *connServer
+	addr net.Addr
+}
+
+func (l singleConnListener) Accept() (net.Conn, error) {
+	if conn := l.cs.conn.take(); conn != nil {
+		return conn, nil
+	}
+	<-l.cs.done
+	return nil, net.ErrClosed
+}
+
+func (l singleConnListener) Close() error {
+	l.cs.close()
+	return nil
+}
+
+func (l singleConnListener) Addr() net.Addr {
+	return l.addr
+}
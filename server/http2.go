@@ -0,0 +1,95 @@
+package server
+
+import (
+	"encoding/base64"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+
+	"golang.org/x/net/http2"
+)
+
+// configureHTTP2 serves HTTP/2 over TLS, and cleartext HTTP/2 (h2c) with prior knowledge, through the HTTP/2 server in
+// `net/http`. Cleartext HTTP/2 with an HTTP/1.1 upgrade isn't supported there, and is handled in ServeHTTP.
+func (s *Server) configureHTTP2() {
+	s.Protocols = new(http.Protocols)
+	s.Protocols.SetHTTP1(true)
+	s.Protocols.SetHTTP2(true)
+	s.Protocols.SetUnencryptedHTTP2(true)
+
+	s.h2Server = &http2.Server{}
+}
+
+// isH2CUpgrade checks if the request asks to upgrade to cleartext HTTP/2. Requests with a body aren't upgraded, since
+// the body would have to be read fully before switching, and the server is free to ignore an upgrade.
+func isH2CUpgrade(req *http.Request) bool {
+	return req.TLS == nil &&
+		req.ProtoMajor == 1 &&
+		headerHasToken(req.Header, "Connection", "upgrade") &&
+		headerHasToken(req.Header, "Upgrade", "h2c") &&
+		len(req.Header.Values("HTTP2-Settings")) == 1 &&
+		req.ContentLength == 0 &&
+		len(req.TransferEncoding) == 0
+}
+
+func headerHasToken(header http.Header, name, token string) bool {
+	for _, value := range header.Values(name) {
+		for _, part := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(part), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// serveH2CUpgrade switches the connection to HTTP/2, and serves the request on it as stream 1.
+func (s Server) serveH2CUpgrade(w http.ResponseWriter, req *http.Request) bool {
+	settings, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(req.Header.Get("HTTP2-Settings"), "="))
+	if err != nil {
+		return false
+	}
+
+	conn, rw, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		log.Printf("Error hijacking connection for h2c upgrade: %v", err)
+		return false
+	}
+
+	if _, err := rw.WriteString("HTTP/1.1 101 Switching Protocols\r\nConnection: Upgrade\r\nUpgrade: h2c\r\n\r\n"); err != nil {
+		_ = conn.Close()
+		return true
+	}
+	if err := rw.Flush(); err != nil {
+		_ = conn.Close()
+		return true
+	}
+
+	// The request continues as the first stream of the HTTP/2 connection, where the upgrade headers don't mean anything.
+	for _, name := range []string{"Connection", "Upgrade", "HTTP2-Settings"} {
+		req.Header.Del(name)
+	}
+	req.Proto, req.ProtoMajor, req.ProtoMinor = "HTTP/2.0", 2, 0
+
+	s.h2Server.ServeConn(bufferedConn{conn, rw.Reader}, &http2.ServeConnOpts{
+		Context:        req.Context(),
+		BaseConfig:     s.Server,
+		Handler:        s,
+		UpgradeRequest: req,
+		Settings:       settings,
+	})
+	return true
+}
+
+// bufferedConn reads through the buffered reader of a hijacked connection, which may already hold bytes that the
+// client sent right after the upgrade request.
+type bufferedConn struct {
+	net.Conn
+	r io.Reader
+}
+
+func (c bufferedConn) Read(p []byte) (int, error) {
+	return c.r.Read(p)
+}
@@ -1,7 +1,11 @@
 package server
 
 import (
+	"cmp"
 	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
 	"log"
 	"net"
 	"net/http"
@@ -9,69 +13,260 @@ import (
 	"strings"
 	"time"
 
+	"github.com/quic-go/quic-go/http3"
+	"golang.org/x/net/http2"
+
 	"github.com/sharat87/httpbun/ex"
 	"github.com/sharat87/httpbun/response"
 	"github.com/sharat87/httpbun/routes"
 	"github.com/sharat87/httpbun/routes/responses"
+	"github.com/sharat87/httpbun/server/autotls"
+	"github.com/sharat87/httpbun/server/goaway"
 	"github.com/sharat87/httpbun/server/spec"
+	"github.com/sharat87/httpbun/server/wire"
 )
 
 type Server struct {
 	*http.Server
-	spec    spec.Spec
-	routes  []ex.Route
-	closeCh chan error
+	h2Server *http2.Server
+	goAway   *goaway.Server
+	h3Server *http3.Server
+	h3Conn   net.PacketConn
+	spec     spec.Spec
+	routes   []ex.Route
+	closeCh  chan error
 }
 
 func StartNew(spec spec.Spec) Server {
 	tlsCertFile := os.Getenv("HTTPBUN_TLS_CERT")
 	tlsKeyFile := os.Getenv("HTTPBUN_TLS_KEY")
 
-	bindTarget := spec.BindTarget
-	if bindTarget == "" {
-		if tlsCertFile != "" {
-			bindTarget = ":443"
-		} else {
-			bindTarget = ":80"
+	if spec.TLSAuto {
+		// The generated certificate is used instead.
+		tlsCertFile, tlsKeyFile = "", ""
+	}
+
+	tlsEnabled := tlsCertFile != "" || spec.TLSAuto
+
+	// Without a separate TLS bind target, the bind target serves TLS if there's a certificate, and plain HTTP if not.
+	// With it, the bind target is always plain HTTP, and both are served.
+	var plainBindTarget, tlsBindTarget string
+	if !tlsEnabled {
+		if spec.TLSBindTarget != "" {
+			log.Fatalf("TLS bind target %q needs a certificate, with HTTPBUN_TLS_CERT and HTTPBUN_TLS_KEY, or with --tls-auto", spec.TLSBindTarget)
 		}
+		plainBindTarget = cmp.Or(spec.BindTarget, ":80")
+	} else if spec.TLSBindTarget == "" {
+		tlsBindTarget = cmp.Or(spec.BindTarget, ":443")
+	} else {
+		plainBindTarget = cmp.Or(spec.BindTarget, ":80")
+		tlsBindTarget = spec.TLSBindTarget
 	}
 
 	server := &Server{
 		Server: &http.Server{
-			Addr: bindTarget,
+			Addr:        cmp.Or(plainBindTarget, tlsBindTarget),
+			ConnContext: wire.ConnContext,
+			ConnState:   wire.ConnState,
 		},
-		spec:    spec,
-		closeCh: make(chan error, 1),
+		spec: spec,
 	}
 	server.Handler = server
 
+	if tlsEnabled {
+		server.TLSConfig = makeTLSConfig(&server.spec, tlsCertFile, tlsKeyFile)
+	}
+
+	server.configureHTTP2()
+
+	var invalidCerts map[string]tls.Certificate
+	if spec.TLSAuto {
+		invalidCerts = setupAutoTLS(&server.spec, server.TLSConfig)
+	}
+
 	if !spec.RootIsAny {
 		// When root is any, we don't need the route handlers at all.
 		server.routes = routes.GetRoutes()
 	}
 
-	listener, err := net.Listen("tcp", bindTarget)
-	if err != nil {
-		log.Fatalf("Error listening on %q: %v", spec.BindTarget, err)
+	// Plain listeners record the bytes read, for `/raw`. TLS listeners can't, since they'd be recording encrypted bytes.
+	var listeners []net.Listener
+	if plainBindTarget != "" {
+		listeners = append(listeners, wire.NewListener(listen("tcp", plainBindTarget, "HTTP")))
+	}
+	if spec.UnixSocket != "" {
+		// A socket file left behind by a previous run that didn't shut down cleanly would fail the listen.
+		if err := os.Remove(spec.UnixSocket); err != nil && !errors.Is(err, os.ErrNotExist) {
+			log.Fatalf("Error removing existing Unix socket %q: %v", spec.UnixSocket, err)
+		}
+		listeners = append(listeners, wire.NewListener(listen("unix", spec.UnixSocket, "HTTP")))
+	}
+	if tlsBindTarget != "" {
+		listeners = append(listeners, tls.NewListener(listen("tcp", tlsBindTarget, "HTTPS"), server.TLSConfig))
+	}
+	for kind, cert := range invalidCerts {
+		config := server.TLSConfig.Clone()
+		config.Certificates = []tls.Certificate{cert}
+		listeners = append(listeners, tls.NewListener(listen("tcp", spec.TLSAutoInvalid[kind], "HTTPS with "+kind+" certificate"), config))
 	}
 
-	go func() {
-		defer close(server.closeCh)
-		if tlsCertFile == "" {
-			server.closeCh <- server.Serve(listener)
-		} else {
-			server.closeCh <- server.ServeTLS(listener, tlsCertFile, tlsKeyFile)
+	if spec.GoAwayBindTarget != "" {
+		// Separate servers, one for each connection, so that shutting one down to send GOAWAY doesn't affect any other
+		// connection.
+		server.goAway = goaway.NewServer(wire.NewListener(listen("tcp", spec.GoAwayBindTarget, "HTTP with GOAWAY")), func() *http.Server {
+			return &http.Server{
+				Handler:     server,
+				ConnContext: wire.ConnContext,
+				ConnState:   wire.ConnState,
+				Protocols:   server.Protocols,
+			}
+		})
+	}
+
+	if spec.HTTP3 {
+		if tlsBindTarget == "" {
+			log.Fatal("HTTP/3 needs TLS, with HTTPBUN_TLS_CERT and HTTPBUN_TLS_KEY, or with --tls-auto")
 		}
-	}()
+		server.serveHTTP3(tlsBindTarget)
+	}
+
+	server.closeCh = make(chan error, len(listeners)+2)
+	for _, listener := range listeners {
+		go func() {
+			server.closeCh <- server.Serve(listener)
+		}()
+	}
+	if server.goAway != nil {
+		go func() {
+			server.closeCh <- server.goAway.Serve()
+		}()
+	}
+	if server.h3Server != nil {
+		go func() {
+			server.closeCh <- server.h3Server.Serve(server.h3Conn)
+		}()
+	}
 
 	return *server
 }
 
+// serveHTTP3 sets up HTTP/3, over QUIC, on the UDP port of the given address. It uses the same TLS configuration as
+// the TCP listener, including client certificate authentication.
+func (s *Server) serveHTTP3(bindTarget string) {
+	var err error
+	if s.h3Conn, err = net.ListenPacket("udp", bindTarget); err != nil {
+		log.Fatalf("Error listening on udp %q: %v", bindTarget, err)
+	}
+	log.Printf("Serving HTTP/3 on udp %v", s.h3Conn.LocalAddr())
+
+	s.h3Server = &http3.Server{
+		Handler:   s,
+		TLSConfig: s.TLSConfig.Clone(),
+	}
+}
+
+func listen(network, address, description string) net.Listener {
+	listener, err := net.Listen(network, address)
+	if err != nil {
+		log.Fatalf("Error listening on %s %q: %v", network, address, err)
+	}
+	log.Printf("Serving %s on %s %v", description, network, listener.Addr())
+	return listener
+}
+
+var clientAuthTypes = map[string]tls.ClientAuthType{
+	"":               tls.NoClientCert,
+	"none":           tls.NoClientCert,
+	"request":        tls.RequestClientCert,
+	"require":        tls.RequireAnyClientCert,
+	"verify":         tls.VerifyClientCertIfGiven,
+	"require-verify": tls.RequireAndVerifyClientCert,
+}
+
+// makeTLSConfig loads the certificate, if given, and sets up client certificate authentication. The client CA pool is
+// loaded into the spec, so that handlers can verify client certificates themselves, when the handshake doesn't.
+func makeTLSConfig(spec *spec.Spec, certFile, keyFile string) *tls.Config {
+	config := &tls.Config{
+		NextProtos: []string{"h2", "http/1.1"},
+	}
+
+	if certFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			log.Fatalf("Error loading TLS certificate %q and key %q: %v", certFile, keyFile, err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+
+	clientAuth, ok := clientAuthTypes[spec.TLSClientAuth]
+	if !ok {
+		log.Fatalf("Invalid TLS client auth mode %q", spec.TLSClientAuth)
+	}
+
+	if spec.TLSClientCA != "" {
+		caPEM, err := os.ReadFile(spec.TLSClientCA)
+		if err != nil {
+			log.Fatalf("Error reading TLS client CA file %q: %v", spec.TLSClientCA, err)
+		}
+		spec.TLSClientCAPool = x509.NewCertPool()
+		if !spec.TLSClientCAPool.AppendCertsFromPEM(caPEM) {
+			log.Fatalf("No certificates found in TLS client CA file %q", spec.TLSClientCA)
+		}
+	} else if clientAuth == tls.VerifyClientCertIfGiven || clientAuth == tls.RequireAndVerifyClientCert {
+		log.Fatalf("TLS client auth mode %q needs a client CA file", spec.TLSClientAuth)
+	}
+
+	config.ClientAuth = clientAuth
+	config.ClientCAs = spec.TLSClientCAPool
+	return config
+}
+
+// setupAutoTLS generates a CA, and a certificate for the server signed by it. Certificates for the invalid kinds
+// asked for are also generated, and returned.
+func setupAutoTLS(spec *spec.Spec, config *tls.Config) map[string]tls.Certificate {
+	authority, err := autotls.NewAuthority()
+	if err != nil {
+		log.Fatalf("Error generating TLS CA: %v", err)
+	}
+	spec.TLSAutoCAPEM = authority.PEM
+
+	cert, err := authority.Issue(spec.TLSAutoHosts, "")
+	if err != nil {
+		log.Fatalf("Error generating TLS certificate: %v", err)
+	}
+	config.Certificates = []tls.Certificate{cert}
+
+	invalidCerts := map[string]tls.Certificate{}
+	for kind := range spec.TLSAutoInvalid {
+		if !autotls.IsInvalidKind(kind) {
+			log.Fatalf("Unknown invalid certificate kind %q, should be one of %v", kind, autotls.InvalidKinds)
+		}
+		if invalidCerts[kind], err = authority.Issue(spec.TLSAutoHosts, kind); err != nil {
+			log.Fatalf("Error generating %s TLS certificate: %v", kind, err)
+		}
+	}
+
+	return invalidCerts
+}
+
 func (s Server) Wait() error {
 	return <-s.closeCh
 }
 
 func (s Server) CloseAndWait() {
+	if s.h3Server != nil {
+		ctx, cancelFunc := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancelFunc()
+		if err := s.h3Server.Shutdown(ctx); err != nil {
+			log.Printf("Error shutting down HTTP/3 server: %v", err)
+		}
+		if err := s.h3Conn.Close(); err != nil {
+			log.Printf("Error closing HTTP/3 UDP socket: %v", err)
+		}
+	}
+	if s.goAway != nil {
+		s.goAway.Close()
+	}
 	if s.Server != nil {
 		ctx, cancelFunc := context.WithTimeout(context.Background(), 5*time.Second)
 		defer cancelFunc()
@@ -85,12 +280,34 @@ func (s Server) CloseAndWait() {
 	log.Print(s.Wait())
 }
 
+// isHTTP3Reachable tells if HTTP/3 can be advertised in the response to the request, which is when it came over TLS, on
+// the TCP port that QUIC is served on the UDP port of. Plain HTTP and Unix socket listeners, and TLS listeners on other
+// ports, don't have HTTP/3 to switch to.
+func (s Server) isHTTP3Reachable(req *http.Request) bool {
+	if s.h3Server == nil || req.ProtoMajor >= 3 || req.TLS == nil {
+		return false
+	}
+
+	localAddr, ok := req.Context().Value(http.LocalAddrContextKey).(*net.TCPAddr)
+	return ok && localAddr.Port == s.h3Conn.LocalAddr().(*net.UDPAddr).Port
+}
+
 func (s Server) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 	if !strings.HasPrefix(req.URL.Path, s.spec.PathPrefix) {
 		http.NotFound(w, req)
 		return
 	}
 
+	if isH2CUpgrade(req) && s.serveH2CUpgrade(w, req) {
+		return
+	}
+
+	if s.isHTTP3Reachable(req) {
+		if err := s.h3Server.SetQUICHeaders(w.Header()); err != nil {
+			log.Printf("Error setting Alt-Svc header for HTTP/3: %v", err)
+		}
+	}
+
 	ex := ex.New(w, req, s.spec)
 
 	incomingIP := ex.FindIncomingIPAddress()
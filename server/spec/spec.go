@@ -1,7 +1,10 @@
 package spec
 
 import (
+	"cmp"
+	"crypto/x509"
 	"flag"
+	"log"
 	"os"
 	"strings"
 
@@ -17,6 +20,19 @@ type Spec struct {
 	BindTarget string
 	PathPrefix string
 
+	// If set, TLS is served on this bind target, and plain HTTP on BindTarget, at the same time.
+	TLSBindTarget string
+
+	// If true, HTTP/3 is served over QUIC, on the UDP port of the same address as TLS.
+	HTTP3 bool
+
+	// If set, plain HTTP is also served on a Unix domain socket at this path.
+	UnixSocket string
+
+	// If set, plain HTTP is also served on this bind target, with a server for each connection, where `/http2/goaway`
+	// can have GOAWAY sent, by shutting down the server of the connection, and `/http2/reset` can use any error code.
+	GoAwayBindTarget string
+
 	// If true, no route handlers are registered on any path, and `/` behaves like `/any`. This means that none of the
 	// UI pages will be accessible either. Like, opening `/` to see the homepage won't work.
 	RootIsAny bool
@@ -30,8 +46,45 @@ type Spec struct {
 	CommitShort string
 	Date        string
 
-	// Route configurations
+	// Client certificate authentication mode for TLS, one of `none`, `request`, `require`, `verify` or
+	// `require-verify`. And the file with PEM encoded CA certificates to verify client certificates against.
+	TLSClientAuth string
+	TLSClientCA   string
+
+	// Loaded from TLSClientCA when the server starts.
+	TLSClientCAPool *x509.CertPool
+
+	// If true, a CA and a certificate for TLSAutoHosts are generated at startup, instead of using a certificate from
+	// files. TLSAutoInvalid maps kinds of invalid certificates, like `expired`, to extra addresses to serve them on.
+	TLSAuto        bool
+	TLSAutoHosts   []string
+	TLSAutoInvalid map[string]string
+
+	// PEM encoded certificate of the CA generated for TLSAuto, when the server starts.
+	TLSAutoCAPEM []byte
+
+	// If true, all responses are compressed with a content coding negotiated from the request's `Accept-Encoding`.
+	NegotiateEncoding bool
+
+	// Route configurations. Zero means the default limit.
 	EndpointBytesSizeLimit int
+	EndpointRangeSizeLimit int
+}
+
+// Default size limits on the `/bytes` and `/range` endpoints.
+const (
+	DefaultEndpointBytesSizeLimit = 90
+	DefaultEndpointRangeSizeLimit = 1000
+)
+
+// BytesSizeLimit gives the size limit on the `/bytes` endpoint, or the default if none is set.
+func (s Spec) BytesSizeLimit() int {
+	return cmp.Or(s.EndpointBytesSizeLimit, DefaultEndpointBytesSizeLimit)
+}
+
+// RangeSizeLimit gives the size limit on the `/range` endpoint, or the default if none is set.
+func (s Spec) RangeSizeLimit() int {
+	return cmp.Or(s.EndpointRangeSizeLimit, DefaultEndpointRangeSizeLimit)
 }
 
 func ParseArgs() Spec {
@@ -42,10 +95,21 @@ func ParseArgs() Spec {
 	}
 
 	flag.StringVar(&spec.BindTarget, "bind", os.Getenv("HTTPBUN_BIND"), "Bind target for the server to listen on")
+	flag.StringVar(&spec.TLSBindTarget, "tls-bind", os.Getenv("HTTPBUN_TLS_BIND"), "Bind target to serve TLS on, while serving plain HTTP on --bind")
+	flag.BoolVar(&spec.HTTP3, "http3", os.Getenv("HTTPBUN_HTTP3") != "", "Serve HTTP/3 on the UDP port of the TLS bind target")
+	flag.StringVar(&spec.UnixSocket, "unix-socket", os.Getenv("HTTPBUN_UNIX_SOCKET"), "Path of a Unix domain socket to also serve plain HTTP on")
+	flag.StringVar(&spec.GoAwayBindTarget, "goaway-bind", os.Getenv("HTTPBUN_GOAWAY_BIND"), "Bind target to also serve plain HTTP on, where /http2/goaway, and /http2/reset with any code, are available")
 	flag.StringVar(&spec.PathPrefix, "path-prefix", "", "Prefix at which to serve the httpbun APIs")
 	flag.BoolVar(&spec.RootIsAny, "root-is-any", false, "Have _all_ endpoints behave like `/any`")
 	flag.StringVar(&spec.Banner, "banner", "", "A banner text to display on the homepage")
-	flag.IntVar(&spec.EndpointBytesSizeLimit, "endpoint-bytes-size-limit", 90, "Size limit on the /bytes endpoint, in number of bytes")
+	flag.StringVar(&spec.TLSClientAuth, "tls-client-auth", os.Getenv("HTTPBUN_TLS_CLIENT_AUTH"), "Client certificate mode for TLS: none, request, require, verify or require-verify")
+	flag.StringVar(&spec.TLSClientCA, "tls-client-ca", os.Getenv("HTTPBUN_TLS_CLIENT_CA"), "PEM file with CA certificates to verify TLS client certificates")
+	flag.BoolVar(&spec.TLSAuto, "tls-auto", false, "Serve TLS with a certificate signed by a CA generated at startup")
+	tlsAutoHosts := flag.String("tls-auto-hosts", "localhost,127.0.0.1,::1", "Comma separated hostnames and IPs for the --tls-auto certificate")
+	tlsAutoInvalid := flag.String("tls-auto-invalid", "", "Comma separated kind=address pairs to serve invalid certificates on, kinds being expired, not-yet-valid, wrong-host and self-signed")
+	flag.BoolVar(&spec.NegotiateEncoding, "negotiate-encoding", false, "Compress all responses based on the `Accept-Encoding` request header")
+	flag.IntVar(&spec.EndpointBytesSizeLimit, "endpoint-bytes-size-limit", DefaultEndpointBytesSizeLimit, "Size limit on the /bytes endpoint, in number of bytes")
+	flag.IntVar(&spec.EndpointRangeSizeLimit, "endpoint-range-size-limit", DefaultEndpointRangeSizeLimit, "Size limit on the /range endpoint, in number of bytes")
 	flag.Parse()
 
 	if spec.Banner != "" {
@@ -55,6 +119,21 @@ func ParseArgs() Spec {
 		spec.BannerFg = util.ComputeFgForBg(color)
 	}
 
+	for _, host := range strings.Split(*tlsAutoHosts, ",") {
+		if host = strings.TrimSpace(host); host != "" {
+			spec.TLSAutoHosts = append(spec.TLSAutoHosts, host)
+		}
+	}
+
+	spec.TLSAutoInvalid = map[string]string{}
+	for _, pair := range strings.Split(*tlsAutoInvalid, ",") {
+		if kind, bindTarget, ok := strings.Cut(strings.TrimSpace(pair), "="); ok {
+			spec.TLSAutoInvalid[kind] = bindTarget
+		} else if pair != "" {
+			log.Fatalf("Invalid --tls-auto-invalid entry %q, should be like `expired=:8443`", pair)
+		}
+	}
+
 	spec.PathPrefix = strings.Trim(spec.PathPrefix, "/")
 	if spec.PathPrefix != "" {
 		spec.PathPrefix = "/" + spec.PathPrefix
@@ -0,0 +1,96 @@
+package wire
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"sync"
+)
+
+// Maximum number of bytes recorded per request. Anything beyond is dropped, and the recording is marked as truncated.
+const maxRecordingSize = 64 << 10
+
+type contextKey struct{}
+
+// Recorder holds the bytes read from a connection, since the end of the previous request on it.
+type Recorder struct {
+	mu        sync.Mutex
+	buf       []byte
+	truncated bool
+}
+
+type recordingConn struct {
+	net.Conn
+	recorder *Recorder
+}
+
+type recordingListener struct {
+	net.Listener
+}
+
+// NewListener wraps the listener, so that all bytes read from accepted connections are recorded. This is only useful
+// for plain connections, since over TLS, it'd record encrypted bytes.
+func NewListener(listener net.Listener) net.Listener {
+	return recordingListener{listener}
+}
+
+func (l recordingListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return &recordingConn{Conn: conn, recorder: &Recorder{}}, nil
+}
+
+func (c *recordingConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	c.recorder.record(p[:n])
+	return n, err
+}
+
+// ConnContext is meant for `http.Server.ConnContext`, to make the connection's recorder available to requests.
+func ConnContext(ctx context.Context, conn net.Conn) context.Context {
+	if rc, ok := conn.(*recordingConn); ok {
+		return context.WithValue(ctx, contextKey{}, rc.recorder)
+	}
+	return ctx
+}
+
+// ConnState is meant for `http.Server.ConnState`. It starts a fresh recording when a connection goes idle, so that
+// each request on a keep-alive connection gets its own recording.
+func ConnState(conn net.Conn, state http.ConnState) {
+	if rc, ok := conn.(*recordingConn); ok && state == http.StateIdle {
+		rc.recorder.reset()
+	}
+}
+
+// FromContext gets the recorder of the connection the request came on, if any.
+func FromContext(ctx context.Context) *Recorder {
+	recorder, _ := ctx.Value(contextKey{}).(*Recorder)
+	return recorder
+}
+
+func (r *Recorder) record(p []byte) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if room := maxRecordingSize - len(r.buf); room < len(p) {
+		p = p[:max(room, 0)]
+		r.truncated = true
+	}
+	r.buf = append(r.buf, p...)
+}
+
+func (r *Recorder) reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.buf = nil
+	r.truncated = false
+}
+
+// Bytes returns a copy of the bytes recorded so far, and whether any were dropped for exceeding the size limit.
+func (r *Recorder) Bytes() ([]byte, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]byte(nil), r.buf...), r.truncated
+}
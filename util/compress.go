@@ -0,0 +1,136 @@
+package util
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+)
+
+// ContentEncodings are the content codings supported by httpbun, in order of preference when negotiating.
+var ContentEncodings = []string{"zstd", "br", "gzip", "deflate"}
+
+// EncodingWriter is a compressing writer that can be flushed, so that streaming responses can be decoded by the client
+// as they come in, instead of only at the end.
+type EncodingWriter interface {
+	io.WriteCloser
+	Flush() error
+}
+
+func NewEncodingWriter(w io.Writer, encoding string) (EncodingWriter, error) {
+	switch encoding {
+	case "gzip":
+		return gzip.NewWriter(w), nil
+	case "deflate":
+		// The `deflate` content coding is actually the zlib format. See RFC 9110, section 8.4.1.2.
+		return zlib.NewWriter(w), nil
+	case "br":
+		return brotli.NewWriter(w), nil
+	case "zstd":
+		return zstd.NewWriter(w)
+	default:
+		return nil, fmt.Errorf("unsupported content encoding %q", encoding)
+	}
+}
+
+func Encode(data []byte, encoding string) ([]byte, error) {
+	buf := &bytes.Buffer{}
+
+	w, err := NewEncodingWriter(buf, encoding)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// Largest zstd window accepted when decoding. Streaming encoders commonly use windows of a few MiB, whatever the size
+// of the content.
+const maxZstdWindow = 8 << 20
+
+// NewDecodingReader decodes the content coding. The zstd decoder's window is capped at maxZstdWindow, since a frame can
+// otherwise have it allocate far more memory than the body needs, for a tiny input. Callers limit the decoded size.
+func NewDecodingReader(r io.Reader, encoding string) (io.ReadCloser, error) {
+	switch encoding {
+	case "gzip", "x-gzip":
+		return gzip.NewReader(r)
+	case "deflate":
+		return zlib.NewReader(r)
+	case "br":
+		return io.NopCloser(brotli.NewReader(r)), nil
+	case "zstd":
+		decoder, err := zstd.NewReader(
+			r,
+			zstd.WithDecoderConcurrency(1),
+			zstd.WithDecoderMaxMemory(maxZstdWindow),
+			zstd.WithDecoderMaxWindow(maxZstdWindow),
+		)
+		if err != nil {
+			return nil, err
+		}
+		return decoder.IOReadCloser(), nil
+	default:
+		return nil, fmt.Errorf("unsupported content encoding %q", encoding)
+	}
+}
+
+// NegotiateEncoding picks the content coding to use for a response, given the `Accept-Encoding` header in the request.
+// An empty string is returned if the response should not be encoded.
+func NegotiateEncoding(acceptEncoding string) string {
+	qValues := map[string]float64{}
+	wildcardQ := -1.0
+
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		name, params, _ := strings.Cut(part, ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+
+		q := 1.0
+		for _, param := range strings.Split(params, ";") {
+			key, value, _ := strings.Cut(param, "=")
+			if strings.TrimSpace(strings.ToLower(key)) == "q" {
+				if parsed, err := strconv.ParseFloat(strings.TrimSpace(value), 64); err == nil {
+					q = parsed
+				}
+			}
+		}
+
+		if name == "*" {
+			wildcardQ = q
+		} else if name == "x-gzip" {
+			qValues["gzip"] = q
+		} else {
+			qValues[name] = q
+		}
+	}
+
+	best := ""
+	bestQ := 0.0
+	for _, encoding := range ContentEncodings {
+		q, ok := qValues[encoding]
+		if !ok {
+			q = max(wildcardQ, 0)
+		}
+		if q > bestQ {
+			best, bestQ = encoding, q
+		}
+	}
+
+	return best
+}
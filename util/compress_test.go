@@ -0,0 +1,72 @@
+package util
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+func TestNegotiateEncoding(t *testing.T) {
+	tests := []struct {
+		acceptEncoding string
+		expected       string
+	}{
+		{"", ""},
+		{"identity", ""},
+		{"gzip", "gzip"},
+		{"x-gzip", "gzip"},
+		{"gzip, deflate, br, zstd", "zstd"},
+		{"gzip;q=1.0, br;q=0.5", "gzip"},
+		{"GZIP;Q=0.2, deflate;q=0.1", "gzip"},
+		{"*", "zstd"},
+		{"*;q=0.5, zstd;q=0", "br"},
+		{"br;q=0", ""},
+		{"compress, gzip", "gzip"},
+	}
+
+	for _, tt := range tests {
+		if got := NegotiateEncoding(tt.acceptEncoding); got != tt.expected {
+			t.Errorf("NegotiateEncoding(%q) = %q, want %q", tt.acceptEncoding, got, tt.expected)
+		}
+	}
+}
+
+func TestZstdDecodingIsBounded(t *testing.T) {
+	compress := func(data []byte, window int) []byte {
+		buf := &bytes.Buffer{}
+		w, err := zstd.NewWriter(buf, zstd.WithWindowSize(window), zstd.WithSingleSegment(false))
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, _ = w.Write(data)
+		_ = w.Flush()
+		_ = w.Close()
+		return buf.Bytes()
+	}
+
+	decode := func(data []byte) ([]byte, error) {
+		r, err := NewDecodingReader(bytes.NewReader(data), "zstd")
+		if err != nil {
+			return nil, err
+		}
+		defer r.Close()
+		return io.ReadAll(r)
+	}
+
+	small := []byte("hello, hello, hello")
+	if got, err := decode(compress(small, 8<<10)); err != nil || !bytes.Equal(got, small) {
+		t.Errorf("decoding a small body gave %q, %v", got, err)
+	}
+
+	// Streaming encoders ask for windows of a few MiB, even for small content.
+	if got, err := decode(compress(small, 4<<20)); err != nil || !bytes.Equal(got, small) {
+		t.Errorf("decoding a small body with a 4 MiB window gave %q, %v", got, err)
+	}
+
+	// A frame asking for a 64 MiB window is refused, whatever the size of its content.
+	if _, err := decode(compress(small, 64<<20)); err == nil {
+		t.Error("decoding a body with a huge window should fail")
+	}
+}
@@ -0,0 +1,296 @@
+package util
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"html"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/sharat87/httpbun/c"
+)
+
+// Format is a way to serialize structured response bodies.
+type Format struct {
+	Name        string
+	ContentType string
+	MediaTypes  []string // Media types in `Accept` headers that select this format.
+	Marshal     func(data any) ([]byte, error)
+}
+
+// Formats supported for structured response bodies. The first one is the default, and the order breaks ties when
+// negotiating with the `Accept` header.
+var Formats = []Format{
+	{"json", c.ApplicationJSON, []string{"application/json"}, marshalJSON},
+	{"html", c.TextHTML, []string{"text/html", "application/xhtml+xml"}, marshalHTML},
+	{"yaml", "application/yaml", []string{"application/yaml", "application/x-yaml", "text/yaml", "text/x-yaml"}, marshalYAML},
+	{"xml", "application/xml", []string{"application/xml", "text/xml"}, marshalXML},
+	{"text", c.TextPlain, []string{"text/plain"}, marshalText},
+}
+
+var xmlNamePattern = regexp.MustCompile(`^[A-Za-z_][-\w.]*$`)
+
+func FindFormat(name string) (Format, bool) {
+	for _, format := range Formats {
+		if format.Name == strings.ToLower(name) {
+			return format, true
+		}
+	}
+	return Format{}, false
+}
+
+// NegotiateFormat picks the format with the highest quality in the given `Accept` header. If none of the formats are
+// acceptable, the default is returned anyway, since a structured response is better than none.
+func NegotiateFormat(accept string) Format {
+	best := Formats[0]
+	bestQ := 0.0
+
+	for _, format := range Formats {
+		q := acceptQuality(accept, format.MediaTypes)
+		if q > bestQ {
+			best, bestQ = format, q
+		}
+	}
+
+	return best
+}
+
+// acceptQuality finds the quality value given in the `Accept` header, to the most specific range matching any of the
+// media types.
+func acceptQuality(accept string, mediaTypes []string) float64 {
+	q := 0.0
+	specificity := -1
+
+	for _, part := range strings.Split(accept, ",") {
+		mediaRange, params, _ := strings.Cut(part, ";")
+		mediaRange = strings.ToLower(strings.TrimSpace(mediaRange))
+
+		partSpecificity := -1
+		for _, mediaType := range mediaTypes {
+			typeName, _, _ := strings.Cut(mediaType, "/")
+			if mediaRange == mediaType {
+				partSpecificity = 2
+			} else if mediaRange == typeName+"/*" {
+				partSpecificity = max(partSpecificity, 1)
+			} else if mediaRange == "*/*" {
+				partSpecificity = max(partSpecificity, 0)
+			}
+		}
+
+		if partSpecificity > specificity {
+			specificity = partSpecificity
+			q = parseQuality(params)
+		}
+	}
+
+	return q
+}
+
+func parseQuality(params string) float64 {
+	for _, param := range strings.Split(params, ";") {
+		key, value, _ := strings.Cut(param, "=")
+		if strings.ToLower(strings.TrimSpace(key)) == "q" {
+			if q, err := strconv.ParseFloat(strings.TrimSpace(value), 64); err == nil {
+				return q
+			}
+		}
+	}
+	return 1
+}
+
+func marshalJSON(data any) ([]byte, error) {
+	return ToJsonMust(data), nil
+}
+
+// toGeneric converts any JSON-serializable value into plain maps, slices and scalars, so that all formats show the
+// same keys that the JSON output has.
+func toGeneric(data any) (any, error) {
+	decoder := json.NewDecoder(bytes.NewReader(ToJsonMust(data)))
+	decoder.UseNumber()
+	var result any
+	err := decoder.Decode(&result)
+	return result, err
+}
+
+func sortedKeys(m map[string]any) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+func marshalYAML(data any) ([]byte, error) {
+	generic, err := toGeneric(data)
+	if err != nil {
+		return nil, err
+	}
+	return yaml.Marshal(yamlNumbers(generic))
+}
+
+// yamlNumbers converts JSON numbers to actual numbers, since YAML would otherwise show them as strings.
+func yamlNumbers(value any) any {
+	switch v := value.(type) {
+	case map[string]any:
+		for key, item := range v {
+			v[key] = yamlNumbers(item)
+		}
+	case []any:
+		for i, item := range v {
+			v[i] = yamlNumbers(item)
+		}
+	case json.Number:
+		if n, err := v.Int64(); err == nil {
+			return n
+		} else if f, err := v.Float64(); err == nil {
+			return f
+		}
+	}
+	return value
+}
+
+func marshalXML(data any) ([]byte, error) {
+	generic, err := toGeneric(data)
+	if err != nil {
+		return nil, err
+	}
+	buf := &bytes.Buffer{}
+	buf.WriteString(xml.Header)
+	writeXMLElement(buf, "response", generic)
+	buf.WriteString("\n")
+	return buf.Bytes(), nil
+}
+
+func writeXMLElement(buf *bytes.Buffer, name string, value any) {
+	// Keys that can't be XML element names are written as attributes of a generic element.
+	if xmlNamePattern.MatchString(name) && !strings.HasPrefix(strings.ToLower(name), "xml") {
+		buf.WriteString("<" + name + ">")
+		defer buf.WriteString("</" + name + ">")
+	} else {
+		buf.WriteString(`<entry key="`)
+		_ = xml.EscapeText(buf, []byte(name))
+		buf.WriteString(`">`)
+		defer buf.WriteString("</entry>")
+	}
+
+	switch v := value.(type) {
+	case map[string]any:
+		for _, key := range sortedKeys(v) {
+			writeXMLElement(buf, key, v[key])
+		}
+	case []any:
+		for _, item := range v {
+			writeXMLElement(buf, "item", item)
+		}
+	case nil:
+		// Empty element.
+	default:
+		_ = xml.EscapeText(buf, []byte(fmt.Sprint(v)))
+	}
+}
+
+// marshalText writes one line per leaf value, with the full path to it, like `headers.Accept: */*`.
+func marshalText(data any) ([]byte, error) {
+	generic, err := toGeneric(data)
+	if err != nil {
+		return nil, err
+	}
+	buf := &bytes.Buffer{}
+	writeTextLines(buf, "", generic)
+	return buf.Bytes(), nil
+}
+
+func writeTextLines(buf *bytes.Buffer, path string, value any) {
+	switch v := value.(type) {
+	case map[string]any:
+		if len(v) == 0 {
+			buf.WriteString(path + ": {}\n")
+		}
+		for _, key := range sortedKeys(v) {
+			if path == "" {
+				writeTextLines(buf, key, v[key])
+			} else {
+				writeTextLines(buf, path+"."+key, v[key])
+			}
+		}
+	case []any:
+		if len(v) == 0 {
+			buf.WriteString(path + ": []\n")
+		}
+		for i, item := range v {
+			writeTextLines(buf, path+"["+strconv.Itoa(i)+"]", item)
+		}
+	case nil:
+		buf.WriteString(path + ": null\n")
+	case string:
+		// Quoting keeps multi-line and empty values on a single line.
+		buf.WriteString(path + ": " + strconv.Quote(v) + "\n")
+	default:
+		buf.WriteString(path + ": " + fmt.Sprint(v) + "\n")
+	}
+}
+
+func marshalHTML(data any) ([]byte, error) {
+	generic, err := toGeneric(data)
+	if err != nil {
+		return nil, err
+	}
+	buf := &bytes.Buffer{}
+	buf.WriteString(`<!doctype html>
+<meta charset=utf-8>
+<meta name=viewport content="width=device-width, initial-scale=1">
+<title>Httpbun</title>
+<style>
+body { font: 16px system-ui, sans-serif; margin: 1em auto; max-width: 960px; color: #333; }
+table { border-collapse: collapse; width: 100%; }
+th, td { border: 1px solid #ccc; padding: 4px 8px; text-align: left; vertical-align: top; }
+th { background: #f4f4f4; white-space: nowrap; width: 1%; }
+td > table { margin: -1px; width: calc(100% + 2px); }
+.null, .empty { color: #999; font-style: italic; }
+pre { margin: 0; white-space: pre-wrap; word-break: break-all; }
+</style>
+`)
+	writeHTMLValue(buf, generic)
+	buf.WriteString("\n")
+	return buf.Bytes(), nil
+}
+
+func writeHTMLValue(buf *bytes.Buffer, value any) {
+	switch v := value.(type) {
+	case map[string]any:
+		if len(v) == 0 {
+			buf.WriteString("<span class=empty>empty</span>")
+			return
+		}
+		buf.WriteString("<table>")
+		for _, key := range sortedKeys(v) {
+			buf.WriteString("<tr><th>" + html.EscapeString(key) + "<td>")
+			writeHTMLValue(buf, v[key])
+		}
+		buf.WriteString("</table>")
+	case []any:
+		if len(v) == 0 {
+			buf.WriteString("<span class=empty>empty</span>")
+			return
+		}
+		buf.WriteString("<table>")
+		for i, item := range v {
+			buf.WriteString("<tr><th>" + strconv.Itoa(i) + "<td>")
+			writeHTMLValue(buf, item)
+		}
+		buf.WriteString("</table>")
+	case nil:
+		buf.WriteString("<span class=null>null</span>")
+	case string:
+		buf.WriteString("<pre>" + html.EscapeString(v) + "</pre>")
+	default:
+		buf.WriteString(html.EscapeString(fmt.Sprint(v)))
+	}
+}
@@ -0,0 +1,106 @@
+package util
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrInvalidRange        = errors.New("invalid range")
+	ErrRangeNotSatisfiable = errors.New("range not satisfiable")
+)
+
+// ByteRange is a range of bytes, with both ends inclusive, like in `Content-Range`.
+type ByteRange struct {
+	Start int64
+	End   int64
+}
+
+func (r ByteRange) Length() int64 {
+	return r.End - r.Start + 1
+}
+
+// ContentRange is the value for the `Content-Range` header, for this range of a representation of the given size.
+func (r ByteRange) ContentRange(size int64) string {
+	return fmt.Sprintf("bytes %d-%d/%d", r.Start, r.End, size)
+}
+
+// ParseByteRanges parses the value of a `Range` header, for a representation of the given size, as per RFC 9110,
+// section 14.1.2. Ranges past the end are clipped to the end, and ones that start past the end are dropped. If the
+// header can't be parsed, ErrInvalidRange is returned, and the header should be ignored. If no ranges are left after
+// dropping, ErrRangeNotSatisfiable is returned.
+func ParseByteRanges(header string, size int64) ([]ByteRange, error) {
+	unit, specs, found := strings.Cut(header, "=")
+	if !found || !strings.EqualFold(strings.TrimSpace(unit), "bytes") {
+		return nil, ErrInvalidRange
+	}
+
+	var ranges []ByteRange
+	hasSpec := false
+
+	for _, spec := range strings.Split(specs, ",") {
+		spec = strings.TrimSpace(spec)
+		if spec == "" {
+			continue
+		}
+		hasSpec = true
+
+		first, last, found := strings.Cut(spec, "-")
+		if !found {
+			return nil, ErrInvalidRange
+		}
+
+		if first == "" {
+			// A suffix range, for the last bytes.
+			suffix, err := parseRangeInt(last)
+			if err != nil {
+				return nil, err
+			}
+			if suffix > 0 && size > 0 {
+				ranges = append(ranges, ByteRange{max(size-suffix, 0), size - 1})
+			}
+			continue
+		}
+
+		start, err := parseRangeInt(first)
+		if err != nil {
+			return nil, err
+		}
+
+		end := size - 1
+		if last != "" {
+			if end, err = parseRangeInt(last); err != nil {
+				return nil, err
+			} else if end < start {
+				return nil, ErrInvalidRange
+			}
+			end = min(end, size-1)
+		}
+
+		if start < size {
+			ranges = append(ranges, ByteRange{start, end})
+		}
+	}
+
+	if !hasSpec {
+		return nil, ErrInvalidRange
+	} else if len(ranges) == 0 {
+		return nil, ErrRangeNotSatisfiable
+	}
+
+	return ranges, nil
+}
+
+func parseRangeInt(value string) (int64, error) {
+	// Only digits are allowed, so things like `+5` aren't accepted.
+	if value == "" || strings.TrimLeft(value, "0123456789") != "" {
+		return 0, ErrInvalidRange
+	}
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, ErrInvalidRange
+	}
+	return n, nil
+}
@@ -0,0 +1,48 @@
+package util
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseByteRanges(t *testing.T) {
+	tests := []struct {
+		header   string
+		size     int64
+		expected []ByteRange
+		err      error
+	}{
+		{"bytes=0-9", 100, []ByteRange{{0, 9}}, nil},
+		{"bytes=90-", 100, []ByteRange{{90, 99}}, nil},
+		{"bytes=-10", 100, []ByteRange{{90, 99}}, nil},
+		{"bytes=-200", 100, []ByteRange{{0, 99}}, nil},
+		{"bytes=50-200", 100, []ByteRange{{50, 99}}, nil},
+		{"bytes=0-0, 5-9 ,-1", 100, []ByteRange{{0, 0}, {5, 9}, {99, 99}}, nil},
+		{"Bytes=0-1,,", 100, []ByteRange{{0, 1}}, nil},
+		{"bytes=100-", 100, nil, ErrRangeNotSatisfiable},
+		{"bytes=-0", 100, nil, ErrRangeNotSatisfiable},
+		{"bytes=0-", 0, nil, ErrRangeNotSatisfiable},
+		{"bytes=200-300,0-1", 100, []ByteRange{{0, 1}}, nil},
+		{"bytes=9-0", 100, nil, ErrInvalidRange},
+		{"bytes=a-b", 100, nil, ErrInvalidRange},
+		{"bytes=+1-2", 100, nil, ErrInvalidRange},
+		{"bytes=5", 100, nil, ErrInvalidRange},
+		{"bytes=", 100, nil, ErrInvalidRange},
+		{"items=0-1", 100, nil, ErrInvalidRange},
+		{"0-1", 100, nil, ErrInvalidRange},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.header, func(t *testing.T) {
+			ranges, err := ParseByteRanges(tt.header, tt.size)
+			assert.Equal(t, tt.err, err)
+			assert.Equal(t, tt.expected, ranges)
+		})
+	}
+}
+
+func TestByteRangeContentRange(t *testing.T) {
+	assert.Equal(t, "bytes 5-9/100", ByteRange{5, 9}.ContentRange(100))
+	assert.Equal(t, int64(5), ByteRange{5, 9}.Length())
+}